@@ -0,0 +1,279 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// caseRecord represents an individual COVID-19 case reported to the Bioportal.
+// Each case is described as a JSON object:
+//
+//  {
+//    "caseId": "0b8e2c7a-6f1d-4c1e-9a55-3f0f6a3d2b11",
+//    "collectedDate": "6/23/2020",
+//    "reportedDate": "6/25/2020",
+//    "ageRange": "60 to 69",
+//    "sex": "Female",
+//    "city": "Las Piedras",
+//    "classification": "Confirmed",
+//    "hospitalized": "Yes",
+//    "icu": "No",
+//    "deceased": "Yes",
+//    "deathDate": "7/3/2020"
+//  }
+type caseRecord struct {
+	ID           string    `json:"caseId"`
+	Collected    jsonDate  `json:"collectedDate"`
+	Reported     jsonDate  `json:"reportedDate"`
+	AgeRange     ageRange  `json:"ageRange"`
+	Sex          sex       `json:"sex"`
+	City         string    `json:"city"`
+	Class        caseClass `json:"classification"`
+	Hospitalized yesNo     `json:"hospitalized"`
+	ICU          yesNo     `json:"icu"`
+	Deceased     yesNo     `json:"deceased"`
+	Died         jsonDate  `json:"deathDate"`
+}
+
+type sex int
+
+const (
+	unknownSex sex = iota
+	female
+	male
+)
+
+var sexStrings = map[string]sex{
+	"Female":    female,
+	"F":         female,
+	"Femenino":  female,
+	"Male":      male,
+	"M":         male,
+	"Masculino": male,
+
+	"Unknown":     unknownSex,
+	"Desconocido": unknownSex,
+	"Other":       unknownSex,
+	"N/A":         unknownSex,
+	"":            unknownSex,
+}
+
+var sexEnum = newEnum("sex", sexStrings)
+
+func (s *sex) UnmarshalJSON(b []byte) error {
+	v, err := sexEnum.unmarshal(b)
+	if err != nil {
+		return err
+	}
+	*s = sex(v)
+	return nil
+}
+
+type caseClass int
+
+const (
+	unknownClass caseClass = iota
+	confirmed              // positive molecular test
+	probable               // positive antigen test or clinical criteria
+	suspected              // symptoms without a positive test
+)
+
+var caseClassStrings = map[string]caseClass{
+	"Confirmed":  confirmed,
+	"Confirmado": confirmed,
+	"Probable":   probable,
+	"Suspected":  suspected,
+	"Sospechoso": suspected,
+	"":           unknownClass,
+}
+
+var caseClassEnum = newEnum("case classification", caseClassStrings)
+
+func (c *caseClass) UnmarshalJSON(b []byte) error {
+	v, err := caseClassEnum.unmarshal(b)
+	if err != nil {
+		return err
+	}
+	*c = caseClass(v)
+	return nil
+}
+
+// yesNo is used for boolean properties that may also be unknown.
+type yesNo int
+
+const (
+	unknownYesNo yesNo = iota
+	yes
+	no
+)
+
+var yesNoStrings = map[string]yesNo{
+	"Yes":  yes,
+	"Y":    yes,
+	"Sí":   yes,
+	"True": yes,
+
+	"No":    no,
+	"N":     no,
+	"False": no,
+
+	"Unknown":     unknownYesNo,
+	"Desconocido": unknownYesNo,
+	"N/A":         unknownYesNo,
+	"":            unknownYesNo,
+}
+
+var yesNoEnum = newEnum("yes/no value", yesNoStrings)
+
+func (y *yesNo) UnmarshalJSON(b []byte) error {
+	v, err := yesNoEnum.unmarshal(b)
+	if err != nil {
+		return err
+	}
+	*y = yesNo(v)
+	return nil
+}
+
+type caseStats struct {
+	confirmed, probable int // new cases by classification (suspected cases are ignored)
+	hosp, icu           int // new cases that were hospitalized or admitted to an ICU
+	deaths              int // deaths
+
+	ageCases, ageDeaths map[ageRange]int // confirmed and probable cases and deaths grouped by age
+}
+
+func newCaseStats() *caseStats {
+	return &caseStats{
+		ageCases:  make(map[ageRange]int),
+		ageDeaths: make(map[ageRange]int),
+	}
+}
+
+func (s caseStats) String() string {
+	return fmt.Sprintf("%4d %4d %3d %3d %3d", s.confirmed, s.probable, s.hosp, s.icu, s.deaths)
+}
+
+// addCase incorporates a single case into s.
+func (s *caseStats) addCase(cl caseClass, ar ageRange, hosp, icu bool) {
+	switch cl {
+	case confirmed:
+		s.confirmed++
+	case probable:
+		s.probable++
+	default:
+		return
+	}
+	s.ageCases[ar]++
+	if hosp {
+		s.hosp++
+	}
+	if icu {
+		s.icu++
+	}
+}
+
+// addDeath incorporates a single death into s.
+func (s *caseStats) addDeath(ar ageRange) {
+	s.deaths++
+	s.ageDeaths[ar]++
+}
+
+func (s *caseStats) cases() int {
+	return s.confirmed + s.probable
+}
+
+// add incorporates o into s.
+func (s *caseStats) add(o *caseStats) {
+	if o == nil {
+		return
+	}
+	s.confirmed += o.confirmed
+	s.probable += o.probable
+	s.hosp += o.hosp
+	s.icu += o.icu
+	s.deaths += o.deaths
+	for ar := ageMin; ar <= ageMax; ar++ {
+		s.ageCases[ar] += o.ageCases[ar]
+		s.ageDeaths[ar] += o.ageDeaths[ar]
+	}
+}
+
+// scale multiplies s's values by sc.
+func (s *caseStats) scale(sc float64) {
+	rs := func(v int) int { return int(math.Round(sc * float64(v))) }
+	s.confirmed = rs(s.confirmed)
+	s.probable = rs(s.probable)
+	s.hosp = rs(s.hosp)
+	s.icu = rs(s.icu)
+	s.deaths = rs(s.deaths)
+	for ar := ageMin; ar <= ageMax; ar++ {
+		s.ageCases[ar] = rs(s.ageCases[ar])
+		s.ageDeaths[ar] = rs(s.ageDeaths[ar])
+	}
+}
+
+// caseStatsMap holds caseStats indexed by time (typically days).
+type caseStatsMap map[time.Time]*caseStats
+
+// get returns the caseStats object for t, creating it if necessary.
+func (m caseStatsMap) get(t time.Time) *caseStats {
+	if s, ok := m[t]; ok {
+		return s
+	}
+	s := newCaseStats()
+	m[t] = s
+	return s
+}
+
+// weeklyCaseStats aggregates the stats in dm by week (starting on Sundays).
+func weeklyCaseStats(dm caseStatsMap) caseStatsMap {
+	wm := make(caseStatsMap)
+	addWeekly(dm, func(week, day time.Time) { wm.get(week).add(dm[day]) })
+	return wm
+}
+
+// averageCaseStats returns a new map with a numDays-day rolling average for each day in dm.
+func averageCaseStats(dm caseStatsMap, numDays int) caseStatsMap {
+	am := make(caseStatsMap)
+	addAverages(dm, numDays,
+		func(dst, src time.Time) { am.get(dst).add(dm[src]) },
+		func(dst time.Time, sc float64) { am.get(dst).scale(sc) })
+	return am
+}
+
+// readCases reads a JSON array of case objects from r and returns daily stats.
+// Cases are grouped by reporting date and deaths by date of death. Deaths without
+// a valid date of death are grouped by the case's reporting date instead.
+func readCases(r io.Reader) (caseStatsMap, error) {
+	now := time.Now()
+	valid := func(t time.Time) bool { return !t.Before(startDate) && !t.After(now) }
+	m := make(caseStatsMap)
+
+	if err := readArray(r, func(dec *json.Decoder) error {
+		var c caseRecord
+		if err := dec.Decode(&c); err != nil {
+			return fmt.Errorf("failed reading case: %v", err)
+		}
+		rep := time.Time(c.Reported)
+		if valid(rep) {
+			m.get(rep).addCase(c.Class, c.AgeRange, c.Hospitalized == yes, c.ICU == yes)
+		}
+		if c.Deceased == yes {
+			if died := time.Time(c.Died); valid(died) {
+				m.get(died).addDeath(c.AgeRange)
+			} else if valid(rep) {
+				m.get(rep).addDeath(c.AgeRange)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCaseRecord_Unmarshal(t *testing.T) {
+	const in = `{"caseId":"0b8e2c7a","collectedDate":"6/23/2020","reportedDate":"6/25/2020","ageRange":"60 to 69","sex":"Female","city":"Las Piedras","classification":"Confirmed","hospitalized":"Yes","icu":"No","deceased":"Yes","deathDate":"7/3/2020"}`
+
+	var got caseRecord
+	if err := json.Unmarshal([]byte(in), &got); err != nil {
+		t.Fatal("Unmarshaling failed: ", err)
+	}
+	if diff := cmp.Diff(caseRecord{
+		ID:           "0b8e2c7a",
+		Collected:    jsonDate(makeTime("2006-01-02", "2020-06-23")),
+		Reported:     jsonDate(makeTime("2006-01-02", "2020-06-25")),
+		AgeRange:     age60To69,
+		Sex:          female,
+		City:         "Las Piedras",
+		Class:        confirmed,
+		Hospitalized: yes,
+		ICU:          no,
+		Deceased:     yes,
+		Died:         jsonDate(makeTime("2006-01-02", "2020-07-03")),
+	}, got, cmpopts.IgnoreUnexported(jsonDate{})); diff != "" {
+		t.Error("Didn't unmarshal case correctly:\n" + diff)
+	}
+}
+
+func TestReadCases(t *testing.T) {
+	const in = `[
+{"reportedDate":"6/25/2020","ageRange":"60 to 69","classification":"Confirmed","hospitalized":"Yes","icu":"Yes","deceased":"Yes","deathDate":"7/3/2020"},
+{"reportedDate":"6/25/2020","ageRange":"20 to 29","classification":"Probable","hospitalized":"No","icu":"","deceased":"No","deathDate":""},
+{"reportedDate":"6/25/2020","ageRange":"20 to 29","classification":"Suspected","hospitalized":"Yes","icu":"","deceased":"","deathDate":""},
+{"reportedDate":"6/26/2020","ageRange":"80 to 89","classification":"Confirmed","hospitalized":"Yes","icu":"No","deceased":"Yes","deathDate":""}
+]`
+	m, err := readCases(strings.NewReader(in))
+	if err != nil {
+		t.Fatal("readCases failed: ", err)
+	}
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2020, m, d, 0, 0, 0, 0, loc) }
+	for _, tc := range []struct {
+		d                                      time.Time
+		confirmed, probable, hosp, icu, deaths int
+	}{
+		{day(6, 25), 1, 1, 1, 1, 0},
+		{day(6, 26), 1, 0, 1, 0, 1}, // death without date
+		{day(7, 3), 0, 0, 0, 0, 1},
+	} {
+		s := m[tc.d]
+		if s == nil {
+			t.Errorf("No stats for %v", tc.d.Format("2006-01-02"))
+			continue
+		}
+		if s.confirmed != tc.confirmed || s.probable != tc.probable || s.hosp != tc.hosp ||
+			s.icu != tc.icu || s.deaths != tc.deaths {
+			t.Errorf("Stats for %v are %v; want %d %d %d %d %d", tc.d.Format("2006-01-02"), s,
+				tc.confirmed, tc.probable, tc.hosp, tc.icu, tc.deaths)
+		}
+	}
+	if len(m) != 3 {
+		t.Errorf("Got stats for %d days; want 3", len(m))
+	}
+	if v := m[day(6, 25)].ageCases[age20To29]; v != 1 {
+		t.Errorf("ageCases[age20To29] = %d; want 1", v)
+	}
+	if v := m[day(7, 3)].ageDeaths[age60To69]; v != 1 {
+		t.Errorf("ageDeaths[age60To69] = %d; want 1", v)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// enum maps the strings that the Bioportal API uses for a property to integer values.
+// The API isn't consistent about capitalization, spacing, or accents (e.g. "Molecular"
+// vs. "MOLECULAR" or "Sí" vs. "SI"), so strings are normalized before being looked up.
+type enum struct {
+	name string         // property name used in errors, e.g. "result"
+	vals map[string]int // normalized strings to values
+}
+
+// newEnum returns an enum named name that maps the keys in strs, a map from strings
+// to an integer type, to their values. It panics if two keys normalize to the same
+// string but have different values.
+func newEnum(name string, strs interface{}) *enum {
+	e := &enum{name: name, vals: make(map[string]int)}
+	iter := reflect.ValueOf(strs).MapRange()
+	for iter.Next() {
+		key := normEnum(iter.Key().String())
+		val := int(iter.Value().Int())
+		if old, ok := e.vals[key]; ok && old != val {
+			panic(fmt.Sprintf("%v strings normalized to %q have values %d and %d", name, key, old, val))
+		}
+		e.vals[key] = val
+	}
+	return e
+}
+
+// accentReplacer strips accents from the Spanish characters used by the API.
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"Á", "a", "É", "e", "Í", "i", "Ó", "o", "Ú", "u", "Ü", "u", "Ñ", "n")
+
+// normEnum returns a normalized version of s: lowercase, without accents, and with
+// runs of whitespace collapsed to single spaces.
+func normEnum(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(accentReplacer.Replace(s)), " "))
+}
+
+// lookup returns the value for s.
+func (e *enum) lookup(s string) (int, bool) {
+	v, ok := e.vals[normEnum(s)]
+	return v, ok
+}
+
+// unmarshal unmarshals a JSON string from b and returns its value.
+func (e *enum) unmarshal(b []byte) (int, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return 0, err
+	}
+	v, ok := e.lookup(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid %v %q", e.name, s)
+	}
+	return v, nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnum_Unmarshal(t *testing.T) {
+	for _, tc := range []struct {
+		e    *enum
+		in   string
+		want int // -1 if error expected
+	}{
+		{resultEnum, `"Positive"`, int(positive)},
+		{resultEnum, `"NOT DETECTED"`, int(negative)},
+		{resultEnum, `"  COVID-19   Negative "`, int(negative)},
+		{resultEnum, `""`, int(otherResult)},
+		{resultEnum, `"Maybe"`, -1},
+		{resultEnum, `3`, -1},
+		{testTypeEnum, `"MOLECULAR"`, int(molecular)},
+		{testTypeEnum, `"ANTIGENO"`, int(antigen)},
+		{testTypeEnum, `"Antígeno"`, int(antigen)},
+		{ageRangeEnum, `"30 TO 39"`, int(age30To39)},
+		{yesNoEnum, `"SI"`, int(yes)},
+		{yesNoEnum, `"Sí"`, int(yes)},
+		{yesNoEnum, `"no"`, int(no)},
+		{sexEnum, `"FEMENINO"`, int(female)},
+		{doseEnum, `"Segunda"`, int(secondDose)},
+	} {
+		got, err := tc.e.unmarshal([]byte(tc.in))
+		if tc.want < 0 {
+			if err == nil {
+				t.Errorf("%v unmarshal(%s) unexpectedly succeeded", tc.e.name, tc.in)
+			}
+		} else if err != nil {
+			t.Errorf("%v unmarshal(%s) failed: %v", tc.e.name, tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("%v unmarshal(%s) = %d; want %d", tc.e.name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestNewEnum_Conflict(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("newEnum didn't panic for conflicting strings")
+		}
+	}()
+	newEnum("result", map[string]result{"Positive": positive, "POSITIVE": negative})
+}
+
+func TestEnum_UnmarshalJSONError(t *testing.T) {
+	// Values should be left unchanged when unmarshaling fails.
+	r := negative
+	if err := json.Unmarshal([]byte(`"Maybe"`), &r); err == nil {
+		t.Error("Unmarshaling invalid result unexpectedly succeeded")
+	} else if r != negative {
+		t.Errorf("Invalid result changed value to %v; want %v", r, negative)
+	}
+	d := secondDose
+	if err := json.Unmarshal([]byte(`"Tercera"`), &d); err == nil {
+		t.Error("Unmarshaling invalid dose unexpectedly succeeded")
+	} else if d != secondDose {
+		t.Errorf("Invalid dose changed value to %v; want %v", d, secondDose)
+	}
+}
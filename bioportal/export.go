@@ -0,0 +1,92 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"time"
+
+	"github.com/derat/covid/obs"
+)
+
+// Metrics used for exported vaccination records. The obs package doesn't define
+// any vaccination metrics, so source-specific ones are used.
+const (
+	firstDosesMetric   obs.Metric = "vaccine-doses:first"
+	secondDosesMetric  obs.Metric = "vaccine-doses:second"
+	boosterDosesMetric obs.Metric = "vaccine-doses:booster"
+)
+
+// records returns daily records describing molecular tests for Puerto Rico.
+// Test and positive counts are grouped by reporting date (matching other sources'
+// daily increases), while positivity is grouped by collection date and omitted for
+// days within positivityDelay of now (see the "positivity.png" plot).
+// The latest reporting date is used as the snapshot.
+func records(colStats, repStats statsMap, now time.Time) []obs.Record {
+	snap := snapshot(repStats)
+	var recs []obs.Record
+	for d, s := range repStats {
+		recs = append(recs,
+			dailyRecord(d, obs.Tests, float64(s.total()), snap),
+			dailyRecord(d, obs.Positives, float64(s.pos), snap))
+	}
+	for d, s := range colStats {
+		if now.Sub(d) >= positivityDelay && s.total() > 0 {
+			recs = append(recs, dailyRecord(d, obs.Positivity, float64(s.pos)/float64(s.total()), snap))
+		}
+	}
+	obs.Sort(recs)
+	return recs
+}
+
+// caseRecords returns daily records describing confirmed cases (by reporting date)
+// and deaths (by date of death) for Puerto Rico. The latest date is used as the snapshot.
+func caseRecords(m caseStatsMap) []obs.Record {
+	snap := snapshot(m)
+	var recs []obs.Record
+	for d, s := range m {
+		recs = append(recs,
+			dailyRecord(d, obs.Cases, float64(s.confirmed), snap),
+			dailyRecord(d, obs.Deaths, float64(s.deaths), snap))
+	}
+	obs.Sort(recs)
+	return recs
+}
+
+// vaccRecords returns daily records describing vaccine doses administered in Puerto Rico.
+// The latest administration date is used as the snapshot.
+func vaccRecords(m vaccStatsMap) []obs.Record {
+	snap := snapshot(m)
+	var recs []obs.Record
+	for d, s := range m {
+		recs = append(recs,
+			dailyRecord(d, firstDosesMetric, float64(s.doses[firstDose]), snap),
+			dailyRecord(d, secondDosesMetric, float64(s.doses[secondDose]), snap),
+			dailyRecord(d, boosterDosesMetric, float64(s.doses[boosterDose]), snap))
+	}
+	obs.Sort(recs)
+	return recs
+}
+
+// snapshot returns the latest date in m, a map with time.Time keys, for use as
+// the snapshot of records derived from it.
+func snapshot(m interface{}) time.Time {
+	days := sortedTimes(m)
+	if len(days) == 0 {
+		return obs.Day(time.Time{})
+	}
+	return obs.Day(days[len(days)-1])
+}
+
+// dailyRecord returns a daily Bioportal record for Puerto Rico.
+func dailyRecord(d time.Time, m obs.Metric, v float64, snap time.Time) obs.Record {
+	return obs.Record{
+		Date:     obs.Day(d),
+		Period:   obs.Daily,
+		Geo:      "PR",
+		Metric:   m,
+		Value:    v,
+		Source:   obs.Bioportal,
+		Snapshot: snap,
+	}
+}
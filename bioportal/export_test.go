@@ -0,0 +1,41 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derat/covid/obs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecords(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, loc) }
+	colStats, repStats := make(statsMap), make(statsMap)
+	colStats.get(day(1)).update(molecular, positive, age20To29, 1)
+	colStats.get(day(1)).update(molecular, negative, age20To29, 2)
+	colStats.get(day(1)).update(molecular, negative, age20To29, 2)
+	colStats.get(day(1)).update(molecular, negative, age20To29, 2)
+	colStats.get(day(20)).update(molecular, positive, age20To29, 1) // too recent
+	repStats.get(day(2)).update(molecular, positive, age20To29, 1)
+	repStats.get(day(3)).update(molecular, negative, age20To29, 2)
+	repStats.get(day(3)).update(serological, positive, age20To29, 2) // not molecular
+
+	utc := func(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, time.UTC) }
+	rec := func(d int, m obs.Metric, v float64) obs.Record {
+		return obs.Record{Date: utc(d), Period: obs.Daily, Geo: "PR", Metric: m,
+			Value: v, Source: obs.Bioportal, Snapshot: utc(3)}
+	}
+	want := []obs.Record{
+		rec(1, obs.Positivity, 0.25),
+		rec(2, obs.Positives, 1),
+		rec(2, obs.Tests, 1),
+		rec(3, obs.Positives, 0),
+		rec(3, obs.Tests, 1),
+	}
+	if diff := cmp.Diff(want, records(colStats, repStats, day(25))); diff != "" {
+		t.Error("Bad records:\n" + diff)
+	}
+}
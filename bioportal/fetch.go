@@ -0,0 +1,275 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/filewriter"
+)
+
+// testsURL returns a JSON array of test objects. It typically hangs for a few minutes
+// before producing a response.
+const testsURL = "https://bioportal.salud.gov.pr/api/administration/reports/minimal-info-unique-tests"
+
+// fetchMain implements the "fetch" subcommand, which downloads a JSON array from the
+// Bioportal API and archives it.
+func fetchMain(args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %v fetch [flags] <out-dir>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	url := fs.String("url", testsURL, "URL returning a JSON array to download")
+	prefix := fs.String("prefix", "tests", `Prefix for archive filenames, e.g. "tests" for "tests-2020-09-01.json.gz"`)
+	timeout := fs.Duration("timeout", 30*time.Minute, "Maximum time for each download attempt")
+	retries := fs.Int("retries", 5, "Number of times to retry failed downloads")
+	backoff := fs.Duration("backoff", 30*time.Second, "Delay before first retry (doubled after each retry)")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f := fetcher{
+		client:  &http.Client{Timeout: *timeout},
+		url:     *url,
+		retries: *retries,
+		backoff: *backoff,
+	}
+	p, n, err := f.archive(fs.Arg(0), *prefix, time.Now().In(loc))
+	if err != nil {
+		log.Fatal("Failed fetching data: ", err)
+	}
+	log.Printf("Wrote %d objects to %v", n, p)
+}
+
+// fetcher downloads data from a URL, retrying and resuming if needed.
+type fetcher struct {
+	client  *http.Client
+	url     string
+	retries int           // number of times to retry after failed attempts
+	backoff time.Duration // delay before first retry; doubled after each retry
+}
+
+// archive downloads f.url to a temp file in dir, checks that it contains a complete JSON
+// array, and then writes it to a gzip-compressed file named e.g. "tests-2020-09-01.json.gz"
+// using the supplied prefix and now's date. The archive's path and the number of objects
+// in the array are returned.
+func (f *fetcher) archive(dir, prefix string, now time.Time) (p string, n int, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	tf, err := ioutil.TempFile(dir, prefix+".partial.")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	if err := f.download(tf); err != nil {
+		return "", 0, err
+	}
+	fi, err := tf.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := tf.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	if n, err = checkJSONArray(tf); err != nil {
+		return "", 0, fmt.Errorf("bad data: %v", err)
+	}
+	if _, err := tf.Seek(0, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+
+	p = filepath.Join(dir, prefix+"-"+now.Format("2006-01-02")+".json.gz")
+	fw := filewriter.NewOptions(p, &filewriter.Options{Compress: true, Sync: true})
+	if nc, err := io.Copy(fw, tf); err != nil || nc != fi.Size() {
+		fw.Discard()
+		if err == nil {
+			err = fmt.Errorf("copied %d of %d byte(s)", nc, fi.Size())
+		}
+		return "", 0, fmt.Errorf("failed archiving data: %v", err)
+	}
+	if err := fw.Close(); err != nil {
+		return "", 0, err
+	}
+	return p, n, nil
+}
+
+// permanentError wraps errors that shouldn't be retried.
+type permanentError struct{ error }
+
+// download downloads f.url to tf, which should be empty. If an attempt fails, the download
+// is retried, requesting only the remaining data if some was already received.
+func (f *fetcher) download(tf *os.File) error {
+	delay := f.backoff
+	for attempt := 0; ; attempt++ {
+		err := f.downloadOnce(tf)
+		if err == nil {
+			return nil
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.error
+		}
+		if attempt >= f.retries {
+			return fmt.Errorf("giving up after %d attempt(s): %v", attempt+1, err)
+		}
+		log.Printf("Download attempt %d failed (retrying in %v): %v", attempt+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// downloadOnce makes a single attempt to download the rest of f.url to tf.
+// Data that was already written to tf is preserved if the server supports range requests.
+// Since the server may cleanly close the connection partway through a response without
+// a length, a response that doesn't end with an array terminator is treated as a
+// retryable failure.
+func (f *fetcher) downloadOnce(tf *os.File) error {
+	fi, err := tf.Stat()
+	if err != nil {
+		return permanentError{err}
+	}
+	have := fi.Size()
+
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+	if have > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", have))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// The server sent the full response, so start over.
+		if have > 0 {
+			log.Printf("Server doesn't support range requests; discarding %d byte(s)", have)
+		}
+		if err := truncate(tf); err != nil {
+			return permanentError{err}
+		}
+	case resp.StatusCode == http.StatusPartialContent && have > 0:
+		if start, err := rangeStart(resp.Header.Get("Content-Range")); err != nil || start != have {
+			// Don't trust unexpected ranges; throw everything away and retry.
+			if err := truncate(tf); err != nil {
+				return permanentError{err}
+			}
+			return fmt.Errorf("got range %q; want start at %d", resp.Header.Get("Content-Range"), have)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
+		resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			if err := truncate(tf); err != nil {
+				return permanentError{err}
+			}
+		}
+		return fmt.Errorf("server returned %v", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("server returned %v", resp.Status)}
+	}
+
+	if _, err := io.Copy(tf, resp.Body); err != nil {
+		return err // keep the partial data so we can resume
+	}
+	if ok, err := endsArray(tf); err != nil {
+		return permanentError{err}
+	} else if !ok {
+		return errors.New("response ended before array terminator")
+	}
+	return nil
+}
+
+// endsArray returns true if f's last non-whitespace byte is a JSON array terminator.
+func endsArray(f *os.File) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	const maxRead = 1024
+	off := fi.Size() - maxRead
+	if off < 0 {
+		off = 0
+	}
+	b := make([]byte, fi.Size()-off)
+	if _, err := f.ReadAt(b, off); err != nil && err != io.EOF {
+		return false, err
+	}
+	b = bytes.TrimRight(b, " \t\r\n")
+	return len(b) > 0 && b[len(b)-1] == ']', nil
+}
+
+// truncate empties f and seeks to its beginning.
+func truncate(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// rangeStart returns the first byte position from a Content-Range header like
+// "bytes 100-199/200".
+func rangeStart(s string) (int64, error) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, fmt.Errorf("bad Content-Range %q", s)
+	}
+	s = s[len("bytes "):]
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		return 0, fmt.Errorf("bad Content-Range %q", s)
+	}
+	return strconv.ParseInt(s[:i], 10, 64)
+}
+
+// checkJSONArray reads a JSON array of objects from r and returns the number of objects.
+// An error is returned if the array is truncated or followed by additional data.
+func checkJSONArray(r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil {
+		return 0, err
+	} else if d, ok := t.(json.Delim); !ok || d != '[' {
+		return 0, fmt.Errorf("got %v instead of array start", t)
+	}
+	var n int
+	for dec.More() {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err != nil {
+			return n, fmt.Errorf("object %d: %v", n, err)
+		}
+		n++
+	}
+	if t, err := dec.Token(); err != nil {
+		return n, fmt.Errorf("array end: %v", err)
+	} else if d, ok := t.(json.Delim); !ok || d != ']' {
+		return n, fmt.Errorf("got %v instead of array end", t)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return n, errors.New("extra data after array")
+	}
+	return n, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fetchStub is an HTTP handler that serves data, optionally failing some requests.
+type fetchStub struct {
+	data      []byte
+	failFirst int  // number of initial requests that return 500
+	truncate  int  // if positive, the first successful request is cut off after this many bytes
+	noRanges  bool // ignore Range headers
+	// if positive, the first successful request is sent without a length and the
+	// connection is cleanly closed after this many bytes
+	closeEarly int
+
+	mu     sync.Mutex
+	ranges []string // Range headers from requests
+}
+
+func (s *fetchStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, req.Header.Get("Range"))
+	n := len(s.ranges)
+	s.mu.Unlock()
+
+	if n <= s.failFirst {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	if s.truncate > 0 && n == s.failFirst+1 {
+		// Claim to send everything but stop partway through.
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.data)))
+		w.Write(s.data[:s.truncate])
+		return
+	}
+	if s.closeEarly > 0 && n == s.failFirst+1 {
+		conn, bw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		defer conn.Close()
+		bw.WriteString("HTTP/1.1 200 OK\r\nConnection: close\r\n\r\n")
+		bw.Write(s.data[:s.closeEarly])
+		bw.Flush()
+		return
+	}
+	if s.noRanges {
+		req.Header.Del("Range")
+	}
+	http.ServeContent(w, req, "tests.json", time.Time{}, bytes.NewReader(s.data))
+}
+
+func TestFetcher_Archive(t *testing.T) {
+	const data = `[{"a":1},{"b":2},{"c":3}]`
+	for _, tc := range []struct {
+		name   string
+		stub   *fetchStub
+		ranges []string // expected Range headers; nil if fetching should fail
+	}{
+		{"simple", &fetchStub{}, []string{""}},
+		{"retry", &fetchStub{failFirst: 2}, []string{"", "", ""}},
+		{"resume", &fetchStub{truncate: 10}, []string{"", "bytes=10-"}},
+		{"close-early", &fetchStub{closeEarly: 10}, []string{"", "bytes=10-"}},
+		{"no-ranges", &fetchStub{truncate: 10, noRanges: true}, []string{"", "bytes=10-"}},
+		{"too-many-failures", &fetchStub{failFirst: 4}, nil},
+		{"incomplete", &fetchStub{data: []byte(`[{"a":1},{"b":2}`)}, nil},
+		{"extra-data", &fetchStub{data: []byte(`[{"a":1}] []`)}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "fetch_test.")
+			if err != nil {
+				t.Fatal("Failed creating temp dir: ", err)
+			}
+			defer os.RemoveAll(dir)
+
+			if tc.stub.data == nil {
+				tc.stub.data = []byte(data)
+			}
+			srv := httptest.NewServer(tc.stub)
+			defer srv.Close()
+
+			f := fetcher{client: srv.Client(), url: srv.URL, retries: 3, backoff: time.Millisecond}
+			now := time.Date(2020, 9, 1, 12, 0, 0, 0, loc)
+			p, n, err := f.archive(dir, "tests", now)
+			if tc.ranges == nil {
+				if err == nil {
+					t.Error("archive unexpectedly succeeded")
+				}
+				if fis, err := ioutil.ReadDir(dir); err != nil {
+					t.Error("Failed reading dir: ", err)
+				} else if len(fis) != 0 {
+					t.Errorf("Dir contains %d file(s) after failure", len(fis))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("archive failed: ", err)
+			}
+
+			if want := filepath.Join(dir, "tests-2020-09-01.json.gz"); p != want {
+				t.Errorf("archive wrote %v; want %v", p, want)
+			}
+			if n != 3 {
+				t.Errorf("archive returned %d objects; want 3", n)
+			}
+			if diff := cmp.Diff(tc.ranges, tc.stub.ranges); diff != "" {
+				t.Error("Bad Range headers:\n" + diff)
+			}
+
+			af, err := os.Open(p)
+			if err != nil {
+				t.Fatal("Failed opening archive: ", err)
+			}
+			defer af.Close()
+			zr, err := gzip.NewReader(af)
+			if err != nil {
+				t.Fatal("Failed reading archive: ", err)
+			}
+			if b, err := ioutil.ReadAll(zr); err != nil {
+				t.Error("Failed reading archive: ", err)
+			} else if string(b) != data {
+				t.Errorf("Archive contains %q; want %q", b, data)
+			}
+			if fis, err := ioutil.ReadDir(dir); err != nil {
+				t.Error("Failed reading dir: ", err)
+			} else if len(fis) != 1 {
+				t.Errorf("Dir contains %d files; want just the archive", len(fis))
+			}
+		})
+	}
+}
+
+func TestFetcher_PermanentError(t *testing.T) {
+	var reqs int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reqs++
+		http.NotFound(w, req)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "fetch_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := fetcher{client: srv.Client(), url: srv.URL, retries: 3, backoff: time.Millisecond}
+	if _, _, err := f.archive(dir, "tests", time.Now()); err == nil {
+		t.Error("archive unexpectedly succeeded")
+	}
+	if reqs != 1 {
+		t.Errorf("Server got %d requests; want 1", reqs)
+	}
+}
+
+func TestRangeStart(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int64 // -1 if error expected
+	}{
+		{"bytes 100-199/200", 100},
+		{"bytes 0-9/*", 0},
+		{"bytes */200", -1},
+		{"100-199/200", -1},
+	} {
+		got, err := rangeStart(tc.in)
+		if tc.want < 0 {
+			if err == nil {
+				t.Errorf("rangeStart(%q) unexpectedly succeeded", tc.in)
+			}
+		} else if err != nil {
+			t.Errorf("rangeStart(%q) failed: %v", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("rangeStart(%q) = %d; want %d", tc.in, got, tc.want)
+		}
+	}
+}
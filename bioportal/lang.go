@@ -0,0 +1,123 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// language contains translated messages and date formats used in plots.
+type language struct {
+	msgs       map[string]string // English messages and format strings to translations
+	ticFormat  string            // gnuplot format for date tics
+	weekLayout string            // time layout for week labels in heatmaps
+	dayLayout  string            // time layout for dates in footers
+}
+
+// defaultLang is the name of the language used if none is specified.
+const defaultLang = "en"
+
+// languages contains supported languages keyed by ISO 639-1 code.
+var languages = map[string]*language{
+	"en": {
+		ticFormat:  "%m/%d",
+		weekLayout: "01/02",
+		dayLayout:  "2006-01-02",
+	},
+	"es": {
+		ticFormat:  "%d/%m",
+		weekLayout: "02/01",
+		dayLayout:  "02/01/2006",
+		msgs: map[string]string{
+			// Titles.
+			"Puerto Rico Bioportal %s by age":                                  "Bioportal de Puerto Rico: %s por edad",
+			"Puerto Rico Bioportal COVID-19 daily reported tests":              "Bioportal de Puerto Rico: pruebas de COVID-19 informadas por día",
+			"Puerto Rico Bioportal COVID-19 test positivity rate":              "Bioportal de Puerto Rico: tasa de positividad de pruebas de COVID-19",
+			"Puerto Rico Bioportal COVID-19 %s test result delays":             "Bioportal de Puerto Rico: demora en resultados de pruebas de COVID-19 (%s)",
+			"Puerto Rico Bioportal COVID-19 positive test distribution by age": "Bioportal de Puerto Rico: distribución por edad de pruebas positivas de COVID-19",
+			"Puerto Rico Bioportal COVID-19 daily reported cases":              "Bioportal de Puerto Rico: casos de COVID-19 informados por día",
+			"Puerto Rico Bioportal COVID-19 daily deaths":                      "Bioportal de Puerto Rico: muertes por COVID-19 por día",
+			"Puerto Rico Bioportal COVID-19 daily vaccine doses":               "Bioportal de Puerto Rico: dosis de vacuna contra el COVID-19 por día",
+			"Puerto Rico Bioportal COVID-19 vaccination progress":              "Bioportal de Puerto Rico: progreso de la vacunación contra el COVID-19",
+
+			// Units and test types used in titles.
+			"positive COVID-19 tests":                                   "pruebas positivas de COVID-19",
+			"positive COVID-19 tests per 100,000 people":                "pruebas positivas de COVID-19 por cada 100,000 personas",
+			"COVID-19 test positivity rate":                             "tasa de positividad de pruebas de COVID-19",
+			"total COVID-19 tests per 100,000 people":                   "total de pruebas de COVID-19 por cada 100,000 personas",
+			"COVID-19 cases per 100,000 people":                         "casos de COVID-19 por cada 100,000 personas",
+			"COVID-19 deaths":                                           "muertes por COVID-19",
+			"percent of people with at least one COVID-19 vaccine dose": "porcentaje de personas con al menos una dosis de vacuna contra el COVID-19",
+			"percent of people with two COVID-19 vaccine doses":         "porcentaje de personas con dos dosis de vacuna contra el COVID-19",
+			"total":    "todas",
+			"positive": "positivas",
+			"negative": "negativas",
+
+			// Axis labels.
+			"Reporting week":                            "Semana de informe",
+			"Sample collection week":                    "Semana de toma de muestra",
+			"Age":                                       "Edad",
+			"Reporting date":                            "Fecha de informe",
+			"Reported results (7-day average)":          "Resultados informados (promedio de 7 días)",
+			"Sample collection date":                    "Fecha de toma de muestra",
+			"Percent positive (7-day average)":          "Porcentaje positivo (promedio de 7 días)",
+			"Result delay (days)":                       "Demora del resultado (días)",
+			"Fraction of all positives (7-day average)": "Fracción de todos los positivos (promedio de 7 días)",
+			"Week of death":                             "Semana de muerte",
+			"New cases (7-day average)":                 "Casos nuevos (promedio de 7 días)",
+			"Date of death":                             "Fecha de muerte",
+			"Deaths (7-day average)":                    "Muertes (promedio de 7 días)",
+			"Administration week":                       "Semana de administración",
+			"Administration date":                       "Fecha de administración",
+			"Doses administered (7-day average)":        "Dosis administradas (promedio de 7 días)",
+			"Percent of population":                     "Porcentaje de la población",
+
+			// Legends.
+			"Unknown":     "Desconocida",
+			"Serological": "Serológica",
+			"Antigen":     "Antígeno",
+			"Molecular":   "Molecular",
+			"10th-90th":   "Percentil 10-90",
+			"25th-75th":   "Percentil 25-75",
+			"Median":      "Mediana",
+
+			"Confirmed":         "Confirmados",
+			"Probable":          "Probables",
+			"Hospitalized":      "Hospitalizados",
+			"ICU":               "Cuidado intensivo",
+			"First dose":        "Primera dosis",
+			"Second dose":       "Segunda dosis",
+			"Booster":           "Refuerzo",
+			"At least one dose": "Al menos una dosis",
+			"Two doses":         "Dos dosis",
+
+			// Footer.
+			"Generated on %s by https://github.com/derat/covid": "Generado el %s por https://github.com/derat/covid",
+		},
+	},
+}
+
+// langNames returns the codes of all supported languages in ascending order.
+func langNames() []string {
+	var names []string
+	for n := range languages {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tr returns the translation of msg, or msg itself if it hasn't been translated.
+func (l *language) tr(msg string) string {
+	if t, ok := l.msgs[msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// trf translates format and then formats args using it.
+func (l *language) trf(format string, args ...interface{}) string {
+	return fmt.Sprintf(l.tr(format), args...)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// plotText returns the user-visible text in p.
+func plotText(p *gnuplot.Plot) []string {
+	text := []string{p.Title, p.X.Label, p.Y.Label, p.X.Format}
+	for _, s := range p.Series {
+		text = append(text, s.Title)
+	}
+	return text
+}
+
+func TestLanguages_Translated(t *testing.T) {
+	theme, err := gnuplot.LookupTheme(gnuplot.DefaultTheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plots := func(lang *language) map[string]*gnuplot.Plot {
+		return map[string]*gnuplot.Plot{
+			"ageHeat":       ageHeatPlot(theme, lang, "positive COVID-19 tests", "Reporting week"),
+			"ageHeatCol":    ageHeatPlot(theme, lang, "COVID-19 test positivity rate", "Sample collection week"),
+			"types":         typesPlot(theme, lang),
+			"posRate":       posRatePlot(theme, lang),
+			"delays":        delaysPlot(theme, lang, "negative", 10),
+			"ageDist":       ageDistPlot(theme, lang),
+			"cases":         casesPlot(theme, lang),
+			"casesAge":      ageHeatPlot(theme, lang, "COVID-19 cases per 100,000 people", "Reporting week"),
+			"deaths":        deathsPlot(theme, lang),
+			"deathsAge":     ageHeatPlot(theme, lang, "COVID-19 deaths", "Week of death"),
+			"vaccinations":  vaccinationsPlot(theme, lang),
+			"vaccinated":    vaccinatedPlot(theme, lang),
+			"vaccinatedAge": ageHeatPlot(theme, lang, "percent of people with at least one COVID-19 vaccine dose", "Administration week"),
+			"fullyVaccAge":  ageHeatPlot(theme, lang, "percent of people with two COVID-19 vaccine doses", "Administration week"),
+		}
+	}
+
+	en := plots(languages["en"])
+	for code, lang := range languages {
+		if code == "en" {
+			continue
+		}
+		// Text that's the same in English and this language.
+		same := make(map[string]bool)
+		for k, v := range lang.msgs {
+			if k == v {
+				same[k] = true
+			}
+		}
+		for name, p := range plots(lang) {
+			want, got := plotText(en[name]), plotText(p)
+			for i := range want {
+				if want[i] != "" && got[i] == want[i] && !same[want[i]] {
+					t.Errorf("%v plot has untranslated %v text %q", name, code, got[i])
+				}
+			}
+		}
+	}
+}
+
+func TestLanguage_Tr(t *testing.T) {
+	es := languages["es"]
+	if got, want := es.trf("Puerto Rico Bioportal %s by age", es.tr("positive COVID-19 tests")),
+		"Bioportal de Puerto Rico: pruebas positivas de COVID-19 por edad"; got != want {
+		t.Errorf("trf() = %q; want %q", got, want)
+	}
+	if got, want := es.tr("Not in catalog"), "Not in catalog"; got != want {
+		t.Errorf("tr() = %q; want %q", got, want)
+	}
+}
@@ -4,7 +4,8 @@
 package main
 
 import (
-	"compress/gzip"
+	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -12,13 +13,17 @@ import (
 	"log"
 	"math"
 	"os"
-	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/derat/covid/filewriter"
 	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/input"
+	"github.com/derat/covid/obs"
 )
 
 const (
@@ -51,267 +56,136 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fetch" {
+		fetchMain(os.Args[2:])
+		return
+	}
+
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v <input> [out-dir]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] <input> [out-dir]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %v fetch [flags] <out-dir>\n", os.Args[0])
 		flag.PrintDefaults()
 	}
+	jobs := flag.Int("jobs", runtime.NumCPU(), "Number of plots to render concurrently")
+	plotTimeout := flag.Duration("plot-timeout", 2*time.Minute, "Maximum time to spend rendering each plot")
+	keepScripts := flag.Bool("keep-scripts", false, "Keep self-contained gnuplot scripts next to plots for debugging")
+	exportPath := flag.String("export", "", "File to which daily records will be written as CSV (see obs package)")
+	formatName := flag.String("format", string(gnuplot.PNG), `Plot format ("png", "svg", "pdf", "html")`)
+	themeName := flag.String("theme", gnuplot.DefaultTheme,
+		fmt.Sprintf("Plot theme (%s)", strings.Join(gnuplot.ThemeNames(), ", ")))
+	reportName := flag.String("report", defaultReport,
+		fmt.Sprintf("Bioportal report that <input> was downloaded from (%s)", strings.Join(reportNames(), ", ")))
+	langName := flag.String("lang", defaultLang,
+		fmt.Sprintf("Language for plot text (%s)", strings.Join(langNames(), ", ")))
 	flag.Parse()
 
 	if ln := len(flag.Args()); ln == 0 || ln > 2 {
 		flag.Usage()
 		os.Exit(2)
 	}
+	format, err := gnuplot.ParseFormat(*formatName)
+	if err != nil {
+		log.Fatal("Bad -format: ", err)
+	}
+	theme, err := gnuplot.LookupTheme(*themeName)
+	if err != nil {
+		log.Fatal("Bad -theme: ", err)
+	}
+	lang, ok := languages[*langName]
+	if !ok {
+		log.Fatalf("Bad -lang %q", *langName)
+	}
+	read, ok := reports[*reportName]
+	if !ok {
+		log.Fatalf("Bad -report %q", *reportName)
+	}
 
-	fn := flag.Arg(0)
-	f, err := os.Open(fn)
+	r, err := input.Open(flag.Arg(0))
 	if err != nil {
 		log.Fatal("Failed opening input: ", err)
 	}
-	defer f.Close()
+	defer r.Close()
 
-	var r io.Reader = f
-	if filepath.Ext(fn) == ".gz" {
-		gr, err := gzip.NewReader(f)
-		if err != nil {
-			log.Fatal("Failed decompressing input: ", err)
-		}
-		defer gr.Close()
-		r = gr
+	rep, err := read(r)
+	if err != nil {
+		log.Fatalf("Failed reading %v: %v", *reportName, err)
 	}
 
-	colStats, repStats, err := readTests(r)
-	if err != nil {
-		log.Fatal("Failed reading tests: ", err)
+	if *exportPath != "" {
+		fw := filewriter.New(*exportPath)
+		werr := obs.WriteCSV(fw, rep.records(time.Now()))
+		if err := fw.Close(); err != nil {
+			log.Fatalf("Failed writing %v: %v", *exportPath, err)
+		} else if werr != nil {
+			log.Fatalf("Failed writing %v: %v", *exportPath, werr)
+		}
 	}
 
 	// If an output dir wasn't supplied, just print a summary.
 	if len(flag.Args()) < 2 {
-		for _, d := range sortedTimes(repStats) {
-			fmt.Printf("%s: %s\n", d.Format("2006-01-02"), repStats[d])
-		}
+		rep.summarize(os.Stdout)
 		return
 	}
 
-	outDir := flag.Arg(1)
-	if err := os.MkdirAll(outDir, 0755); err != nil {
-		log.Fatal("Failed creating output dir: ", err)
-	}
-
-	avgColStats := averageStats(colStats, 7)
-	avgRepStats := averageStats(repStats, 7)
-	weekColStats := weeklyStats(colStats)
-	weekRepStats := weeklyStats(repStats)
-
-	// Find the max 90th-percentile delay so we can use the same scale on delay plots.
-	maxDelay := 0
-	for _, s := range weekRepStats {
-		if v := s.delayPct(90); v > maxDelay {
-			maxDelay = v
-		}
-		if v := s.posDelayPct(90); v > maxDelay {
-			maxDelay = v
-		}
-		if v := s.negDelayPct(90); v > maxDelay {
-			maxDelay = v
-		}
-	}
-
-	// Returns a plot function that writes delay distribution data supplied by f.
-	makeDelayDataFunc := func(f func(s *stats, pct float64) int) func(w *filewriter.FileWriter) {
-		return func(w *filewriter.FileWriter) {
-			w.Printf("Date\t10th\t25th\t50th\t75th\t90th\n")
-			for _, week := range sortedTimes(weekRepStats) {
-				s := weekRepStats[week]
-				w.Printf("%s\t%d\t%d\t%d\t%d\t%d\n", week.Format("2006-01-02"),
-					f(s, 10), f(s, 25), f(s, 50), f(s, 75), f(s, 90))
-			}
-		}
+	// Stage the plots so that the output dir is updated all at once.
+	tx, err := filewriter.Begin(flag.Arg(1))
+	if err != nil {
+		log.Fatal("Failed starting output dir transaction: ", err)
 	}
 
-	// Returns a plot function that writes age-stratified heatmap data supplied by f.
-	makeAgeFunc := func(m statsMap, f func(s *stats, ar ageRange) interface{},
-		maxAge ageRange, maxDate time.Time) func(w *filewriter.FileWriter) {
-		return func(w *filewriter.FileWriter) {
-			w.Printf("X\tDate\tAge\tValue\n")
-			for i, week := range sortedTimes(m) {
-				if !maxDate.IsZero() && week.AddDate(0, 0, 7).After(maxDate) {
-					break
-				}
-				s := m[week]
-				for ar := age0To9; ar <= maxAge; ar++ {
-					w.Printf("%d\t%s\t%d\t%v\n", i, week.Format("01/02"), ar.min(), f(s, ar))
-				}
+	now := time.Now()
+	plots := rep.plots(theme, lang, now)
+
+	// Render the plots concurrently, passing each plot's data inline.
+	sess := gnuplot.NewSession(*jobs)
+	errs := make([]error, len(plots))
+	var wg sync.WaitGroup
+	for i, plot := range plots {
+		var b bytes.Buffer
+		plot.data(&b)
+		ip := tx.Path(plot.out + format.Ext())
+		setOutput(plot.plot, ip, format, theme, lang, now)
+		script := []byte(plot.plot.Script())
+		opts := gnuplot.KeepOptions(ip, *keepScripts)
+		opts.Data = b.Bytes()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), *plotTimeout)
+			defer cancel()
+			errs[i] = sess.Run(ctx, script, opts)
+		}(i)
+	}
+	wg.Wait()
+	if err := sess.Close(); err != nil {
+		log.Print("Failed closing gnuplot session: ", err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			if *keepScripts {
+				log.Print("Keeping staged plots and scripts in ", tx.Path(""))
+			} else {
+				tx.Rollback()
 			}
+			log.Fatalf("Failed plotting %v: %v", plots[i].out+format.Ext(), err)
 		}
 	}
-
-	now := time.Now()
-
-	for _, plot := range []struct {
-		out  string                         // output file, e.g. "my-plot.png"
-		tmpl string                         // gnuplot template data
-		data func(w *filewriter.FileWriter) // writes gnuplot data to w
-		vars map[string]interface{}         // extra variables to pass to template
-	}{
-		{
-			out:  "positives-age.png",
-			tmpl: ageHeatTmpl,
-			data: makeAgeFunc(weekRepStats, func(s *stats, ar ageRange) interface{} { return s.agePos[ar] },
-				age100To109, time.Time{}),
-			vars: map[string]interface{}{"Units": "positive COVID-19 tests"},
-		},
-		{
-			out:  "positives-age-scaled.png",
-			tmpl: ageHeatTmpl,
-			data: makeAgeFunc(weekRepStats, func(s *stats, ar ageRange) interface{} {
-				pop := unAgePop[ar]
-				if pop == 0 {
-					return 0
-				}
-				return int64(math.Round(100000 * float64(s.agePos[ar]) / float64(pop)))
-			}, age80To89, time.Time{}),
-			vars: map[string]interface{}{"Units": "positive COVID-19 tests per 100,000 people"},
-		},
-		{
-			out:  "positivity-age.png",
-			tmpl: ageHeatTmpl,
-			data: makeAgeFunc(weekColStats, func(s *stats, ar ageRange) interface{} {
-				pos := float64(s.agePos[ar])
-				total := pos + float64(s.ageNeg[ar])
-				if total < positivityMinTests {
-					return 0
-				}
-				return math.Min(pos/total, positivityMaxRate)
-			}, age100To109, now.Add(-positivityDelay)),
-			vars: map[string]interface{}{"Units": "COVID-19 test positivity rate", "Collect": true},
-		},
-		{
-			out:  "results-age-scaled.png",
-			tmpl: ageHeatTmpl,
-			data: makeAgeFunc(weekRepStats, func(s *stats, ar ageRange) interface{} {
-				pop := unAgePop[ar]
-				if pop == 0 {
-					return 0
-				}
-				return int64(math.Round(100000 * float64(s.agePos[ar]+s.ageNeg[ar]) / float64(pop)))
-			}, age80To89, time.Time{}),
-			vars: map[string]interface{}{"Units": "total COVID-19 tests per 100,000 people"},
-		},
-		{
-			out:  "test-types.png",
-			tmpl: typesTmpl,
-			data: func(w *filewriter.FileWriter) {
-				w.Printf("Date\tMolecular\tSerological\tAntigen\tUnknown\n")
-				for _, d := range sortedTimes(avgRepStats) {
-					s := avgRepStats[d]
-					w.Printf("%s\t%d\t%d\t%d\t%d\n", d.Format("2006-01-02"), s.total(), s.ab, s.ag, s.unk)
-				}
-			},
-		},
-		{
-			out:  "positivity.png",
-			tmpl: posRateTmpl,
-			data: func(w *filewriter.FileWriter) {
-				w.Printf("Date\tPositivity\n")
-				for _, d := range sortedTimes(avgColStats) {
-					if now.Sub(d) < positivityDelay {
-						break
-					}
-					s := avgColStats[d]
-					posPct := 100 * float64(s.pos) / float64(s.pos+s.neg)
-					w.Printf("%s\t%0.1f\n", d.Format("2006-01-02"), posPct)
-				}
-			},
-		},
-		{
-			out:  "result-delays.png",
-			tmpl: delaysTmpl,
-			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.delayPct(pct) }),
-			vars: map[string]interface{}{"TestType": "total", "MaxDelay": maxDelay},
-		},
-		{
-			out:  "positive-result-delays.png",
-			tmpl: delaysTmpl,
-			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.posDelayPct(pct) }),
-			vars: map[string]interface{}{"TestType": "positive", "MaxDelay": maxDelay},
-		},
-		{
-			out:  "negative-result-delays.png",
-			tmpl: delaysTmpl,
-			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.negDelayPct(pct) }),
-			vars: map[string]interface{}{"TestType": "negative", "MaxDelay": maxDelay},
-		},
-		{
-			out:  "age-dist.png",
-			tmpl: ageDistTmpl,
-			data: func(w *filewriter.FileWriter) {
-				ars := []ageRange{age0To9, age10To19, age20To29, age30To39, age40To49, age50To59, age60To69, age70To79, age80To89, age90To99}
-				w.Printf("Date")
-				for _, ar := range ars {
-					w.Printf("\t%d-%d", ar.min(), ar.max())
-				}
-				w.Printf("\n")
-
-				started := false
-				for _, d := range sortedTimes(avgColStats) {
-					s := avgColStats[d]
-
-					if !started {
-						if s.pos < ageDistMinPosTests {
-							continue
-						}
-						started = true
-					}
-
-					w.Printf(d.Format("2006-01-02"))
-					var total, cumul int
-					for _, ar := range ars {
-						total += s.agePos[ar]
-					}
-					for _, ar := range ars {
-						cumul += s.agePos[ar]
-						w.Printf("\t%0.2f", float64(cumul)/float64(total))
-					}
-					w.Printf("\n")
-				}
-			},
-		},
-	} {
-		dp := filepath.Join("/tmp", "bioportal."+plot.out+".dat")
-		dw := filewriter.New(dp)
-		plot.data(dw)
-		if err := dw.Close(); err != nil {
-			log.Fatalf("Failed writing data for %v: %v", plot.out, err)
-		}
-		td := templateData(dp, filepath.Join(outDir, plot.out), now, plot.vars)
-		if err := gnuplot.ExecTemplate(plot.tmpl, td); err != nil {
-			log.Fatalf("Failed plotting %v: %v", plot.out, err)
-		}
-		os.Remove(dp)
+	if err := tx.Commit(); err != nil {
+		log.Fatal("Failed publishing plots: ", err)
 	}
 }
 
 // readTests reads a JSON array of test objects from r and returns daily stats
 // aggregated by collection date and by reporting date.
 func readTests(r io.Reader) (colStats, repStats statsMap, err error) {
-	// Instead of unmarshaling all tests into slice all at once, strip off the
-	// opening bracket so we can read them one at a time. See the "Stream"
-	// example at https://golang.org/pkg/encoding/json/#Decoder.Decode.
-	dec := json.NewDecoder(r)
-	if t, err := dec.Token(); err != nil {
-		return nil, nil, fmt.Errorf("failed reading opening bracket: %v", err)
-	} else if d, ok := t.(json.Delim); !ok || d != '[' {
-		return nil, nil, fmt.Errorf("data starts with %v instead of opening bracket", t)
-	}
-
 	now := time.Now()
 	colStats = make(statsMap)
 	repStats = make(statsMap)
 
-	for dec.More() {
+	if err := readArray(r, func(dec *json.Decoder) error {
 		var t test
 		if err := dec.Decode(&t); err != nil {
-			return nil, nil, fmt.Errorf("failed reading test: %v", err)
+			return fmt.Errorf("failed reading test: %v", err)
 		}
 
 		col := time.Time(t.Collected)
@@ -330,14 +204,37 @@ func readTests(r io.Reader) (colStats, repStats statsMap, err error) {
 		if repValid {
 			repStats.get(rep).update(t.Type, t.Result, t.AgeRange, delay)
 		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return colStats, repStats, nil
+}
+
+// readArray reads a JSON array from r, calling f to decode each of its elements.
+func readArray(r io.Reader, f func(dec *json.Decoder) error) error {
+	// Instead of unmarshaling all elements into slice all at once, strip off the
+	// opening bracket so we can read them one at a time. See the "Stream"
+	// example at https://golang.org/pkg/encoding/json/#Decoder.Decode.
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed reading opening bracket: %v", err)
+	} else if d, ok := t.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("data starts with %v instead of opening bracket", t)
+	}
+
+	for dec.More() {
+		if err := f(dec); err != nil {
+			return err
+		}
 	}
 
 	if t, err := dec.Token(); err != nil {
-		return nil, nil, fmt.Errorf("failed reading closing bracket: %v", err)
+		return fmt.Errorf("failed reading closing bracket: %v", err)
 	} else if d, ok := t.(json.Delim); !ok || d != ']' {
-		return nil, nil, fmt.Errorf("data ends with %v instead of closing bracket", t)
+		return fmt.Errorf("data ends with %v instead of closing bracket", t)
 	}
-	return colStats, repStats, nil
+	return nil
 }
 
 // sortedTimes returns sorted keys from m, which must be a map with time.Time keys.
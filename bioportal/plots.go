@@ -0,0 +1,202 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// setOutput configures p to write an image in the supplied format and theme to imgPath,
+// with a footer in lang describing when it was generated.
+func setOutput(p *gnuplot.Plot, imgPath string, format gnuplot.Format, theme *gnuplot.Theme,
+	lang *language, now time.Time) {
+	p.Term = theme.FormatTerm(format)
+	p.Output = imgPath
+	p.Theme = theme
+	p.Footer = lang.trf("Generated on %s by https://github.com/derat/covid", now.Format(lang.dayLayout))
+	p.Extra = append(p.Extra, "set encoding utf8")
+}
+
+// dateAxis returns a time-based X axis with the supplied label translated into lang.
+func dateAxis(lang *language, label string) gnuplot.Axis {
+	return gnuplot.Axis{Type: gnuplot.Time, Label: lang.tr(label), Format: lang.ticFormat}
+}
+
+// ageHeatPlot returns a heatmap plot of weekly values by age. The data should contain
+// sequential week numbers, week labels, age range minimums, and values. units and xlabel
+// are translated into lang.
+func ageHeatPlot(theme *gnuplot.Theme, lang *language, units, xlabel string) *gnuplot.Plot {
+	return &gnuplot.Plot{
+		Title:   lang.trf("Puerto Rico Bioportal %s by age", lang.tr(units)),
+		Prescan: true,
+		Size:    "ratio 0.4",
+		Font:    ", 20",
+		X: gnuplot.Axis{
+			Label:        lang.tr(xlabel),
+			LabelOptions: "offset 0,-1.5",
+			Min:          "GPVAL_DATA_X_MIN-0.5",
+			Max:          "GPVAL_DATA_X_MAX+0.5",
+			Tics:         "scale 0 rotate by 90 right",
+		},
+		Y: gnuplot.Axis{
+			Label: lang.tr("Age"),
+			Min:   "GPVAL_DATA_Y_MIN-5",
+			Max:   "GPVAL_DATA_Y_MAX+5",
+			Tics:  "scale 0 offset 0,-0.5",
+		},
+		Palette: theme.Sequential,
+		Margins: gnuplot.Margins{Left: "at screen 0.12", Right: "at screen 0.85"},
+		Series:  []gnuplot.Series{{Using: "1:3:4:xtic(2)", Style: gnuplot.Image}},
+	}
+}
+
+// typesPlot returns a plot of daily reported results by test type. The data should contain
+// dates and molecular, serological, antigen, and unknown counts.
+func typesPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	line := func(col, color int, title string) gnuplot.Series {
+		return gnuplot.Series{Using: "1:" + strconv.Itoa(col), Style: gnuplot.Lines,
+			Color: theme.Color(color), Width: 2, Title: lang.tr(title)}
+	}
+	return &gnuplot.Plot{
+		Title: lang.tr("Puerto Rico Bioportal COVID-19 daily reported tests"),
+		X:     dateAxis(lang, "Reporting date"),
+		Y:     gnuplot.Axis{Label: lang.tr("Reported results (7-day average)"), Min: "0"},
+		Grid:  true,
+		Key:   gnuplot.Key{Options: "top left invert"},
+		Series: []gnuplot.Series{
+			line(5, 2, "Unknown"),
+			line(3, 3, "Serological"),
+			line(4, 1, "Antigen"),
+			line(2, 0, "Molecular"),
+		},
+	}
+}
+
+// posRatePlot returns a plot of the daily positivity rate. The data should contain
+// dates and percentages.
+func posRatePlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	return &gnuplot.Plot{
+		Title:  lang.tr("Puerto Rico Bioportal COVID-19 test positivity rate"),
+		X:      dateAxis(lang, "Sample collection date"),
+		Y:      gnuplot.Axis{Label: lang.tr("Percent positive (7-day average)"), Min: "0"},
+		Grid:   true,
+		Key:    gnuplot.Key{Hide: true},
+		Series: []gnuplot.Series{{Using: "1:2", Style: gnuplot.Lines, Color: theme.Foreground, Width: 2}},
+	}
+}
+
+// delaysPlot returns a plot of weekly result delays for testType tests. The data should
+// contain dates and 10th, 25th, 50th, 75th, and 90th percentile delays.
+func delaysPlot(theme *gnuplot.Theme, lang *language, testType string, maxDelay int) *gnuplot.Plot {
+	return &gnuplot.Plot{
+		Title: lang.trf("Puerto Rico Bioportal COVID-19 %s test result delays", lang.tr(testType)),
+		X:     dateAxis(lang, "Reporting week"),
+		Y:     gnuplot.Axis{Label: lang.tr("Result delay (days)"), Min: "0", Max: strconv.Itoa(maxDelay)},
+		Grid:  true,
+		Key:   gnuplot.Key{Options: "top left"},
+		Series: []gnuplot.Series{
+			{Using: "1:2:6", Style: gnuplot.FilledCurves, Color: theme.Shades[0], Title: lang.tr("10th-90th")},
+			{Using: "1:3:5", Style: gnuplot.FilledCurves, Color: theme.Shades[1], Title: lang.tr("25th-75th")},
+			{Using: "1:4", Style: gnuplot.Lines, Color: theme.Foreground, Width: 2, Title: lang.tr("Median")},
+		},
+	}
+}
+
+// ageDistPlot returns a stacked plot of the distribution of positive tests by age.
+// The data should contain a header row followed by dates and cumulative fractions
+// for each of ten age ranges.
+func ageDistPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	p := &gnuplot.Plot{
+		Title:  lang.tr("Puerto Rico Bioportal COVID-19 positive test distribution by age"),
+		X:      dateAxis(lang, "Sample collection date"),
+		Y:      gnuplot.Axis{Label: lang.tr("Fraction of all positives (7-day average)"), Min: "0"},
+		Grid:   true,
+		Key:    gnuplot.Key{Options: "outside"},
+		Colors: theme.Scale(10),
+		Series: []gnuplot.Series{{
+			For:         "[i=11:2:-1]",
+			Using:       "1:i",
+			Style:       gnuplot.FilledCurves,
+			Options:     "x1 linestyle i-1",
+			ColumnTitle: true,
+		}},
+	}
+	p.X.Fix = true
+	return p
+}
+
+// casesPlot returns a plot of daily new cases. The data should contain dates and
+// confirmed, probable, hospitalized, and ICU counts.
+func casesPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	line := func(col, color int, title string) gnuplot.Series {
+		return gnuplot.Series{Using: "1:" + strconv.Itoa(col), Style: gnuplot.Lines,
+			Color: theme.Color(color), Width: 2, Title: lang.tr(title)}
+	}
+	return &gnuplot.Plot{
+		Title: lang.tr("Puerto Rico Bioportal COVID-19 daily reported cases"),
+		X:     dateAxis(lang, "Reporting date"),
+		Y:     gnuplot.Axis{Label: lang.tr("New cases (7-day average)"), Min: "0"},
+		Grid:  true,
+		Key:   gnuplot.Key{Options: "top left"},
+		Series: []gnuplot.Series{
+			line(2, 0, "Confirmed"),
+			line(3, 1, "Probable"),
+			line(4, 2, "Hospitalized"),
+			line(5, 3, "ICU"),
+		},
+	}
+}
+
+// deathsPlot returns a plot of daily deaths. The data should contain dates and counts.
+func deathsPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	return &gnuplot.Plot{
+		Title:  lang.tr("Puerto Rico Bioportal COVID-19 daily deaths"),
+		X:      dateAxis(lang, "Date of death"),
+		Y:      gnuplot.Axis{Label: lang.tr("Deaths (7-day average)"), Min: "0"},
+		Grid:   true,
+		Key:    gnuplot.Key{Hide: true},
+		Series: []gnuplot.Series{{Using: "1:2", Style: gnuplot.Lines, Color: theme.Foreground, Width: 2}},
+	}
+}
+
+// vaccinationsPlot returns a plot of daily vaccine doses. The data should contain dates
+// and first, second, and booster dose counts.
+func vaccinationsPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	line := func(col, color int, title string) gnuplot.Series {
+		return gnuplot.Series{Using: "1:" + strconv.Itoa(col), Style: gnuplot.Lines,
+			Color: theme.Color(color), Width: 2, Title: lang.tr(title)}
+	}
+	return &gnuplot.Plot{
+		Title: lang.tr("Puerto Rico Bioportal COVID-19 daily vaccine doses"),
+		X:     dateAxis(lang, "Administration date"),
+		Y:     gnuplot.Axis{Label: lang.tr("Doses administered (7-day average)"), Min: "0"},
+		Grid:  true,
+		Key:   gnuplot.Key{Options: "top left"},
+		Series: []gnuplot.Series{
+			line(2, 0, "First dose"),
+			line(3, 1, "Second dose"),
+			line(4, 2, "Booster"),
+		},
+	}
+}
+
+// vaccinatedPlot returns a plot of the percentage of the population that has been
+// vaccinated. The data should contain dates and percentages of people who have received
+// at least one dose and who have received two doses.
+func vaccinatedPlot(theme *gnuplot.Theme, lang *language) *gnuplot.Plot {
+	return &gnuplot.Plot{
+		Title: lang.tr("Puerto Rico Bioportal COVID-19 vaccination progress"),
+		X:     dateAxis(lang, "Administration date"),
+		Y:     gnuplot.Axis{Label: lang.tr("Percent of population"), Min: "0"},
+		Grid:  true,
+		Key:   gnuplot.Key{Options: "top left"},
+		Series: []gnuplot.Series{
+			{Using: "1:2", Style: gnuplot.FilledCurves, Options: "x1", Color: theme.Shades[0], Title: lang.tr("At least one dose")},
+			{Using: "1:3", Style: gnuplot.FilledCurves, Options: "x1", Color: theme.Shades[1], Title: lang.tr("Two doses")},
+		},
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/obs"
+)
+
+// report holds aggregated data read from one of the Bioportal API's reports.
+type report interface {
+	// summarize writes a line describing each day's data to w.
+	summarize(w io.Writer)
+	// records returns daily records in the obs package's format.
+	records(now time.Time) []obs.Record
+	// plots returns the plots that should be rendered for the report.
+	plots(theme *gnuplot.Theme, lang *language, now time.Time) []plotDef
+}
+
+// reports contains functions for reading each type of report from a JSON array,
+// keyed by the name passed via -report.
+var reports = map[string]func(r io.Reader) (report, error){
+	"tests":        readTestReport,
+	"cases":        readCaseReport,
+	"vaccinations": readVaccReport,
+}
+
+// defaultReport is the key into reports that is used if -report isn't specified.
+const defaultReport = "tests"
+
+// reportNames returns the keys of reports in ascending order.
+func reportNames() []string {
+	var names []string
+	for n := range reports {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// plotDef describes a plot to render.
+type plotDef struct {
+	out  string            // output file without extension, e.g. "my-plot"
+	plot *gnuplot.Plot     // plot to draw
+	data func(w io.Writer) // writes gnuplot data to w
+}
+
+// ageData returns a function that writes age-stratified heatmap data for ageHeatPlot.
+// weeks should be sorted, and f is called to get the value for each week and age range
+// up to maxAge. Weeks ending after maxDate are omitted if it is non-zero.
+func ageData(lang *language, weeks []time.Time, f func(week time.Time, ar ageRange) interface{},
+	maxAge ageRange, maxDate time.Time) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintf(w, "X\tDate\tAge\tValue\n")
+		for i, week := range weeks {
+			if !maxDate.IsZero() && week.AddDate(0, 0, 7).After(maxDate) {
+				break
+			}
+			for ar := age0To9; ar <= maxAge; ar++ {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%v\n", i, week.Format(lang.weekLayout), ar.min(), f(week, ar))
+			}
+		}
+	}
+}
+
+// perCapita returns v scaled to the supplied number of people in ar (e.g. 100,000),
+// or 0 if ar's population is unknown.
+func perCapita(v int, ar ageRange, people float64) float64 {
+	pop := unAgePop[ar]
+	if pop == 0 {
+		return 0
+	}
+	return people * float64(v) / float64(pop)
+}
+
+// totalPop returns Puerto Rico's total population.
+func totalPop() int {
+	var total int
+	for _, pop := range unAgePop {
+		total += pop
+	}
+	return total
+}
+
+// testReport holds data from the minimal-info-unique-tests report.
+type testReport struct {
+	colStats, repStats statsMap // daily stats by collection and reporting date
+}
+
+func readTestReport(r io.Reader) (report, error) {
+	colStats, repStats, err := readTests(r)
+	if err != nil {
+		return nil, err
+	}
+	return &testReport{colStats, repStats}, nil
+}
+
+func (tr *testReport) summarize(w io.Writer) {
+	for _, d := range sortedTimes(tr.repStats) {
+		fmt.Fprintf(w, "%s: %s\n", d.Format("2006-01-02"), tr.repStats[d])
+	}
+}
+
+func (tr *testReport) records(now time.Time) []obs.Record {
+	return records(tr.colStats, tr.repStats, now)
+}
+
+func (tr *testReport) plots(theme *gnuplot.Theme, lang *language, now time.Time) []plotDef {
+	avgColStats := averageStats(tr.colStats, 7)
+	avgRepStats := averageStats(tr.repStats, 7)
+	weekColStats := weeklyStats(tr.colStats)
+	weekRepStats := weeklyStats(tr.repStats)
+	colWeeks := sortedTimes(weekColStats)
+	repWeeks := sortedTimes(weekRepStats)
+
+	// Find the max 90th-percentile delay so we can use the same scale on delay plots.
+	maxDelay := 0
+	for _, s := range weekRepStats {
+		if v := s.delayPct(90); v > maxDelay {
+			maxDelay = v
+		}
+		if v := s.posDelayPct(90); v > maxDelay {
+			maxDelay = v
+		}
+		if v := s.negDelayPct(90); v > maxDelay {
+			maxDelay = v
+		}
+	}
+
+	// Returns a plot function that writes delay distribution data supplied by f.
+	makeDelayDataFunc := func(f func(s *stats, pct float64) int) func(w io.Writer) {
+		return func(w io.Writer) {
+			fmt.Fprintf(w, "Date\t10th\t25th\t50th\t75th\t90th\n")
+			for _, week := range repWeeks {
+				s := weekRepStats[week]
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", week.Format("2006-01-02"),
+					f(s, 10), f(s, 25), f(s, 50), f(s, 75), f(s, 90))
+			}
+		}
+	}
+
+	return []plotDef{
+		{
+			out:  "positives-age",
+			plot: ageHeatPlot(theme, lang, "positive COVID-19 tests", "Reporting week"),
+			data: ageData(lang, repWeeks, func(week time.Time, ar ageRange) interface{} {
+				return weekRepStats[week].agePos[ar]
+			}, age100To109, time.Time{}),
+		},
+		{
+			out:  "positives-age-scaled",
+			plot: ageHeatPlot(theme, lang, "positive COVID-19 tests per 100,000 people", "Reporting week"),
+			data: ageData(lang, repWeeks, func(week time.Time, ar ageRange) interface{} {
+				return int64(math.Round(perCapita(weekRepStats[week].agePos[ar], ar, 100000)))
+			}, age80To89, time.Time{}),
+		},
+		{
+			out:  "positivity-age",
+			plot: ageHeatPlot(theme, lang, "COVID-19 test positivity rate", "Sample collection week"),
+			data: ageData(lang, colWeeks, func(week time.Time, ar ageRange) interface{} {
+				s := weekColStats[week]
+				pos := float64(s.agePos[ar])
+				total := pos + float64(s.ageNeg[ar])
+				if total < positivityMinTests {
+					return 0
+				}
+				return math.Min(pos/total, positivityMaxRate)
+			}, age100To109, now.Add(-positivityDelay)),
+		},
+		{
+			out:  "results-age-scaled",
+			plot: ageHeatPlot(theme, lang, "total COVID-19 tests per 100,000 people", "Reporting week"),
+			data: ageData(lang, repWeeks, func(week time.Time, ar ageRange) interface{} {
+				s := weekRepStats[week]
+				return int64(math.Round(perCapita(s.agePos[ar]+s.ageNeg[ar], ar, 100000)))
+			}, age80To89, time.Time{}),
+		},
+		{
+			out:  "test-types",
+			plot: typesPlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tMolecular\tSerological\tAntigen\tUnknown\n")
+				for _, d := range sortedTimes(avgRepStats) {
+					s := avgRepStats[d]
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", d.Format("2006-01-02"), s.total(), s.ab, s.ag, s.unk)
+				}
+			},
+		},
+		{
+			out:  "positivity",
+			plot: posRatePlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tPositivity\n")
+				for _, d := range sortedTimes(avgColStats) {
+					if now.Sub(d) < positivityDelay {
+						break
+					}
+					s := avgColStats[d]
+					posPct := 100 * float64(s.pos) / float64(s.pos+s.neg)
+					fmt.Fprintf(w, "%s\t%0.1f\n", d.Format("2006-01-02"), posPct)
+				}
+			},
+		},
+		{
+			out:  "result-delays",
+			plot: delaysPlot(theme, lang, "total", maxDelay),
+			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.delayPct(pct) }),
+		},
+		{
+			out:  "positive-result-delays",
+			plot: delaysPlot(theme, lang, "positive", maxDelay),
+			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.posDelayPct(pct) }),
+		},
+		{
+			out:  "negative-result-delays",
+			plot: delaysPlot(theme, lang, "negative", maxDelay),
+			data: makeDelayDataFunc(func(s *stats, pct float64) int { return s.negDelayPct(pct) }),
+		},
+		{
+			out:  "age-dist",
+			plot: ageDistPlot(theme, lang),
+			data: func(w io.Writer) {
+				ars := []ageRange{age0To9, age10To19, age20To29, age30To39, age40To49, age50To59, age60To69, age70To79, age80To89, age90To99}
+				fmt.Fprintf(w, "Date")
+				for _, ar := range ars {
+					fmt.Fprintf(w, "\t%d-%d", ar.min(), ar.max())
+				}
+				fmt.Fprintf(w, "\n")
+
+				started := false
+				for _, d := range sortedTimes(avgColStats) {
+					s := avgColStats[d]
+
+					if !started {
+						if s.pos < ageDistMinPosTests {
+							continue
+						}
+						started = true
+					}
+
+					fmt.Fprint(w, d.Format("2006-01-02"))
+					var total, cumul int
+					for _, ar := range ars {
+						total += s.agePos[ar]
+					}
+					for _, ar := range ars {
+						cumul += s.agePos[ar]
+						fmt.Fprintf(w, "\t%0.2f", float64(cumul)/float64(total))
+					}
+					fmt.Fprintf(w, "\n")
+				}
+			},
+		},
+	}
+}
+
+// caseReport holds data from the Bioportal's per-case report.
+type caseReport struct {
+	stats caseStatsMap // daily stats; see readCases
+}
+
+func readCaseReport(r io.Reader) (report, error) {
+	m, err := readCases(r)
+	if err != nil {
+		return nil, err
+	}
+	return &caseReport{m}, nil
+}
+
+func (cr *caseReport) summarize(w io.Writer) {
+	for _, d := range sortedTimes(cr.stats) {
+		fmt.Fprintf(w, "%s: %s\n", d.Format("2006-01-02"), cr.stats[d])
+	}
+}
+
+func (cr *caseReport) records(now time.Time) []obs.Record {
+	return caseRecords(cr.stats)
+}
+
+func (cr *caseReport) plots(theme *gnuplot.Theme, lang *language, now time.Time) []plotDef {
+	avgStats := averageCaseStats(cr.stats, 7)
+	weekStats := weeklyCaseStats(cr.stats)
+	weeks := sortedTimes(weekStats)
+
+	return []plotDef{
+		{
+			out:  "cases",
+			plot: casesPlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tConfirmed\tProbable\tHospitalized\tICU\n")
+				for _, d := range sortedTimes(avgStats) {
+					s := avgStats[d]
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", d.Format("2006-01-02"), s.confirmed, s.probable, s.hosp, s.icu)
+				}
+			},
+		},
+		{
+			out:  "deaths",
+			plot: deathsPlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tDeaths\n")
+				for _, d := range sortedTimes(avgStats) {
+					fmt.Fprintf(w, "%s\t%d\n", d.Format("2006-01-02"), avgStats[d].deaths)
+				}
+			},
+		},
+		{
+			out:  "cases-age-scaled",
+			plot: ageHeatPlot(theme, lang, "COVID-19 cases per 100,000 people", "Reporting week"),
+			data: ageData(lang, weeks, func(week time.Time, ar ageRange) interface{} {
+				return int64(math.Round(perCapita(weekStats[week].ageCases[ar], ar, 100000)))
+			}, age80To89, time.Time{}),
+		},
+		{
+			out:  "deaths-age",
+			plot: ageHeatPlot(theme, lang, "COVID-19 deaths", "Week of death"),
+			data: ageData(lang, weeks, func(week time.Time, ar ageRange) interface{} {
+				return weekStats[week].ageDeaths[ar]
+			}, age100To109, time.Time{}),
+		},
+	}
+}
+
+// vaccReport holds data from the Bioportal's vaccination report.
+type vaccReport struct {
+	stats vaccStatsMap // daily stats by administration date
+}
+
+func readVaccReport(r io.Reader) (report, error) {
+	m, err := readVaccinations(r)
+	if err != nil {
+		return nil, err
+	}
+	return &vaccReport{m}, nil
+}
+
+func (vr *vaccReport) summarize(w io.Writer) {
+	for _, d := range sortedTimes(vr.stats) {
+		fmt.Fprintf(w, "%s: %s\n", d.Format("2006-01-02"), vr.stats[d])
+	}
+}
+
+func (vr *vaccReport) records(now time.Time) []obs.Record {
+	return vaccRecords(vr.stats)
+}
+
+func (vr *vaccReport) plots(theme *gnuplot.Theme, lang *language, now time.Time) []plotDef {
+	avgStats := averageVaccStats(vr.stats, 7)
+	cumulStats := cumulativeVaccStats(vr.stats)
+	weekCumulStats := cumulativeVaccStats(weeklyVaccStats(vr.stats))
+	weeks := sortedTimes(weekCumulStats)
+	pop := float64(totalPop())
+
+	return []plotDef{
+		{
+			out:  "vaccinations",
+			plot: vaccinationsPlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tFirst\tSecond\tBooster\n")
+				for _, d := range sortedTimes(avgStats) {
+					s := avgStats[d]
+					fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", d.Format("2006-01-02"),
+						s.doses[firstDose], s.doses[secondDose], s.doses[boosterDose])
+				}
+			},
+		},
+		{
+			out:  "vaccinated",
+			plot: vaccinatedPlot(theme, lang),
+			data: func(w io.Writer) {
+				fmt.Fprintf(w, "Date\tOneDose\tTwoDoses\n")
+				for _, d := range sortedTimes(cumulStats) {
+					s := cumulStats[d]
+					fmt.Fprintf(w, "%s\t%0.2f\t%0.2f\n", d.Format("2006-01-02"),
+						100*float64(s.doses[firstDose])/pop, 100*float64(s.doses[secondDose])/pop)
+				}
+			},
+		},
+		{
+			out:  "vaccinated-age",
+			plot: ageHeatPlot(theme, lang, "percent of people with at least one COVID-19 vaccine dose", "Administration week"),
+			data: ageData(lang, weeks, func(week time.Time, ar ageRange) interface{} {
+				return math.Min(math.Round(perCapita(weekCumulStats[week].ageFirst[ar], ar, 100)), 100)
+			}, age80To89, time.Time{}),
+		},
+		{
+			out:  "fully-vaccinated-age",
+			plot: ageHeatPlot(theme, lang, "percent of people with two COVID-19 vaccine doses", "Administration week"),
+			data: ageData(lang, weeks, func(week time.Time, ar ageRange) interface{} {
+				return math.Min(math.Round(perCapita(weekCumulStats[week].ageSecond[ar], ar, 100)), 100)
+			}, age80To89, time.Time{}),
+		},
+	}
+}
@@ -198,30 +198,38 @@ func (m statsMap) get(t time.Time) *stats {
 // weeklyStats aggregates the stats in dm by week (starting on Sundays).
 func weeklyStats(dm statsMap) statsMap {
 	wm := make(statsMap)
-	for d, s := range dm {
-		week := d.AddDate(0, 0, -1*int(d.Weekday())) // subtract to sunday
-		ws := wm[week]
-		if ws == nil {
-			ws = newStats()
-			wm[week] = ws
-		}
-		ws.add(s)
-	}
+	addWeekly(dm, func(week, day time.Time) { wm.get(week).add(dm[day]) })
 	return wm
 }
 
 // averageStats returns a new map with a numDays-day rolling average for each day in dm.
 func averageStats(dm statsMap, numDays int) statsMap {
 	am := make(statsMap)
+	addAverages(dm, numDays,
+		func(dst, src time.Time) { am.get(dst).add(dm[src]) },
+		func(dst time.Time, sc float64) { am.get(dst).scale(sc) })
+	return am
+}
+
+// addWeekly calls add for each day in dm (a map keyed by time.Time) with the
+// Sunday starting the day's week, so daily values can be aggregated by week.
+func addWeekly(dm interface{}, add func(week, day time.Time)) {
+	for _, d := range sortedTimes(dm) {
+		add(d.AddDate(0, 0, -1*int(d.Weekday())), d) // subtract to sunday
+	}
+}
+
+// addAverages computes a numDays-day rolling average for each day in dm (a map keyed by
+// time.Time). add is called for each of the up-to-numDays days ending at dst (including
+// dst itself), and then scale is called with the reciprocal of the number of days.
+func addAverages(dm interface{}, numDays int, add func(dst, src time.Time), scale func(dst time.Time, sc float64)) {
 	days := sortedTimes(dm)
 	for i, d := range days {
-		as := am.get(d)
 		nd := 0
 		for j := 0; j < numDays && i-j >= 0; j++ {
-			as.add(dm[days[i-j]])
+			add(d, days[i-j])
 			nd++
 		}
-		as.scale(1 / float64(nd))
+		scale(d, 1/float64(nd))
 	}
-	return am
 }
@@ -3,7 +3,10 @@
 
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestStats_Update(t *testing.T) {
 	s := newStats()
@@ -100,4 +103,39 @@ func TestHist_Add(t *testing.T) {
 	}
 }
 
-// TODO: Write tests for weeklyStats() and averageStats().
+func TestWeeklyStats(t *testing.T) {
+	dm := make(statsMap)
+	day := func(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, time.UTC) }
+	dm.get(day(5)).pos = 1 // Saturday
+	dm.get(day(6)).pos = 2 // Sunday
+	dm.get(day(12)).pos = 4
+	dm.get(day(13)).pos = 8
+
+	wm := weeklyStats(dm)
+	for week, want := range map[time.Time]int{
+		time.Date(2020, 8, 30, 0, 0, 0, 0, time.UTC): 1,
+		day(6):  6,
+		day(13): 8,
+	} {
+		if s := wm[week]; s == nil || s.pos != want {
+			t.Errorf("Week starting %v has %v; want pos=%d", week.Format("2006-01-02"), s, want)
+		}
+	}
+	if len(wm) != 3 {
+		t.Errorf("Got %d week(s); want 3", len(wm))
+	}
+}
+
+func TestAverageStats(t *testing.T) {
+	dm := make(statsMap)
+	day := func(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, time.UTC) }
+	for d, pos := range map[int]int{1: 3, 2: 6, 3: 9, 4: 12} {
+		dm.get(day(d)).pos = pos
+	}
+	am := averageStats(dm, 3)
+	for d, want := range map[int]int{1: 3, 2: 5, 3: 6, 4: 9} {
+		if s := am[day(d)]; s == nil || s.pos != want {
+			t.Errorf("Average for %v is %v; want pos=%d", day(d).Format("2006-01-02"), s, want)
+		}
+	}
+}
@@ -5,7 +5,6 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"time"
 )
 
@@ -112,15 +111,14 @@ var ageRangeStrings = map[string]ageRange{
 	"140 to 149": age140To149,
 }
 
+var ageRangeEnum = newEnum("age range", ageRangeStrings)
+
 func (a *ageRange) UnmarshalJSON(b []byte) error {
-	var s string
-	if err := json.Unmarshal(b, &s); err != nil {
+	v, err := ageRangeEnum.unmarshal(b)
+	if err != nil {
 		return err
 	}
-	var ok bool
-	if *a, ok = ageRangeStrings[s]; !ok {
-		return fmt.Errorf("invalid age range %q", s)
-	}
+	*a = ageRange(v)
 	return nil
 }
 
@@ -147,23 +145,25 @@ const (
 	unknownType
 )
 
+// Strings are normalized by enum, so e.g. "MOLECULAR" matches "Molecular".
+var testTypeStrings = map[string]testType{
+	"Antigens":             antigen,
+	"Antigeno":             antigen,
+	"Molecular":            molecular,
+	"Serological":          serological,
+	"Serological IgG Only": serological,
+	"Total Antibodies":     serological,
+	"":                     unknownType,
+}
+
+var testTypeEnum = newEnum("test type", testTypeStrings)
+
 func (t *testType) UnmarshalJSON(b []byte) error {
-	var s string
-	if err := json.Unmarshal(b, &s); err != nil {
+	v, err := testTypeEnum.unmarshal(b)
+	if err != nil {
 		return err
 	}
-	switch s {
-	case "Antigens", "ANTIGENO":
-		*t = antigen
-	case "Molecular", "MOLECULAR":
-		*t = molecular
-	case "Serological", "Serological IgG Only", "Total Antibodies", "SEROLOGICAL":
-		*t = serological
-	case "":
-		*t = unknownType
-	default:
-		return fmt.Errorf("invalid test type %q", s)
-	}
+	*t = testType(v)
 	return nil
 }
 
@@ -218,14 +218,13 @@ var resultStrings = map[string]result{
 	"":             otherResult,
 }
 
+var resultEnum = newEnum("result", resultStrings)
+
 func (r *result) UnmarshalJSON(b []byte) error {
-	var s string
-	if err := json.Unmarshal(b, &s); err != nil {
+	v, err := resultEnum.unmarshal(b)
+	if err != nil {
 		return err
 	}
-	var ok bool
-	if *r, ok = resultStrings[s]; !ok {
-		return fmt.Errorf("invalid result %q", s)
-	}
+	*r = result(v)
 	return nil
 }
@@ -0,0 +1,188 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// vaccination represents the number of COVID-19 vaccine doses of a given type that
+// were administered to people in an age range on a single day. Each count is described
+// as a JSON object:
+//
+//  {
+//    "administeredDate": "12/28/2020",
+//    "ageRange": "60 to 69",
+//    "dose": "First",
+//    "manufacturer": "Pfizer",
+//    "count": 1234
+//  }
+type vaccination struct {
+	Administered jsonDate `json:"administeredDate"`
+	AgeRange     ageRange `json:"ageRange"`
+	Dose         dose     `json:"dose"`
+	Manufacturer string   `json:"manufacturer"`
+	Count        int      `json:"count"`
+}
+
+type dose int
+
+const (
+	firstDose dose = iota
+	secondDose
+	boosterDose
+	unknownDose
+)
+
+var doseStrings = map[string]dose{
+	"First":    firstDose,
+	"1":        firstDose,
+	"Dose 1":   firstDose,
+	"Primera":  firstDose,
+	"Second":   secondDose,
+	"2":        secondDose,
+	"Dose 2":   secondDose,
+	"Segunda":  secondDose,
+	"Booster":  boosterDose,
+	"3":        boosterDose,
+	"Dose 3":   boosterDose,
+	"Refuerzo": boosterDose,
+	"":         unknownDose,
+}
+
+var doseEnum = newEnum("dose", doseStrings)
+
+func (d *dose) UnmarshalJSON(b []byte) error {
+	v, err := doseEnum.unmarshal(b)
+	if err != nil {
+		return err
+	}
+	*d = dose(v)
+	return nil
+}
+
+type vaccStats struct {
+	doses map[dose]int // doses administered
+
+	// First and second doses grouped by age. The number of people who have received
+	// at least one dose or are fully vaccinated can be computed from these.
+	ageFirst, ageSecond map[ageRange]int
+}
+
+func newVaccStats() *vaccStats {
+	return &vaccStats{
+		doses:     make(map[dose]int),
+		ageFirst:  make(map[ageRange]int),
+		ageSecond: make(map[ageRange]int),
+	}
+}
+
+func (s vaccStats) String() string {
+	return fmt.Sprintf("%5d %5d %5d %3d",
+		s.doses[firstDose], s.doses[secondDose], s.doses[boosterDose], s.doses[unknownDose])
+}
+
+// update incorporates n doses of type d administered to people in ar into s.
+func (s *vaccStats) update(d dose, ar ageRange, n int) {
+	s.doses[d] += n
+	switch d {
+	case firstDose:
+		s.ageFirst[ar] += n
+	case secondDose:
+		s.ageSecond[ar] += n
+	}
+}
+
+// add incorporates o into s.
+func (s *vaccStats) add(o *vaccStats) {
+	if o == nil {
+		return
+	}
+	for d := firstDose; d <= unknownDose; d++ {
+		s.doses[d] += o.doses[d]
+	}
+	for ar := ageMin; ar <= ageMax; ar++ {
+		s.ageFirst[ar] += o.ageFirst[ar]
+		s.ageSecond[ar] += o.ageSecond[ar]
+	}
+}
+
+// scale multiplies s's values by sc.
+func (s *vaccStats) scale(sc float64) {
+	rs := func(v int) int { return int(math.Round(sc * float64(v))) }
+	for d := firstDose; d <= unknownDose; d++ {
+		s.doses[d] = rs(s.doses[d])
+	}
+	for ar := ageMin; ar <= ageMax; ar++ {
+		s.ageFirst[ar] = rs(s.ageFirst[ar])
+		s.ageSecond[ar] = rs(s.ageSecond[ar])
+	}
+}
+
+// vaccStatsMap holds vaccStats indexed by time (typically days).
+type vaccStatsMap map[time.Time]*vaccStats
+
+// get returns the vaccStats object for t, creating it if necessary.
+func (m vaccStatsMap) get(t time.Time) *vaccStats {
+	if s, ok := m[t]; ok {
+		return s
+	}
+	s := newVaccStats()
+	m[t] = s
+	return s
+}
+
+// cumulativeVaccStats returns a new map containing the running total for each day in dm.
+func cumulativeVaccStats(dm vaccStatsMap) vaccStatsMap {
+	cm := make(vaccStatsMap)
+	total := newVaccStats()
+	for _, d := range sortedTimes(dm) {
+		total.add(dm[d])
+		cm.get(d).add(total)
+	}
+	return cm
+}
+
+// weeklyVaccStats aggregates the stats in dm by week (starting on Sundays).
+func weeklyVaccStats(dm vaccStatsMap) vaccStatsMap {
+	wm := make(vaccStatsMap)
+	addWeekly(dm, func(week, day time.Time) { wm.get(week).add(dm[day]) })
+	return wm
+}
+
+// averageVaccStats returns a new map with a numDays-day rolling average for each day in dm.
+func averageVaccStats(dm vaccStatsMap, numDays int) vaccStatsMap {
+	am := make(vaccStatsMap)
+	addAverages(dm, numDays,
+		func(dst, src time.Time) { am.get(dst).add(dm[src]) },
+		func(dst time.Time, sc float64) { am.get(dst).scale(sc) })
+	return am
+}
+
+// readVaccinations reads a JSON array of vaccination objects from r and returns
+// daily stats grouped by administration date.
+func readVaccinations(r io.Reader) (vaccStatsMap, error) {
+	now := time.Now()
+	m := make(vaccStatsMap)
+	if err := readArray(r, func(dec *json.Decoder) error {
+		var v vaccination
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("failed reading vaccination: %v", err)
+		}
+		if v.Count < 0 {
+			return fmt.Errorf("negative count %d", v.Count)
+		}
+		if d := time.Time(v.Administered); !d.Before(startDate) && !d.After(now) {
+			m.get(d).update(v.Dose, v.AgeRange, v.Count)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadVaccinations(t *testing.T) {
+	const in = `[
+{"administeredDate":"12/28/2020","ageRange":"60 to 69","dose":"First","manufacturer":"Pfizer","count":10},
+{"administeredDate":"12/28/2020","ageRange":"70 to 79","dose":"First","manufacturer":"Moderna","count":5},
+{"administeredDate":"12/29/2020","ageRange":"60 to 69","dose":"First","manufacturer":"Pfizer","count":3},
+{"administeredDate":"1/18/2021","ageRange":"60 to 69","dose":"Second","manufacturer":"Pfizer","count":8}
+]`
+	m, err := readVaccinations(strings.NewReader(in))
+	if err != nil {
+		t.Fatal("readVaccinations failed: ", err)
+	}
+	day := func(y int, mon time.Month, d int) time.Time { return time.Date(y, mon, d, 0, 0, 0, 0, loc) }
+	if v := m[day(2020, 12, 28)].doses[firstDose]; v != 15 {
+		t.Errorf("First doses on 12/28 = %d; want 15", v)
+	}
+
+	cm := cumulativeVaccStats(m)
+	last := cm[day(2021, 1, 18)]
+	if v := last.doses[firstDose]; v != 18 {
+		t.Errorf("Cumulative first doses = %d; want 18", v)
+	}
+	if v := last.doses[secondDose]; v != 8 {
+		t.Errorf("Cumulative second doses = %d; want 8", v)
+	}
+	if v := last.ageFirst[age60To69]; v != 13 {
+		t.Errorf("Cumulative ageFirst[age60To69] = %d; want 13", v)
+	}
+	if v := cm[day(2020, 12, 28)].doses[firstDose]; v != 15 {
+		t.Errorf("Cumulative first doses on 12/28 = %d; want 15", v)
+	}
+
+	if _, err := readVaccinations(strings.NewReader(
+		`[{"administeredDate":"12/28/2020","ageRange":"60 to 69","dose":"First","count":-1}]`)); err == nil {
+		t.Error("readVaccinations unexpectedly accepted negative count")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/derat/covid/input"
+)
+
+// point is a vertex of a boundary, typically a longitude and latitude.
+type point struct{ x, y float64 }
+
+// ring is a closed sequence of points.
+type ring []point
+
+// area returns r's signed area. It's positive if r is counterclockwise.
+func (r ring) area() float64 {
+	var a float64
+	for i := range r {
+		p, q := r[i], r[(i+1)%len(r)]
+		a += p.x*q.y - q.x*p.y
+	}
+	return a / 2
+}
+
+// feature is a geographic feature read from a boundary file.
+type feature struct {
+	id    string            // GeoJSON feature ID; empty for shapefiles
+	props map[string]string // attributes, e.g. "GEOID" or "NAME"
+	rings []ring            // outer rings of the feature's polygons
+}
+
+// shape is the boundary of a county or state.
+type shape struct {
+	fips  int    // county (e.g. 1001) or state (e.g. 1) FIPS code
+	rings []ring // outer rings
+}
+
+// area returns the total unsigned area of s's rings.
+func (s *shape) area() float64 {
+	var a float64
+	for _, r := range s.rings {
+		a += math.Abs(r.area())
+	}
+	return a
+}
+
+// readBoundaryFile reads county or state boundaries from the GeoJSON (".json" or ".geojson")
+// or shapefile (".shp", with a ".dbf" file alongside it) file at p. Features are keyed by the
+// FIPS code in the named property, which is detected automatically if fipsProp is empty.
+func readBoundaryFile(p, fipsProp string) (map[int]*shape, error) {
+	var feats []*feature
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(p)); ext {
+	case ".json", ".geojson":
+		var f io.ReadCloser
+		if f, err = input.Open(p); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		feats, err = readGeoJSON(f)
+	case ".shp":
+		feats, err = readShapefile(p)
+	default:
+		return nil, fmt.Errorf("unsupported extension %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shapes := make(map[int]*shape)
+	for i, f := range feats {
+		fips, err := f.fips(fipsProp)
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %v", i, err)
+		}
+		// Features may be split, e.g. when a county spans the antimeridian.
+		if s, ok := shapes[fips]; ok {
+			s.rings = append(s.rings, f.rings...)
+		} else {
+			shapes[fips] = &shape{fips: fips, rings: f.rings}
+		}
+	}
+	return shapes, nil
+}
+
+// Property names (or comma-separated state and county pairs) checked in order by feature.fips
+// if a property wasn't explicitly specified. These cover the Census Bureau's cartographic
+// boundary files in both their shapefile and GeoJSON forms.
+var fipsProps = []string{"GEOID", "FIPS", "fips", "GEO_ID", "STATEFP,COUNTYFP", "STATE,COUNTY", "STATEFP", "STATE"}
+
+// fips returns f's FIPS code from prop (see fipsProps). If prop is empty,
+// well-known properties are tried, followed by the feature ID.
+func (f *feature) fips(prop string) (int, error) {
+	props := []string{prop}
+	if prop == "" {
+		props = fipsProps
+	}
+	for _, p := range props {
+		var val string
+		for _, name := range strings.Split(p, ",") {
+			v, ok := f.props[name]
+			if !ok {
+				val = ""
+				break
+			}
+			val += strings.TrimSpace(v)
+		}
+		if val != "" {
+			return parseFIPS(val)
+		}
+	}
+	if prop == "" && f.id != "" {
+		return parseFIPS(f.id)
+	}
+	return -1, fmt.Errorf("no FIPS code in %q", prop)
+}
+
+// parseFIPS parses a FIPS code like "01001" or "0500000US01001".
+func parseFIPS(s string) (int, error) {
+	if i := strings.LastIndex(s, "US"); i >= 0 {
+		s = s[i+2:]
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return -1, fmt.Errorf("bad FIPS code %q", s)
+	}
+	return v, nil
+}
+
+// readGeoJSON reads features from a GeoJSON FeatureCollection containing
+// Polygon and MultiPolygon geometries.
+func readGeoJSON(r io.Reader) ([]*feature, error) {
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			ID         interface{}            `json:"id"`
+			Properties map[string]interface{} `json:"properties"`
+			Geometry   *struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber() // preserve numeric FIPS codes exactly
+	if err := dec.Decode(&fc); err != nil {
+		return nil, err
+	}
+	if fc.Type != "FeatureCollection" {
+		return nil, fmt.Errorf("got type %q instead of FeatureCollection", fc.Type)
+	}
+
+	str := func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+
+	var feats []*feature
+	for i, jf := range fc.Features {
+		if jf.Geometry == nil {
+			continue
+		}
+		f := &feature{id: str(jf.ID), props: make(map[string]string)}
+		for k, v := range jf.Properties {
+			f.props[k] = str(v)
+		}
+
+		var polys [][][][]float64
+		switch jf.Geometry.Type {
+		case "Polygon":
+			var poly [][][]float64
+			if err := json.Unmarshal(jf.Geometry.Coordinates, &poly); err != nil {
+				return nil, fmt.Errorf("feature %d: %v", i, err)
+			}
+			polys = append(polys, poly)
+		case "MultiPolygon":
+			if err := json.Unmarshal(jf.Geometry.Coordinates, &polys); err != nil {
+				return nil, fmt.Errorf("feature %d: %v", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("feature %d has unsupported geometry %q", i, jf.Geometry.Type)
+		}
+
+		// The first ring of each polygon is its exterior; the rest are holes.
+		for _, poly := range polys {
+			if len(poly) == 0 {
+				continue
+			}
+			var rg ring
+			for _, c := range poly[0] {
+				if len(c) < 2 {
+					return nil, fmt.Errorf("feature %d has bad position %v", i, c)
+				}
+				rg = append(rg, point{c[0], c[1]})
+			}
+			f.rings = append(f.rings, rg)
+		}
+		feats = append(feats, f)
+	}
+	return feats, nil
+}
+
+// Shapefile shape types containing polygons. The Z and M variants
+// have additional data after the 2D points, which is ignored.
+const (
+	shpNull     = 0
+	shpPolygon  = 5
+	shpPolygonZ = 15
+	shpPolygonM = 25
+)
+
+// readShapefile reads polygon features from the shapefile at p.
+// Attributes are read from the .dbf file with the same base name.
+func readShapefile(p string) ([]*feature, error) {
+	shp, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	rings, err := readShapes(shp)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", p, err)
+	}
+
+	dp := strings.TrimSuffix(p, filepath.Ext(p)) + ".dbf"
+	if _, err := os.Stat(dp); err != nil {
+		dp = strings.TrimSuffix(p, filepath.Ext(p)) + ".DBF"
+	}
+	dbf, err := ioutil.ReadFile(dp)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := readDBF(dbf)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", dp, err)
+	}
+	if len(recs) != len(rings) {
+		return nil, fmt.Errorf("%d shape(s) but %d attribute record(s)", len(rings), len(recs))
+	}
+
+	var feats []*feature
+	for i, rs := range rings {
+		if rs != nil {
+			feats = append(feats, &feature{props: recs[i], rings: rs})
+		}
+	}
+	return feats, nil
+}
+
+// readShapes reads the outer rings of each record in the supplied .shp file data.
+// Null shapes are returned as nil.
+func readShapes(b []byte) ([][]ring, error) {
+	if len(b) < 100 || binary.BigEndian.Uint32(b[0:4]) != 9994 {
+		return nil, fmt.Errorf("not a shapefile")
+	}
+	if st := binary.LittleEndian.Uint32(b[32:36]); st != shpNull && st != shpPolygon &&
+		st != shpPolygonZ && st != shpPolygonM {
+		return nil, fmt.Errorf("unsupported shape type %d", st)
+	}
+
+	var shapes [][]ring
+	for off := 100; off < len(b); {
+		if off+8 > len(b) {
+			return nil, fmt.Errorf("truncated record header at %d", off)
+		}
+		clen := 2 * int(binary.BigEndian.Uint32(b[off+4:off+8])) // 16-bit words
+		start := off + 8
+		off = start + clen
+		if off > len(b) || clen < 4 {
+			return nil, fmt.Errorf("bad record length at %d", start)
+		}
+		rec := b[start:off]
+
+		if binary.LittleEndian.Uint32(rec[0:4]) == shpNull {
+			shapes = append(shapes, nil)
+			continue
+		}
+		if len(rec) < 44 {
+			return nil, fmt.Errorf("truncated record at %d", start)
+		}
+		nparts := int(binary.LittleEndian.Uint32(rec[36:40]))
+		npoints := int(binary.LittleEndian.Uint32(rec[40:44]))
+		pstart := 44 + 4*nparts
+		if nparts <= 0 || npoints < 0 || pstart+16*npoints > len(rec) {
+			return nil, fmt.Errorf("bad record at %d", start)
+		}
+		pt := func(i int) point {
+			o := pstart + 16*i
+			return point{
+				math.Float64frombits(binary.LittleEndian.Uint64(rec[o : o+8])),
+				math.Float64frombits(binary.LittleEndian.Uint64(rec[o+8 : o+16])),
+			}
+		}
+
+		// Outer rings are clockwise and holes are counterclockwise.
+		var outer, all []ring
+		for i := 0; i < nparts; i++ {
+			first := int(binary.LittleEndian.Uint32(rec[40+4*(i+1):]))
+			last := npoints
+			if i < nparts-1 {
+				last = int(binary.LittleEndian.Uint32(rec[40+4*(i+2):]))
+			}
+			if first < 0 || first > last || last > npoints {
+				return nil, fmt.Errorf("bad part %d in record at %d", i, start)
+			}
+			rg := make(ring, 0, last-first)
+			for j := first; j < last; j++ {
+				rg = append(rg, pt(j))
+			}
+			all = append(all, rg)
+			if rg.area() <= 0 {
+				outer = append(outer, rg)
+			}
+		}
+		if len(outer) == 0 {
+			outer = all // tolerate files with reversed winding
+		}
+		shapes = append(shapes, outer)
+	}
+	return shapes, nil
+}
+
+// readDBF reads the records in the supplied dBASE (.dbf) file data.
+// Values are returned as trimmed strings keyed by field name.
+func readDBF(b []byte) ([]map[string]string, error) {
+	if len(b) < 32 {
+		return nil, fmt.Errorf("truncated header")
+	}
+	nrecs := int(binary.LittleEndian.Uint32(b[4:8]))
+	hlen := int(binary.LittleEndian.Uint16(b[8:10]))
+	rlen := int(binary.LittleEndian.Uint16(b[10:12]))
+	if hlen > len(b) || hlen+nrecs*rlen > len(b) {
+		return nil, fmt.Errorf("truncated data")
+	}
+
+	type field struct {
+		name string
+		len  int
+	}
+	var fields []field
+	for off := 32; off+32 <= hlen && b[off] != 0x0d; off += 32 {
+		name := b[off : off+11]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		fields = append(fields, field{string(name), int(b[off+16])})
+	}
+
+	recs := make([]map[string]string, 0, nrecs)
+	for i := 0; i < nrecs; i++ {
+		rec := b[hlen+i*rlen : hlen+(i+1)*rlen]
+		vals := make(map[string]string, len(fields))
+		off := 1 // skip deletion flag
+		for _, f := range fields {
+			if off+f.len > len(rec) {
+				return nil, fmt.Errorf("record %d too short", i)
+			}
+			vals[f.name] = strings.TrimSpace(string(rec[off : off+f.len]))
+			off += f.len
+		}
+		recs = append(recs, vals) // keep deleted records so indexes match the .shp file
+	}
+	return recs, nil
+}
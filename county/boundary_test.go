@@ -0,0 +1,188 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadGeoJSON(t *testing.T) {
+	const in = `{
+  "type": "FeatureCollection",
+  "features": [
+    {
+      "type": "Feature",
+      "properties": {"GEO_ID": "0500000US01001", "NAME": "Autauga"},
+      "geometry": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]], [[0.1, 0.1], [0.2, 0.1], [0.1, 0.2]]]}
+    },
+    {
+      "type": "Feature",
+      "id": 2016,
+      "properties": {},
+      "geometry": {"type": "MultiPolygon", "coordinates": [[[[179, 52], [180, 52], [180, 53]]], [[[-179, 52], [-178, 52], [-178, 53]]]]}
+    },
+    {"type": "Feature", "properties": {"GEOID": "02016"}, "geometry": null}
+  ]
+}`
+	feats, err := readGeoJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatal("readGeoJSON failed: ", err)
+	}
+	if len(feats) != 2 {
+		t.Fatalf("readGeoJSON returned %d feature(s); want 2", len(feats))
+	}
+	for i, want := range []struct {
+		fips  int
+		rings []ring
+	}{
+		{1001, []ring{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}},
+		{2016, []ring{{{179, 52}, {180, 52}, {180, 53}}, {{-179, 52}, {-178, 52}, {-178, 53}}}},
+	} {
+		if fips, err := feats[i].fips(""); err != nil {
+			t.Errorf("Feature %d: fips failed: %v", i, err)
+		} else if fips != want.fips {
+			t.Errorf("Feature %d: got FIPS %d; want %d", i, fips, want.fips)
+		}
+		if diff := cmp.Diff(want.rings, feats[i].rings, cmp.AllowUnexported(point{})); diff != "" {
+			t.Errorf("Feature %d has bad rings:\n%s", i, diff)
+		}
+	}
+}
+
+func TestFeature_FIPS(t *testing.T) {
+	for _, tc := range []struct {
+		props map[string]string
+		prop  string
+		want  int // -1 for error
+	}{
+		{map[string]string{"GEOID": "36061"}, "", 36061},
+		{map[string]string{"STATEFP": "36", "COUNTYFP": "061"}, "", 36061},
+		{map[string]string{"STATE": "06", "NAME": "California"}, "", 6},
+		{map[string]string{"CODE": "6037", "GEOID": "1"}, "CODE", 6037},
+		{map[string]string{"GEOID": "1"}, "CODE", -1},
+		{map[string]string{"GEOID": "bogus"}, "", -1},
+	} {
+		f := &feature{props: tc.props}
+		if got, err := f.fips(tc.prop); tc.want < 0 && err == nil {
+			t.Errorf("fips(%q) for %v unexpectedly returned %d", tc.prop, tc.props, got)
+		} else if tc.want >= 0 && err != nil {
+			t.Errorf("fips(%q) for %v failed: %v", tc.prop, tc.props, err)
+		} else if tc.want >= 0 && got != tc.want {
+			t.Errorf("fips(%q) for %v = %d; want %d", tc.prop, tc.props, got, tc.want)
+		}
+	}
+}
+
+// makeShp returns .shp file data containing a polygon record for each element of shapes.
+// nil elements are written as null shapes.
+func makeShp(shapes [][]ring) []byte {
+	le, be := binary.LittleEndian, binary.BigEndian
+	var recs bytes.Buffer
+	for i, rs := range shapes {
+		var c bytes.Buffer
+		if rs == nil {
+			binary.Write(&c, le, int32(shpNull))
+		} else {
+			binary.Write(&c, le, int32(shpPolygon))
+			binary.Write(&c, le, [4]float64{}) // bounding box is ignored
+			var n int32
+			for _, r := range rs {
+				n += int32(len(r))
+			}
+			binary.Write(&c, le, int32(len(rs)))
+			binary.Write(&c, le, n)
+			n = 0
+			for _, r := range rs {
+				binary.Write(&c, le, n)
+				n += int32(len(r))
+			}
+			for _, r := range rs {
+				for _, p := range r {
+					binary.Write(&c, le, [2]float64{p.x, p.y})
+				}
+			}
+		}
+		binary.Write(&recs, be, int32(i+1))
+		binary.Write(&recs, be, int32(c.Len()/2))
+		recs.Write(c.Bytes())
+	}
+
+	hdr := make([]byte, 100)
+	be.PutUint32(hdr[0:], 9994)
+	be.PutUint32(hdr[24:], uint32((100+recs.Len())/2))
+	le.PutUint32(hdr[28:], 1000)
+	le.PutUint32(hdr[32:], shpPolygon)
+	return append(hdr, recs.Bytes()...)
+}
+
+// makeDBF returns .dbf file data with a character field for each of names.
+func makeDBF(names []string, width int, recs [][]string) []byte {
+	hlen := 32 + 32*len(names) + 1
+	rlen := 1 + width*len(names)
+	b := make([]byte, hlen, hlen+rlen*len(recs))
+	b[0] = 3
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(recs)))
+	binary.LittleEndian.PutUint16(b[8:], uint16(hlen))
+	binary.LittleEndian.PutUint16(b[10:], uint16(rlen))
+	for i, n := range names {
+		f := b[32+32*i:]
+		copy(f, n)
+		f[11] = 'C'
+		f[16] = byte(width)
+	}
+	b[hlen-1] = 0x0d
+	for _, rec := range recs {
+		b = append(b, ' ')
+		for _, v := range rec {
+			b = append(b, []byte(v+strings.Repeat(" ", width-len(v)))...)
+		}
+	}
+	return b
+}
+
+func TestReadBoundaryFile_Shapefile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boundary_test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outer := ring{{0, 0}, {0, 2}, {2, 2}, {2, 0}, {0, 0}} // clockwise
+	hole := ring{{1, 1}, {1.5, 1}, {1.5, 1.5}, {1, 1}}    // counterclockwise
+	other := ring{{5, 5}, {5, 6}, {6, 6}, {5, 5}}
+	shp := makeShp([][]ring{{outer, hole}, nil, {other}})
+	dbf := makeDBF([]string{"STATEFP", "COUNTYFP"}, 5, [][]string{{"01", "001"}, {"01", "003"}, {"36", "061"}})
+
+	p := filepath.Join(dir, "counties.shp")
+	if err := ioutil.WriteFile(p, shp, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "counties.dbf"), dbf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shapes, err := readBoundaryFile(p, "")
+	if err != nil {
+		t.Fatal("readBoundaryFile failed: ", err)
+	}
+	want := map[int]*shape{
+		1001:  {fips: 1001, rings: []ring{outer}},
+		36061: {fips: 36061, rings: []ring{other}},
+	}
+	if diff := cmp.Diff(want, shapes, cmp.AllowUnexported(shape{}, point{})); diff != "" {
+		t.Error("readBoundaryFile returned bad shapes:\n" + diff)
+	}
+	if a := shapes[1001].area(); math.Abs(a-4) > 1e-9 {
+		t.Errorf("Got area %v; want 4", a)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// Color used for areas without data.
+const noDataColor = 0xdddddd
+
+// colorScale maps values to colors by linearly interpolating between evenly-spaced stops.
+type colorScale struct {
+	stops    []int   // RGB colors, e.g. 0xffffcc
+	min, max float64 // values mapped to the first and last stops
+	log      bool    // interpolate between the logarithms of values
+}
+
+// parseColors parses a comma-separated list of colors like "#ffffcc,#800026".
+func parseColors(s string) ([]int, error) {
+	var colors []int
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "#")
+		v, err := strconv.ParseUint(c, 16, 32)
+		if err != nil || len(c) != 6 {
+			return nil, fmt.Errorf("bad color %q", c)
+		}
+		colors = append(colors, int(v))
+	}
+	if len(colors) < 2 {
+		return nil, fmt.Errorf("need at least 2 colors")
+	}
+	return colors, nil
+}
+
+// frac returns the position of v within cs's range, clamped to [0, 1].
+func (cs *colorScale) frac(v float64) float64 {
+	min, max := cs.min, cs.max
+	if cs.log {
+		v, min, max = math.Log(math.Max(v, min)), math.Log(min), math.Log(max)
+	}
+	if max <= min {
+		return 1
+	}
+	return math.Max(0, math.Min(1, (v-min)/(max-min)))
+}
+
+// rgb returns the color for v, or noDataColor if v is NaN.
+func (cs *colorScale) rgb(v float64) int {
+	if math.IsNaN(v) {
+		return noDataColor
+	}
+	pos := cs.frac(v) * float64(len(cs.stops)-1)
+	i := int(pos)
+	if i >= len(cs.stops)-1 {
+		return cs.stops[len(cs.stops)-1]
+	}
+	f := pos - float64(i)
+	var c int
+	for _, shift := range []uint{16, 8, 0} {
+		a := float64((cs.stops[i] >> shift) & 0xff)
+		b := float64((cs.stops[i+1] >> shift) & 0xff)
+		c |= int(math.Round(a+f*(b-a))) << shift
+	}
+	return c
+}
+
+// palette returns a 'set palette' command matching cs.
+func (cs *colorScale) palette() string {
+	defs := make([]string, len(cs.stops))
+	for i, c := range cs.stops {
+		defs[i] = fmt.Sprintf("%d '#%06x'", i, c)
+	}
+	return "set palette defined (" + strings.Join(defs, ", ") + ")"
+}
+
+// setRange sets cs's range using vals for any unset (i.e. non-positive) bounds.
+// The upper bound defaults to the 95th percentile so a few outliers don't wash out
+// the rest of the map. Logarithmic scales require a positive lower bound.
+func (cs *colorScale) setRange(vals map[int]float64) {
+	var sorted []float64
+	for _, v := range vals {
+		if !math.IsNaN(v) && (!cs.log || v > 0) {
+			sorted = append(sorted, v)
+		}
+	}
+	sort.Float64s(sorted)
+	if cs.min <= 0 && cs.log {
+		cs.min = 1
+		if len(sorted) > 0 && sorted[0] < cs.min {
+			cs.min = sorted[0]
+		}
+	}
+	if cs.max <= 0 && len(sorted) > 0 {
+		cs.max = sorted[int(0.95*float64(len(sorted)-1))]
+	}
+	if cs.max <= cs.min {
+		cs.max = cs.min + 1
+	}
+}
+
+// stateFIPS returns the FIPS codes of the states in s, keyed by two-letter abbreviation.
+// USAFacts county FIPS codes consist of the state's code followed by three digits.
+func (s *series) stateFIPS() map[string]int {
+	codes := make(map[string]int)
+	for k, c := range s.counties {
+		if !c.unallocated() {
+			codes[k.state] = k.fips / 1000
+		}
+	}
+	return codes
+}
+
+// mapValues returns new cases per 100,000 people over the window days ending at index end
+// of cases.dates, keyed by FIPS code. If states is true, per-state values (including
+// unallocated cases) are returned; otherwise per-county values are returned.
+// Areas without population data are omitted.
+func mapValues(cases *series, pops map[countyKey]int, end, window int, states bool) (map[int]float64, error) {
+	if window <= 0 || end-window < 0 || end >= len(cases.dates) {
+		return nil, fmt.Errorf("need %d days of data", window+1)
+	}
+	vals := make(map[int]float64)
+	if states {
+		codes := cases.stateFIPS()
+		statePops := make(map[string]int)
+		for k, p := range pops {
+			statePops[k.state] += p
+		}
+		for _, st := range cases.states() {
+			code, ok := codes[st]
+			if !ok || statePops[st] <= 0 {
+				continue
+			}
+			inc := cases.stateDaily(st)
+			vals[code] = 100000 * float64(sumWindow(inc, end, window)) / float64(statePops[st])
+		}
+		return vals, nil
+	}
+	for k, c := range cases.counties {
+		if c.unallocated() || pops[k] <= 0 {
+			continue
+		}
+		vals[k.fips] = 100000 * float64(sumWindow(cases.increases(k), end, window)) / float64(pops[k])
+	}
+	return vals, nil
+}
+
+// filterShapes returns the shapes in shapes belonging to the states with the supplied
+// FIPS codes, sorted by descending area so that enclosed areas (e.g. independent cities)
+// are drawn after the areas surrounding them. If codes is nil, all shapes are returned.
+func filterShapes(shapes map[int]*shape, codes map[int]struct{}, states bool) []*shape {
+	var sorted []*shape
+	for _, s := range shapes {
+		code := s.fips
+		if !states {
+			code /= 1000
+		}
+		if _, ok := codes[code]; ok || codes == nil {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		ai, aj := sorted[i].area(), sorted[j].area()
+		if ai != aj {
+			return ai > aj
+		}
+		return sorted[i].fips < sorted[j].fips
+	})
+	return sorted
+}
+
+// projector returns a function that converts longitude and latitude to plot coordinates
+// using an equirectangular projection centered on the shapes' mean latitude.
+// Longitudes in the Eastern Hemisphere (e.g. Alaska's Aleutian Islands) are wrapped
+// so they appear next to the rest of the Western Hemisphere.
+// Coordinates that don't look geographic are returned unchanged.
+func projector(shapes []*shape) func(p point) point {
+	var sumY float64
+	var n, west int
+	for _, s := range shapes {
+		for _, r := range s.rings {
+			for _, p := range r {
+				if math.Abs(p.x) > 180 || math.Abs(p.y) > 90 {
+					return func(p point) point { return p }
+				}
+				sumY += p.y
+				n++
+				if p.x < 0 {
+					west++
+				}
+			}
+		}
+	}
+	if n == 0 {
+		return func(p point) point { return p }
+	}
+	scale := math.Cos(sumY / float64(n) * math.Pi / 180)
+	wrap := west > n/2
+	return func(p point) point {
+		if wrap && p.x > 0 {
+			p.x -= 360
+		}
+		return point{p.x * scale, p.y}
+	}
+}
+
+// writeMapData writes gnuplot data for drawing shapes colored by vals (keyed by FIPS code):
+//
+//  # X     Y      RGB      Value
+//  -54.012  44.35  16711422 123.4
+//  ...
+//
+// Each ring is followed by a blank line. Shapes without values are drawn with noDataColor.
+func writeMapData(w io.Writer, shapes []*shape, vals map[int]float64, cs *colorScale) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	project := projector(shapes)
+	printf("# X\tY\tRGB\tValue\n")
+	for _, s := range shapes {
+		v, ok := vals[s.fips]
+		if !ok {
+			v = math.NaN()
+		}
+		rgb := cs.rgb(v)
+		for _, r := range s.rings {
+			for _, p := range r {
+				p = project(p)
+				printf("%0.5f\t%0.5f\t%d\t%0.1f\n", p.x, p.y, rgb, v)
+			}
+			printf("\n")
+		}
+	}
+	return err
+}
+
+// plotMap writes a choropleth map of vals (keyed by FIPS code) drawn using shapes to imgPath
+// using theme (which may be nil). title is displayed at the top of the map. If keep is true,
+// the gnuplot script is left alongside imgPath.
+func plotMap(imgPath string, shapes []*shape, vals map[int]float64, cs *colorScale, title string,
+	theme *gnuplot.Theme, keep bool) error {
+	var b bytes.Buffer
+	if err := writeMapData(&b, shapes, vals, cs); err != nil {
+		return err
+	}
+
+	var missing bool
+	for _, s := range shapes {
+		if _, ok := vals[s.fips]; !ok {
+			missing = true
+			break
+		}
+	}
+	td, err := gnuplot.NewTemplateData(imgPath, theme, time.Now(), map[string]interface{}{
+		"Title":   gnuplot.Quote(title),
+		"Palette": cs.palette(),
+		"Min":     cs.min,
+		"Max":     cs.max,
+		"Log":     cs.log,
+		"Missing": missing,
+		"NoData":  fmt.Sprintf("#%06x", noDataColor),
+	})
+	if err != nil {
+		return err
+	}
+	opts := gnuplot.KeepOptions(imgPath, keep)
+	opts.Data = b.Bytes()
+	return gnuplot.ExecTemplateOptions(mapTmpl, td, opts)
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestColorScale(t *testing.T) {
+	stops, err := parseColors("#000000, #ff0000,0000ff")
+	if err != nil {
+		t.Fatal("parseColors failed: ", err)
+	}
+	cs := &colorScale{stops: stops, min: 0, max: 100}
+	for _, tc := range []struct {
+		v    float64
+		want int
+	}{
+		{-5, 0x000000},
+		{0, 0x000000},
+		{25, 0x800000},
+		{50, 0xff0000},
+		{75, 0x800080},
+		{100, 0x0000ff},
+		{500, 0x0000ff},
+		{math.NaN(), noDataColor},
+	} {
+		if got := cs.rgb(tc.v); got != tc.want {
+			t.Errorf("rgb(%v) = %06x; want %06x", tc.v, got, tc.want)
+		}
+	}
+
+	cs = &colorScale{stops: stops, min: 1, max: 100, log: true}
+	if got, want := cs.rgb(10), 0xff0000; got != want {
+		t.Errorf("rgb(10) with log scale = %06x; want %06x", got, want)
+	}
+	if got, want := cs.palette(), "set palette defined (0 '#000000', 1 '#ff0000', 2 '#0000ff')"; got != want {
+		t.Errorf("palette() = %q; want %q", got, want)
+	}
+
+	for _, s := range []string{"#fff,#000", "#ffffff", "#ffffff,#gggggg"} {
+		if _, err := parseColors(s); err == nil {
+			t.Errorf("parseColors(%q) unexpectedly succeeded", s)
+		}
+	}
+}
+
+func TestColorScale_SetRange(t *testing.T) {
+	vals := make(map[int]float64)
+	for i := 0; i <= 100; i++ {
+		vals[i] = float64(i)
+	}
+	cs := &colorScale{}
+	cs.setRange(vals)
+	if cs.min != 0 || cs.max != 95 {
+		t.Errorf("Got range [%v, %v]; want [0, 95]", cs.min, cs.max)
+	}
+	cs = &colorScale{max: 50, log: true}
+	cs.setRange(vals)
+	if cs.min != 1 || cs.max != 50 {
+		t.Errorf("Got log range [%v, %v]; want [1, 50]", cs.min, cs.max)
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	cases := makeSeries(map[county][]int{
+		{countyKey{"AL", 1001}, "Autauga County"}:      {0, 10, 20},
+		{countyKey{"AL", 1003}, "Baldwin County"}:      {0, 0, 30},
+		{countyKey{"AL", 0}, "Statewide Unallocated"}:  {0, 0, 50},
+		{countyKey{"NY", 36061}, "New York County"}:    {5, 5, 5},
+		{countyKey{"NY", 36999}, "Unknown Pop County"}: {0, 0, 10},
+	})
+	pops := map[countyKey]int{{"AL", 1001}: 1000, {"AL", 1003}: 4000, {"NY", 36061}: 100000}
+
+	got, err := mapValues(cases, pops, 2, 2, false)
+	if err != nil {
+		t.Fatal("mapValues failed for counties: ", err)
+	}
+	if diff := cmp.Diff(map[int]float64{1001: 2000, 1003: 750, 36061: 0}, got); diff != "" {
+		t.Error("Bad county values:\n" + diff)
+	}
+
+	got, err = mapValues(cases, pops, 2, 1, true)
+	if err != nil {
+		t.Fatal("mapValues failed for states: ", err)
+	}
+	if diff := cmp.Diff(map[int]float64{1: 1800, 36: 10}, got); diff != "" {
+		t.Error("Bad state values:\n" + diff)
+	}
+
+	if _, err := mapValues(cases, pops, 2, 3, false); err == nil {
+		t.Error("mapValues unexpectedly succeeded with insufficient data")
+	}
+}
+
+func TestWriteMapData(t *testing.T) {
+	shapes := filterShapes(map[int]*shape{
+		1001:  {fips: 1001, rings: []ring{{{-86, 32}, {-86, 33}, {-85, 33}}}},
+		1003:  {fips: 1003, rings: []ring{{{-88, 30}, {-88, 32}, {-86, 32}}}},
+		36061: {fips: 36061, rings: []ring{{{-74, 40}, {-74, 41}, {-73, 41}}}},
+	}, map[int]struct{}{1: {}}, false)
+	cs := &colorScale{stops: []int{0x000000, 0xffffff}, min: 0, max: 10}
+
+	var b bytes.Buffer
+	if err := writeMapData(&b, shapes, map[int]float64{1001: 10}, cs); err != nil {
+		t.Fatal("writeMapData failed: ", err)
+	}
+	// The larger Baldwin County should be drawn before Autauga County, and New York
+	// shouldn't be drawn at all. X coordinates are scaled by the cosine of the mean latitude.
+	x := func(lon float64) float64 { return lon * math.Cos(32*math.Pi/180) }
+	want := "# X\tY\tRGB\tValue\n" +
+		fmt.Sprintf("%0.5f\t30.00000\t14540253\tNaN\n", x(-88)) +
+		fmt.Sprintf("%0.5f\t32.00000\t14540253\tNaN\n", x(-88)) +
+		fmt.Sprintf("%0.5f\t32.00000\t14540253\tNaN\n", x(-86)) +
+		"\n" +
+		fmt.Sprintf("%0.5f\t32.00000\t16777215\t10.0\n", x(-86)) +
+		fmt.Sprintf("%0.5f\t33.00000\t16777215\t10.0\n", x(-86)) +
+		fmt.Sprintf("%0.5f\t33.00000\t16777215\t10.0\n", x(-85)) +
+		"\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Error("writeMapData wrote bad data:\n" + diff)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Valid values for correctionOptions.mode.
+const (
+	correctNone         = "none"         // leave daily increases unchanged
+	correctClamp        = "clamp"        // replace bad days' increases with 0 or the baseline
+	correctRedistribute = "redistribute" // move bad days' excess back over prior days
+)
+
+// correctionModes lists the valid values for correctionOptions.mode.
+var correctionModes = []string{correctNone, correctClamp, correctRedistribute}
+
+// correctionOptions configures series.correct.
+type correctionOptions struct {
+	mode          string  // correctNone, correctClamp, or correctRedistribute
+	outlierFactor float64 // days above this multiple of the baseline are outliers; 0 to disable
+	outlierMin    int     // minimum excess over the baseline for outliers
+	baselineDays  int     // number of preceding days averaged to compute the baseline
+	lookback      int     // number of preceding days over which excess is redistributed
+}
+
+// correction describes a change made to a day's increase by series.correct.
+type correction struct {
+	c        *county   // county whose data was corrected
+	day      int       // index of the increase returned by daily
+	date     time.Time // day of the increase
+	kind     string    // "negative" or "outlier"
+	orig     int       // original increase
+	fixed    int       // corrected increase
+	moved    int       // amount added to preceding days (negative if removed)
+	unplaced int       // amount that couldn't be removed from preceding days
+}
+
+// String returns a human-readable description of c suitable for logging.
+func (c correction) String() string {
+	s := fmt.Sprintf("%v %v (%v) %v: %v increase of %d changed to %d", c.c.state, c.c.fips, c.c.name,
+		c.date.Format("2006-01-02"), c.kind, c.orig, c.fixed)
+	if c.moved != 0 {
+		s += fmt.Sprintf(", %+d over prior days", c.moved)
+	}
+	if c.unplaced != 0 {
+		s += fmt.Sprintf(" (%d not placed)", c.unplaced)
+	}
+	return s
+}
+
+// correct detects negative and outlier daily increases in s's counts (e.g. due to
+// USAFacts correcting earlier data or reporting a backlog all at once) and fixes them
+// as described by opts. The corrected increases are returned by s.increases.
+// In redistribute mode, cumulative counts are also rewritten to match the corrected
+// increases (leaving final totals unchanged unless some excess couldn't be placed).
+// Clamping would change the totals, so cumulative counts are left alone in clamp mode.
+// Corrections are returned in the order of s.sortedCounties and then by date.
+func (s *series) correct(opts correctionOptions) ([]correction, error) {
+	switch opts.mode {
+	case correctNone:
+		return nil, nil
+	case correctClamp, correctRedistribute:
+	default:
+		return nil, fmt.Errorf("bad mode %q", opts.mode)
+	}
+
+	var corrs []correction
+	for _, k := range s.sortedCounties() {
+		cum := s.counts[k]
+		inc, cs := correctDaily(daily(cum), opts)
+		if len(cs) == 0 {
+			continue
+		}
+		for _, c := range cs {
+			c.c = s.counties[k]
+			c.date = s.dates[c.day+1]
+			corrs = append(corrs, c)
+		}
+		if s.incs == nil {
+			s.incs = make(map[countyKey][]int)
+		}
+		s.incs[k] = inc
+		if opts.mode == correctRedistribute {
+			for i, v := range inc {
+				cum[i+1] = cum[i] + v
+			}
+		}
+	}
+	return corrs, nil
+}
+
+// correctDaily returns a corrected copy of inc, a slice of daily increases.
+// The returned corrections' county and date fields are unset.
+func correctDaily(inc []int, opts correctionOptions) ([]int, []correction) {
+	inc = append([]int(nil), inc...)
+	var corrs []correction
+	for i, v := range inc {
+		var kind string
+		var target int
+		if v < 0 {
+			kind, target = "negative", 0
+		} else if base, ok := baseline(inc[:i], opts.baselineDays); ok && opts.outlierFactor > 0 &&
+			float64(v) > opts.outlierFactor*math.Max(base, 1) && float64(v)-base >= float64(opts.outlierMin) {
+			kind, target = "outlier", int(math.Round(base))
+		} else {
+			continue
+		}
+
+		c := correction{day: i, kind: kind, orig: v, fixed: target}
+		if opts.mode == correctRedistribute {
+			start := i - opts.lookback
+			if start < 0 {
+				start = 0
+			}
+			c.moved = v - target
+			c.unplaced = spread(inc[start:i], c.moved)
+			c.moved -= c.unplaced
+		}
+		inc[i] = target
+		corrs = append(corrs, c)
+	}
+	return inc, corrs
+}
+
+// baseline returns the mean of the last n values of inc.
+// false is returned if fewer than n values are present.
+func baseline(inc []int, n int) (float64, bool) {
+	if n <= 0 || len(inc) < n {
+		return 0, false
+	}
+	var sum int
+	for _, v := range inc[len(inc)-n:] {
+		sum += v
+	}
+	return float64(sum) / float64(n), true
+}
+
+// spread adds amount to vals in proportion to their existing (non-negative) values,
+// or evenly if they're all zero. Values never become negative. Any portion of a
+// negative amount that can't be removed is returned.
+func spread(vals []int, amount int) (unplaced int) {
+	if len(vals) == 0 || amount == 0 {
+		return amount
+	}
+	var total int
+	for _, v := range vals {
+		total += v
+	}
+	if amount < 0 && -amount >= total {
+		for i := range vals {
+			vals[i] = 0
+		}
+		return amount + total
+	}
+
+	weight := func(i int) float64 {
+		if total == 0 {
+			return 1 / float64(len(vals))
+		}
+		return float64(vals[i]) / float64(total)
+	}
+	left := amount
+	shares := make([]int, len(vals))
+	for i := range vals {
+		shares[i] = int(float64(amount) * weight(i)) // truncates toward zero
+		left -= shares[i]
+	}
+	// Place the remainder one unit at a time, starting with the most recent days.
+	step := 1
+	if left < 0 {
+		step = -1
+	}
+	for left != 0 {
+		placed := false
+		for i := len(vals) - 1; i >= 0 && left != 0; i-- {
+			if weight(i) > 0 && vals[i]+shares[i]+step >= 0 {
+				shares[i] += step
+				left -= step
+				placed = true
+			}
+		}
+		if !placed {
+			break
+		}
+	}
+	for i := range vals {
+		vals[i] += shares[i]
+	}
+	return left
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCorrectDaily(t *testing.T) {
+	opts := correctionOptions{outlierFactor: 5, outlierMin: 20, baselineDays: 3, lookback: 4}
+	for _, tc := range []struct {
+		mode  string
+		in    []int
+		want  []int
+		corrs []correction
+	}{
+		{
+			// Negative days are clamped to 0, and outliers to the baseline.
+			mode:  correctClamp,
+			in:    []int{10, 10, 10, -6, 10, 100, 10},
+			want:  []int{10, 10, 10, 0, 10, 7, 10},
+			corrs: []correction{{day: 3, kind: "negative", orig: -6}, {day: 5, kind: "outlier", orig: 100, fixed: 7}},
+		},
+		{
+			// Negative days are removed from prior days in proportion to their values.
+			mode:  correctRedistribute,
+			in:    []int{0, 10, 30, -8, 10},
+			want:  []int{0, 8, 24, 0, 10},
+			corrs: []correction{{day: 3, kind: "negative", orig: -8, moved: -8}},
+		},
+		{
+			// Outliers' excess over the baseline is moved to the preceding lookback days.
+			mode:  correctRedistribute,
+			in:    []int{10, 10, 10, 10, 10, 10, 90},
+			want:  []int{10, 10, 30, 30, 30, 30, 10},
+			corrs: []correction{{day: 6, kind: "outlier", orig: 90, fixed: 10, moved: 80}},
+		},
+		{
+			// Negative values that can't be absorbed are reported.
+			mode:  correctRedistribute,
+			in:    []int{2, 1, -5},
+			want:  []int{0, 0, 0},
+			corrs: []correction{{day: 2, kind: "negative", orig: -5, moved: -3, unplaced: -2}},
+		},
+		{
+			// Small spikes aren't outliers.
+			mode: correctClamp,
+			in:   []int{1, 1, 1, 15, 1},
+			want: []int{1, 1, 1, 15, 1},
+		},
+	} {
+		o := opts
+		o.mode = tc.mode
+		got, corrs := correctDaily(tc.in, o)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("correctDaily(%v) with %q returned bad values:\n%s", tc.in, tc.mode, diff)
+		}
+		if diff := cmp.Diff(tc.corrs, corrs, cmp.AllowUnexported(correction{})); diff != "" {
+			t.Errorf("correctDaily(%v) with %q returned bad corrections:\n%s", tc.in, tc.mode, diff)
+		}
+	}
+}
+
+func TestSeries_Correct(t *testing.T) {
+	autauga := county{countyKey{"AL", 1001}, "Autauga County"}
+	s := makeSeries(map[county][]int{autauga: {5, 10, 8, 12}})
+	corrs, err := s.correct(correctionOptions{mode: correctRedistribute, lookback: 7})
+	if err != nil {
+		t.Fatal("correct failed: ", err)
+	}
+	// The -2 on the third day should be taken from the second day's increase,
+	// leaving the final cumulative count unchanged.
+	if diff := cmp.Diff([]int{5, 8, 8, 12}, s.counts[autauga.countyKey]); diff != "" {
+		t.Error("Bad corrected counts:\n" + diff)
+	}
+	if len(corrs) != 1 || !corrs[0].date.Equal(s.dates[2]) || corrs[0].c.name != autauga.name {
+		t.Errorf("Got corrections %v; want one for %v on %v", corrs, autauga.name, s.dates[2])
+	}
+
+	// Clamping should only change the daily increases, not the cumulative counts.
+	s = makeSeries(map[county][]int{autauga: {5, 10, 8, 12}})
+	if _, err := s.correct(correctionOptions{mode: correctClamp}); err != nil {
+		t.Fatal("correct failed: ", err)
+	}
+	if diff := cmp.Diff([]int{5, 10, 8, 12}, s.counts[autauga.countyKey]); diff != "" {
+		t.Error("Clamping changed counts:\n" + diff)
+	}
+	if diff := cmp.Diff([]int{5, 0, 4}, s.increases(autauga.countyKey)); diff != "" {
+		t.Error("Bad clamped increases:\n" + diff)
+	}
+	if diff := cmp.Diff([]int{5, 0, 4}, s.stateDaily("AL")); diff != "" {
+		t.Error("Bad clamped state increases:\n" + diff)
+	}
+
+	if _, err := s.correct(correctionOptions{mode: "bogus"}); err == nil {
+		t.Error("correct unexpectedly succeeded with bad mode")
+	}
+}
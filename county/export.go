@@ -0,0 +1,43 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"github.com/derat/covid/obs"
+)
+
+// records returns daily records containing s's increases as metric m for each county,
+// each state (including statewide unallocated counts), and the entire US.
+// Unallocated counts aren't exported separately. The last date is used as the snapshot.
+func (s *series) records(m obs.Metric) []obs.Record {
+	if len(s.dates) < 2 {
+		return nil
+	}
+	snap := obs.Day(s.dates[len(s.dates)-1])
+	var recs []obs.Record
+	add := func(geo string, inc []int) {
+		for i, v := range inc {
+			recs = append(recs, obs.Record{
+				Date:     obs.Day(s.dates[i+1]),
+				Period:   obs.Daily,
+				Geo:      geo,
+				Metric:   m,
+				Value:    float64(v),
+				Source:   obs.USAFacts,
+				Snapshot: snap,
+			})
+		}
+	}
+	for _, k := range s.sortedCounties() {
+		if !s.counties[k].unallocated() {
+			add(obs.CountyGeo(k.fips), s.increases(k))
+		}
+	}
+	for _, st := range s.states() {
+		add(st, s.stateDaily(st))
+	}
+	add(obs.US, s.stateDaily(""))
+	obs.Sort(recs)
+	return recs
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derat/covid/obs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSeries_Records(t *testing.T) {
+	s := makeSeries(map[county][]int{
+		{countyKey{"AL", 1001}, "Autauga County"}:       {0, 5, 7},
+		{countyKey{"AL", 0}, "Statewide Unallocated"}:   {0, 1, 1},
+		{countyKey{"AL", 1999}, "Unallocated/Probable"}: {0, 0, 0},
+		{countyKey{"AK", 2020}, "Anchorage"}:            {3, 3, 4},
+	})
+	rec := func(d int, geo string, v float64) obs.Record {
+		return obs.Record{Date: time.Date(2020, 6, d, 0, 0, 0, 0, time.UTC), Period: obs.Daily,
+			Geo: geo, Metric: obs.Cases, Value: v, Source: obs.USAFacts,
+			Snapshot: time.Date(2020, 6, 3, 0, 0, 0, 0, time.UTC)}
+	}
+	want := []obs.Record{
+		rec(2, "01001", 5),
+		rec(2, "02020", 0),
+		rec(2, "AK", 0),
+		rec(2, "AL", 6),
+		rec(2, "US", 6),
+		rec(3, "01001", 2),
+		rec(3, "02020", 1),
+		rec(3, "AK", 1),
+		rec(3, "AL", 2),
+		rec(3, "US", 3),
+	}
+	if diff := cmp.Diff(want, s.records(obs.Cases)); diff != "" {
+		t.Error("Bad records:\n" + diff)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// hotspot describes recent case growth in a county.
+type hotspot struct {
+	key     countyKey
+	name    string
+	pop     int
+	recent  int     // new cases in the most recent window
+	prev    int     // new cases in the preceding window
+	growth  float64 // daily exponential growth rate, e.g. 0.05 for 5%; NaN if unknown
+	doubleT float64 // doubling time in days; +Inf if not growing, NaN if unknown
+	per100k float64 // new cases per 100,000 people in the most recent window
+}
+
+// hotspotOptions configures findHotspots.
+type hotspotOptions struct {
+	window int    // window size in days
+	minPop int    // minimum county population
+	sortBy string // "incidence", "growth", or "doubling"
+}
+
+// Valid values for hotspotOptions.sortBy.
+var hotspotSorts = []string{"incidence", "growth", "doubling"}
+
+// findHotspots returns hotspots for the counties in cases for the day at index end of cases.dates,
+// ranked as described by opts. Unallocated rows and counties with populations below opts.minPop
+// are excluded.
+func findHotspots(cases *series, pops map[countyKey]int, end int, opts hotspotOptions) ([]*hotspot, error) {
+	if opts.window <= 0 {
+		return nil, fmt.Errorf("bad window %d", opts.window)
+	}
+	if end < 0 || end >= len(cases.dates) {
+		return nil, fmt.Errorf("bad date index %d", end)
+	}
+	if end-2*opts.window < 0 {
+		return nil, fmt.Errorf("need %d days of data before %v", 2*opts.window,
+			cases.dates[end].Format("2006-01-02"))
+	}
+
+	var hs []*hotspot
+	for k, c := range cases.counties {
+		pop := pops[k]
+		if c.unallocated() || pop <= 0 || pop < opts.minPop {
+			continue
+		}
+		inc := cases.increases(k)
+		h := &hotspot{
+			key:    k,
+			name:   c.name,
+			pop:    pop,
+			recent: sumWindow(inc, end, opts.window),
+			prev:   sumWindow(inc, end-opts.window, opts.window),
+		}
+		h.per100k = 100000 * float64(h.recent) / float64(pop)
+		h.growth, h.doubleT = math.NaN(), math.NaN()
+		if h.recent > 0 && h.prev > 0 {
+			h.growth = math.Log(float64(h.recent)/float64(h.prev)) / float64(opts.window)
+			h.doubleT = math.Inf(1)
+			if h.growth > 0 {
+				h.doubleT = math.Ln2 / h.growth
+			}
+		}
+		hs = append(hs, h)
+	}
+
+	// Returns true if a should be ranked before b for the supplied value,
+	// placing NaN values at the end.
+	before := func(a, b float64, desc bool) (less, decided bool) {
+		switch {
+		case math.IsNaN(a) && math.IsNaN(b), a == b:
+			return false, false
+		case math.IsNaN(a):
+			return false, true
+		case math.IsNaN(b):
+			return true, true
+		case desc:
+			return a > b, true
+		default:
+			return a < b, true
+		}
+	}
+
+	var key func(h *hotspot) (float64, bool)
+	switch opts.sortBy {
+	case "incidence":
+		key = func(h *hotspot) (float64, bool) { return h.per100k, true }
+	case "growth":
+		key = func(h *hotspot) (float64, bool) { return h.growth, true }
+	case "doubling":
+		key = func(h *hotspot) (float64, bool) { return h.doubleT, false }
+	default:
+		return nil, fmt.Errorf("bad sort %q", opts.sortBy)
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		a, desc := key(hs[i])
+		b, _ := key(hs[j])
+		if less, ok := before(a, b, desc); ok {
+			return less
+		}
+		// Break ties by incidence and then by state and FIPS code.
+		if less, ok := before(hs[i].per100k, hs[j].per100k, true); ok {
+			return less
+		}
+		if hs[i].key.state != hs[j].key.state {
+			return hs[i].key.state < hs[j].key.state
+		}
+		return hs[i].key.fips < hs[j].key.fips
+	})
+	return hs, nil
+}
+
+// hotspotColumns contains column names used when writing hotspots.
+var hotspotColumns = []string{
+	"Rank", "countyFIPS", "County Name", "State", "Population",
+	"New Cases", "Previous Cases", "Per 100k", "Daily Growth (%)", "Doubling Time (days)",
+}
+
+// strings returns h's values as strings, using the same order as hotspotColumns.
+func (h *hotspot) strings(rank int) []string {
+	return []string{
+		strconv.Itoa(rank), strconv.Itoa(h.key.fips), h.name, h.key.state, strconv.Itoa(h.pop),
+		strconv.Itoa(h.recent), strconv.Itoa(h.prev), formatRate(h.per100k),
+		formatRate(100 * h.growth), formatRate(h.doubleT),
+	}
+}
+
+// writeHotspots writes hs to w in the supplied format ("text", "csv", or "json").
+func writeHotspots(w io.Writer, hs []*hotspot, format string) error {
+	switch format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+		row := func(vals []string) {
+			for _, v := range vals {
+				fmt.Fprintf(tw, "%s\t", v)
+			}
+			fmt.Fprintln(tw)
+		}
+		row(hotspotColumns)
+		for i, h := range hs {
+			row(h.strings(i + 1))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(hotspotColumns)
+		for i, h := range hs {
+			cw.Write(h.strings(i + 1))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		type jsonHotspot struct {
+			Rank       int      `json:"rank"`
+			FIPS       int      `json:"countyFIPS"`
+			Name       string   `json:"countyName"`
+			State      string   `json:"state"`
+			Population int      `json:"population"`
+			Recent     int      `json:"newCases"`
+			Prev       int      `json:"previousCases"`
+			Per100k    float64  `json:"per100k"`
+			Growth     *float64 `json:"dailyGrowth"`  // null if unknown
+			DoubleT    *float64 `json:"doublingTime"` // null if unknown or not growing
+		}
+		finite := func(v float64) *float64 {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil
+			}
+			return &v
+		}
+		out := make([]jsonHotspot, len(hs))
+		for i, h := range hs {
+			out[i] = jsonHotspot{i + 1, h.key.fips, h.name, h.key.state, h.pop, h.recent, h.prev,
+				h.per100k, finite(h.growth), finite(h.doubleT)}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	default:
+		return fmt.Errorf("bad format %q", format)
+	}
+}
+
+// writeHotspotData writes gnuplot data for plotting the daily new cases per 100,000 people
+// (as a 7-day average) of hs over the numDays days ending at index end of cases.dates.
+// Each county's data is written as a separate data block. Days without 7 preceding
+// days of data are omitted, so an error is returned if end is less than 7.
+func writeHotspotData(w io.Writer, cases *series, hs []*hotspot, end, numDays int) error {
+	if numDays <= 0 {
+		return fmt.Errorf("bad number of days %d", numDays)
+	}
+	if end < 7 || end >= len(cases.dates) {
+		return fmt.Errorf("bad date index %d for 7-day averages", end)
+	}
+	start := end - numDays + 1
+	if start < 7 {
+		start = 7
+	}
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	for i, h := range hs {
+		if i > 0 {
+			printf("\n\n")
+		}
+		printf("Date\tPer100k\n")
+		inc := cases.increases(h.key)
+		for j := start; j <= end; j++ {
+			avg := float64(sumWindow(inc, j, 7)) / 7
+			printf("%s\t%0.2f\n", cases.dates[j].Format("2006-01-02"), 100000*avg/float64(h.pop))
+		}
+	}
+	return err
+}
+
+// plotHotspots writes a small-multiples plot of hs's recent incidence to imgPath using
+// theme (which may be nil). If keep is true, the gnuplot script is left alongside imgPath.
+func plotHotspots(imgPath string, cases *series, hs []*hotspot, end, numDays int, sortBy string,
+	theme *gnuplot.Theme, keep bool) error {
+	var b bytes.Buffer
+	if err := writeHotspotData(&b, cases, hs, end, numDays); err != nil {
+		return err
+	}
+
+	titles := make([]string, len(hs))
+	for i, h := range hs {
+		titles[i] = gnuplot.Quote(h.name + ", " + h.key.state)
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(len(hs)))))
+	rows := (len(hs) + cols - 1) / cols
+	td, err := gnuplot.NewTemplateData(imgPath, theme, time.Now(), map[string]interface{}{
+		"Titles": titles,
+		"SortBy": sortBy,
+		"Rows":   rows,
+		"Cols":   cols,
+	})
+	if err != nil {
+		return err
+	}
+	opts := gnuplot.KeepOptions(imgPath, keep)
+	opts.Data = b.Bytes()
+	return gnuplot.ExecTemplateOptions(hotspotsTmpl, td, opts)
+}
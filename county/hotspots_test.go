@@ -0,0 +1,138 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// makeSeries returns a series with the supplied cumulative counts, starting on 2020-06-01.
+func makeSeries(counts map[county][]int) *series {
+	s := &series{counties: make(map[countyKey]*county), counts: make(map[countyKey][]int)}
+	for c, cum := range counts {
+		c := c
+		s.counties[c.countyKey] = &c
+		s.counts[c.countyKey] = cum
+		for len(s.dates) < len(cum) {
+			s.dates = append(s.dates, time.Date(2020, 6, 1+len(s.dates), 0, 0, 0, 0, time.UTC))
+		}
+	}
+	return s
+}
+
+func TestFindHotspots(t *testing.T) {
+	small := county{countyKey{"AL", 1001}, "Small County"}
+	growing := county{countyKey{"AL", 1003}, "Growing County"}
+	big := county{countyKey{"AK", 2020}, "Big County"}
+	unalloc := county{countyKey{"AL", 0}, "Statewide Unallocated"}
+	cases := makeSeries(map[county][]int{
+		small:   {0, 5, 10, 15, 20},
+		growing: {0, 1, 2, 6, 10},
+		big:     {0, 100, 200, 300, 400},
+		unalloc: {0, 100, 200, 500, 900},
+	})
+	pops := map[countyKey]int{small.countyKey: 1000, growing.countyKey: 10000, big.countyKey: 1000000}
+
+	names := func(hs []*hotspot) []string {
+		var ns []string
+		for _, h := range hs {
+			ns = append(ns, h.name)
+		}
+		return ns
+	}
+
+	for _, tc := range []struct {
+		opts hotspotOptions
+		want []string
+	}{
+		{hotspotOptions{2, 0, "incidence"}, []string{"Small County", "Growing County", "Big County"}},
+		{hotspotOptions{2, 5000, "incidence"}, []string{"Growing County", "Big County"}},
+		{hotspotOptions{2, 0, "growth"}, []string{"Growing County", "Small County", "Big County"}},
+		{hotspotOptions{2, 0, "doubling"}, []string{"Growing County", "Small County", "Big County"}},
+	} {
+		hs, err := findHotspots(cases, pops, 4, tc.opts)
+		if err != nil {
+			t.Errorf("findHotspots(%+v) failed: %v", tc.opts, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, names(hs)); diff != "" {
+			t.Errorf("findHotspots(%+v) returned bad ranking:\n%s", tc.opts, diff)
+		}
+	}
+
+	hs, _ := findHotspots(cases, pops, 4, hotspotOptions{2, 5000, "growth"})
+	g := hs[0] // 8 new cases after 2
+	if g.recent != 8 || g.prev != 2 || g.per100k != 80 {
+		t.Errorf("Got recent=%v prev=%v per100k=%v; want 8, 2, 80", g.recent, g.prev, g.per100k)
+	}
+	if want := math.Ln2 / (math.Log(4) / 2); math.Abs(g.doubleT-want) > 0.001 {
+		t.Errorf("Got doubling time %v; want %v", g.doubleT, want)
+	}
+
+	if _, err := findHotspots(cases, pops, 3, hotspotOptions{2, 0, "incidence"}); err == nil {
+		t.Error("findHotspots unexpectedly succeeded with insufficient data")
+	}
+	if _, err := findHotspots(cases, pops, 5, hotspotOptions{2, 0, "incidence"}); err == nil {
+		t.Error("findHotspots unexpectedly succeeded with out-of-range index")
+	}
+}
+
+func TestWriteHotspotData(t *testing.T) {
+	c := county{countyKey{"AL", 1001}, "Autauga County"}
+	cum := make([]int, 10)
+	for i := range cum {
+		cum[i] = 7 * i
+	}
+	cases := makeSeries(map[county][]int{c: cum})
+	hs := []*hotspot{{key: c.countyKey, name: c.name, pop: 100000}}
+
+	for _, tc := range []struct {
+		end, numDays int
+		want         string // empty if an error is expected
+	}{
+		{9, 2, "Date\tPer100k\n2020-06-09\t7.00\n2020-06-10\t7.00\n"},
+		{8, 5, "Date\tPer100k\n2020-06-08\t7.00\n2020-06-09\t7.00\n"}, // starts at first full week
+		{7, 1, "Date\tPer100k\n2020-06-08\t7.00\n"},
+		{3, 1, ""}, // small -window values can leave too few days for averages
+		{9, 0, ""},
+	} {
+		var b bytes.Buffer
+		err := writeHotspotData(&b, cases, hs, tc.end, tc.numDays)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("writeHotspotData(..., %d, %d) unexpectedly succeeded", tc.end, tc.numDays)
+			}
+		} else if err != nil {
+			t.Errorf("writeHotspotData(..., %d, %d) failed: %v", tc.end, tc.numDays, err)
+		} else if got := b.String(); got != tc.want {
+			t.Errorf("writeHotspotData(..., %d, %d) wrote %q; want %q", tc.end, tc.numDays, got, tc.want)
+		}
+	}
+}
+
+func TestWriteHotspots(t *testing.T) {
+	hs := []*hotspot{{
+		key: countyKey{"AL", 1001}, name: "Autauga County", pop: 1000,
+		recent: 10, prev: 0, per100k: 1000, growth: math.NaN(), doubleT: math.NaN(),
+	}}
+	for format, want := range map[string]string{
+		"csv": "Rank,countyFIPS,County Name,State,Population,New Cases,Previous Cases,Per 100k," +
+			"Daily Growth (%),Doubling Time (days)\n1,1001,Autauga County,AL,1000,10,0,1000.0,,\n",
+		"json": `"dailyGrowth": null`,
+		"text": "Autauga County",
+	} {
+		var b bytes.Buffer
+		if err := writeHotspots(&b, hs, format); err != nil {
+			t.Errorf("writeHotspots(..., %q) failed: %v", format, err)
+		} else if !strings.Contains(b.String(), want) {
+			t.Errorf("writeHotspots(..., %q) wrote %q; want %q", format, b.String(), want)
+		}
+	}
+}
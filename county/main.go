@@ -0,0 +1,321 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/filewriter"
+	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/obs"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] <out-dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	action := flag.String("action", "daily", `Action to perform ("daily", "rates", "hotspots", "map", "export")`)
+	confirmedPath := flag.String("confirmed", "covid_confirmed_usafacts.csv", "USAFacts confirmed cases CSV file")
+	deathsPath := flag.String("deaths", "covid_deaths_usafacts.csv", "USAFacts deaths CSV file")
+	popPath := flag.String("population", "covid_county_population_usafacts.csv", "USAFacts county population CSV file")
+	dateStr := flag.String("date", "", "Date as YYYY-MM-DD for rates and hotspots (empty for latest)")
+	var hsOpts hotspotOptions
+	flag.IntVar(&hsOpts.window, "window", 7, "Window in days for computing hotspots' growth and incidence and map values")
+	flag.IntVar(&hsOpts.minPop, "min-pop", 10000, "Minimum population of counties to include in hotspots")
+	flag.StringVar(&hsOpts.sortBy, "sort", "incidence",
+		fmt.Sprintf("Value used to rank hotspots (%s)", strings.Join(hotspotSorts, ", ")))
+	hsFormat := flag.String("format", "text", `Format of hotspots table ("text", "csv", "json")`)
+	hsTop := flag.Int("top", 20, "Number of hotspots to list and plot (0 for all in table)")
+	hsPlotDays := flag.Int("plot-days", 56, "Number of days to show in hotspots plot")
+	var corrOpts correctionOptions
+	flag.StringVar(&corrOpts.mode, "corrections", correctNone,
+		fmt.Sprintf("How to fix negative and outlier daily increases (%s)", strings.Join(correctionModes, ", ")))
+	flag.Float64Var(&corrOpts.outlierFactor, "outlier-factor", 10,
+		"Treat daily increases above this multiple of the baseline as outliers (0 to disable)")
+	flag.IntVar(&corrOpts.outlierMin, "outlier-min", 50, "Minimum excess over the baseline for outliers")
+	flag.IntVar(&corrOpts.baselineDays, "baseline-days", 7, "Number of preceding days averaged for outlier baseline")
+	flag.IntVar(&corrOpts.lookback, "lookback", 28, "Number of preceding days to redistribute corrections over")
+	boundaryPath := flag.String("boundary", "", `GeoJSON (".json", ".geojson") or shapefile (".shp") boundaries for map`)
+	fipsProp := flag.String("fips-prop", "", `Boundary property containing FIPS codes (e.g. "GEOID"; empty to detect)`)
+	mapLevel := flag.String("map-level", "county", `Areas to shade in map ("county", "state")`)
+	mapFormat := flag.String("map-format", string(gnuplot.PNG), `Map image format ("png", "svg", "pdf", "html")`)
+	mapStates := flag.String("map-states", "", `Comma-separated states to include in map, e.g. "NY,NJ" (empty for all)`)
+	colors := flag.String("colors", "#ffffcc,#fed976,#fd8d3c,#e31a1c,#800026", "Comma-separated colors for map scale")
+	var cs colorScale
+	flag.Float64Var(&cs.min, "scale-min", 0, "Value at bottom of map scale")
+	flag.Float64Var(&cs.max, "scale-max", 0, "Value at top of map scale (0 for 95th percentile)")
+	flag.BoolVar(&cs.log, "log-scale", false, "Use logarithmic map scale")
+	themeName := flag.String("theme", gnuplot.DefaultTheme,
+		fmt.Sprintf("Plot theme (%s)", strings.Join(gnuplot.ThemeNames(), ", ")))
+	keepScripts := flag.Bool("keep-scripts", false, "Keep gnuplot scripts next to plots for debugging")
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	outDir := flag.Arg(0)
+
+	theme, err := gnuplot.LookupTheme(*themeName)
+	if err != nil {
+		log.Fatal("Bad -theme: ", err)
+	}
+
+	var date time.Time
+	if *dateStr != "" {
+		var err error
+		if date, err = time.Parse("2006-01-02", *dateStr); err != nil {
+			log.Fatalf("Bad -date %q: %v", *dateStr, err)
+		}
+	}
+
+	cases, err := readSeriesFile(*confirmedPath)
+	if err != nil {
+		log.Fatalf("Failed reading %v: %v", *confirmedPath, err)
+	}
+	deaths, err := readSeriesFile(*deathsPath)
+	if err != nil {
+		log.Fatalf("Failed reading %v: %v", *deathsPath, err)
+	}
+	for _, in := range []struct {
+		name string
+		s    *series
+	}{{"cases", cases}, {"deaths", deaths}} {
+		corrs, err := in.s.correct(corrOpts)
+		if err != nil {
+			log.Fatal("Bad -corrections: ", err)
+		}
+		for _, c := range corrs {
+			log.Printf("Corrected %v: %v", in.name, c)
+		}
+		if len(corrs) > 0 {
+			log.Printf("Made %d correction(s) to %v", len(corrs), in.name)
+		}
+	}
+	pops, err := readPopulationFile(*popPath)
+	if err != nil {
+		log.Fatalf("Failed reading %v: %v", *popPath, err)
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatal("Failed creating output dir: ", err)
+	}
+
+	switch *action {
+	case "daily":
+		for _, out := range []struct {
+			fn    string                                                 // output file, e.g. "county_daily_cases.csv"
+			s     *series                                                // input data
+			write func(w *csv.Writer, s *series, pops map[countyKey]int) // writes data
+		}{
+			{"county_daily_cases.csv", cases, writeCountyDaily},
+			{"county_daily_deaths.csv", deaths, writeCountyDaily},
+			{"state_daily_cases.csv", cases, writeStateDaily},
+			{"state_daily_deaths.csv", deaths, writeStateDaily},
+		} {
+			if err := writeCSV(filepath.Join(outDir, out.fn), func(w *csv.Writer) {
+				out.write(w, out.s, pops)
+			}); err != nil {
+				log.Fatalf("Failed writing %v: %v", out.fn, err)
+			}
+		}
+	case "rates":
+		ci, di, err := dateIndexes(cases, deaths, date)
+		if err != nil {
+			log.Fatal("Bad date: ", err)
+		}
+		var missingPop int
+		if err := writeCSV(filepath.Join(outDir, "county_rates.csv"), func(w *csv.Writer) {
+			missingPop = writeCountyRates(w, cases, deaths, pops, ci, di)
+		}); err != nil {
+			log.Fatal("Failed writing county rates: ", err)
+		}
+		if missingPop > 0 {
+			log.Printf("%d county(s) lack population data", missingPop)
+		}
+		if err := writeCSV(filepath.Join(outDir, "state_rates.csv"), func(w *csv.Writer) {
+			writeStateRates(w, cases, deaths, pops, ci, di)
+		}); err != nil {
+			log.Fatal("Failed writing state rates: ", err)
+		}
+	case "hotspots":
+		end, err := cases.dateIndex(date)
+		if err != nil {
+			log.Fatal("Bad date: ", err)
+		}
+		hs, err := findHotspots(cases, pops, end, hsOpts)
+		if err != nil {
+			log.Fatal("Failed finding hotspots: ", err)
+		}
+		if *hsTop > 0 && len(hs) > *hsTop {
+			hs = hs[:*hsTop]
+		}
+		ext := map[string]string{"text": ".txt", "csv": ".csv", "json": ".json"}[*hsFormat]
+		if ext == "" {
+			log.Fatalf("Invalid -format %q", *hsFormat)
+		}
+		fw := filewriter.New(filepath.Join(outDir, "hotspots"+ext))
+		werr := writeHotspots(fw, hs, *hsFormat)
+		if err := fw.Close(); err != nil {
+			log.Fatal("Failed writing hotspots: ", err)
+		} else if werr != nil {
+			log.Fatal("Failed writing hotspots: ", werr)
+		}
+		if *hsTop > 0 && len(hs) > 0 {
+			// The plot shows 7-day averages, which small -window values may not leave room for.
+			if end < 7 {
+				log.Printf("Not plotting hotspots: need 7 days of data before %v",
+					cases.dates[end].Format("2006-01-02"))
+			} else if err := plotHotspots(filepath.Join(outDir, "hotspots.png"), cases, hs, end,
+				*hsPlotDays, hsOpts.sortBy, theme, *keepScripts); err != nil {
+				log.Fatal("Failed plotting hotspots: ", err)
+			}
+		}
+	case "map":
+		if *boundaryPath == "" {
+			log.Fatal("-boundary is required for maps")
+		}
+		states := *mapLevel == "state"
+		if !states && *mapLevel != "county" {
+			log.Fatalf("Invalid -map-level %q", *mapLevel)
+		}
+		format, err := gnuplot.ParseFormat(*mapFormat)
+		if err != nil {
+			log.Fatal("Bad -map-format: ", err)
+		}
+		if cs.stops, err = parseColors(*colors); err != nil {
+			log.Fatal("Bad -colors: ", err)
+		}
+		var codes map[int]struct{}
+		if *mapStates != "" {
+			codes = make(map[int]struct{})
+			all := cases.stateFIPS()
+			for _, st := range strings.Split(*mapStates, ",") {
+				st = strings.ToUpper(strings.TrimSpace(st))
+				code, ok := all[st]
+				if !ok {
+					log.Fatalf("Unknown state %q in -map-states", st)
+				}
+				codes[code] = struct{}{}
+			}
+		}
+
+		end, err := cases.dateIndex(date)
+		if err != nil {
+			log.Fatal("Bad date: ", err)
+		}
+		vals, err := mapValues(cases, pops, end, hsOpts.window, states)
+		if err != nil {
+			log.Fatal("Failed computing map values: ", err)
+		}
+		shapes, err := readBoundaryFile(*boundaryPath, *fipsProp)
+		if err != nil {
+			log.Fatalf("Failed reading %v: %v", *boundaryPath, err)
+		}
+		drawn := filterShapes(shapes, codes, states)
+		if len(drawn) == 0 {
+			log.Fatal("No boundaries to draw")
+		}
+		shown := make(map[int]float64)
+		for _, s := range drawn {
+			if v, ok := vals[s.fips]; ok {
+				shown[s.fips] = v
+			}
+		}
+		cs.setRange(shown)
+
+		title := fmt.Sprintf("USAFacts new COVID-19 cases per 100,000 people, %d days ending %s",
+			hsOpts.window, cases.dates[end].Format("2006-01-02"))
+		p := filepath.Join(outDir, *mapLevel+"_map"+format.Ext())
+		if err := plotMap(p, drawn, shown, &cs, title, theme, *keepScripts); err != nil {
+			log.Fatal("Failed plotting map: ", err)
+		}
+	case "export":
+		recs := append(cases.records(obs.Cases), deaths.records(obs.Deaths)...)
+		obs.Sort(recs)
+		fw := filewriter.New(filepath.Join(outDir, "records.csv"))
+		werr := obs.WriteCSV(fw, recs)
+		if err := fw.Close(); err != nil {
+			log.Fatal("Failed writing records: ", err)
+		} else if werr != nil {
+			log.Fatal("Failed writing records: ", werr)
+		}
+	default:
+		log.Fatalf("Invalid action %q", *action)
+	}
+}
+
+// writeCSV calls f to write CSV data to a new file at p.
+func writeCSV(p string, f func(w *csv.Writer)) error {
+	fw := filewriter.New(p)
+	cw := csv.NewWriter(fw)
+	f(cw)
+	cw.Flush()
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// dateHeader returns a CSV header row starting with the supplied columns
+// and followed by s.dates[1:], i.e. the dates with known daily increases.
+func dateHeader(s *series, cols ...string) []string {
+	row := append([]string{}, cols...)
+	for _, d := range s.dates[1:] {
+		row = append(row, d.Format("2006-01-02"))
+	}
+	return row
+}
+
+// appendInts appends the supplied values to row as strings.
+func appendInts(row []string, vals []int) []string {
+	for _, v := range vals {
+		row = append(row, strconv.Itoa(v))
+	}
+	return row
+}
+
+// writeCountyDaily writes per-county daily increases from s to w:
+//
+//  countyFIPS,County Name,State,Population,2020-01-23,2020-01-24,...
+//  0,Statewide Unallocated,AL,0,0,0,...
+//  1001,Autauga County,AL,55869,0,0,...
+func writeCountyDaily(w *csv.Writer, s *series, pops map[countyKey]int) {
+	w.Write(dateHeader(s, "countyFIPS", "County Name", "State", "Population"))
+	for _, k := range s.sortedCounties() {
+		c := s.counties[k]
+		row := []string{strconv.Itoa(k.fips), c.name, k.state, strconv.Itoa(pops[k])}
+		w.Write(appendInts(row, s.increases(k)))
+	}
+}
+
+// writeStateDaily writes per-state daily increases from s to w, followed by a total row:
+//
+//  State,Population,2020-01-23,2020-01-24,...
+//  AK,731545,0,0,...
+//  ...
+//  Total,328239523,1,0,...
+func writeStateDaily(w *csv.Writer, s *series, pops map[countyKey]int) {
+	w.Write(dateHeader(s, "State", "Population"))
+	statePops := make(map[string]int)
+	var totalPop int
+	for k, p := range pops {
+		statePops[k.state] += p
+		totalPop += p
+	}
+	for _, st := range s.states() {
+		row := []string{st, strconv.Itoa(statePops[st])}
+		w.Write(appendInts(row, s.stateDaily(st)))
+	}
+	w.Write(appendInts([]string{"Total", strconv.Itoa(totalPop)}, s.stateDaily("")))
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unallocated returns true if c is a catch-all row (e.g. "Statewide Unallocated"
+// or "New York City Unallocated/Probable") rather than an actual county.
+// These rows have no population of their own, but their counts belong to their states.
+func (c *county) unallocated() bool {
+	return c.fips < 1000 || strings.Contains(c.name, "Unallocated")
+}
+
+// rates describes recent activity in an area.
+type rates struct {
+	avg7      float64 // 7-day average of daily increases
+	per100k7  float64 // increase over last 7 days per 100,000 people; NaN if population unknown
+	per100k14 float64 // increase over last 14 days per 100,000 people; NaN if population unknown
+	ok        bool    // false if insufficient data was available
+}
+
+// computeRates returns rates for the day at index end of a series's dates,
+// where inc contains daily increases indexed like the series's dates[1:]
+// (e.g. as returned by series.increases). If pop is non-positive, per-capita
+// rates are not computed.
+func computeRates(inc []int, end, pop int) rates {
+	if end < 14 || end > len(inc) {
+		return rates{}
+	}
+	r := rates{avg7: float64(sumWindow(inc, end, 7)) / 7, ok: true}
+	if pop > 0 {
+		r.per100k7 = 100000 * float64(sumWindow(inc, end, 7)) / float64(pop)
+		r.per100k14 = 100000 * float64(sumWindow(inc, end, 14)) / float64(pop)
+	} else {
+		r.per100k7 = math.NaN()
+		r.per100k14 = math.NaN()
+	}
+	return r
+}
+
+// strings formats r's values for a CSV row. Unknown values are empty.
+func (r rates) strings() []string {
+	if !r.ok {
+		return []string{"", "", ""}
+	}
+	return []string{formatRate(r.avg7), formatRate(r.per100k7), formatRate(r.per100k14)}
+}
+
+// formatRate formats v with one decimal place, or returns an empty string if v is NaN.
+func formatRate(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// dateIndex returns the index of d within s.dates, or the last index if d is zero.
+func (s *series) dateIndex(d time.Time) (int, error) {
+	if d.IsZero() {
+		return len(s.dates) - 1, nil
+	}
+	for i, sd := range s.dates {
+		if sd.Equal(d) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no data for %v", d.Format("2006-01-02"))
+}
+
+// dateIndexes returns the indexes of date within cases.dates and deaths.dates.
+// If date is zero, the last date in cases is used.
+func dateIndexes(cases, deaths *series, date time.Time) (ci, di int, err error) {
+	if ci, err = cases.dateIndex(date); err != nil {
+		return -1, -1, fmt.Errorf("cases: %v", err)
+	}
+	if di, err = deaths.dateIndex(cases.dates[ci]); err != nil {
+		return -1, -1, fmt.Errorf("deaths: %v", err)
+	}
+	return ci, di, nil
+}
+
+// sumWindow returns the sum of the n daily increases in inc (indexed like a series's
+// dates[1:]) ending at the day at index end of the dates. The caller must ensure
+// that 0 <= end-n and end <= len(inc).
+func sumWindow(inc []int, end, n int) int {
+	var sum int
+	for _, v := range inc[end-n : end] {
+		sum += v
+	}
+	return sum
+}
+
+// rateHeader returns header columns for cases and deaths rates.
+func rateHeader() []string {
+	return []string{
+		"Cases (7-day avg)", "Cases per 100k (7 days)", "Cases per 100k (14 days)",
+		"Deaths (7-day avg)", "Deaths per 100k (7 days)", "Deaths per 100k (14 days)",
+	}
+}
+
+// writeCountyRates writes per-county rates to w for the day at index ci in cases.dates
+// and di in deaths.dates:
+//
+//  countyFIPS,County Name,State,Population,Cases (7-day avg),...
+//  0,Statewide Unallocated,AL,,12.3,,,...
+//  1001,Autauga County,AL,55869,20.1,251.8,480.3,...
+//
+// Per-capita rates are omitted for unallocated rows and counties without
+// population data. The number of counties without population data is returned.
+func writeCountyRates(w *csv.Writer, cases, deaths *series, pops map[countyKey]int, ci, di int) int {
+	missingPop := 0
+	w.Write(append([]string{"countyFIPS", "County Name", "State", "Population"}, rateHeader()...))
+	for _, k := range cases.sortedCounties() {
+		c := cases.counties[k]
+		pop := pops[k]
+		popStr := strconv.Itoa(pop)
+		if c.unallocated() {
+			pop = 0
+			popStr = ""
+		} else if pop <= 0 {
+			missingPop++
+			popStr = ""
+		}
+		row := []string{strconv.Itoa(k.fips), c.name, k.state, popStr}
+		row = append(row, computeRates(cases.increases(k), ci, pop).strings()...)
+		row = append(row, computeRates(deaths.increases(k), di, pop).strings()...)
+		w.Write(row)
+	}
+	return missingPop
+}
+
+// writeStateRates writes per-state rates to w as in writeCountyRates, followed by a total row:
+//
+//  State,Population,Cases (7-day avg),...
+//  AK,731545,140.4,134.3,...
+//  ...
+//  Total,328239523,...
+//
+// Counts from unallocated rows are included in their states' rates.
+func writeStateRates(w *csv.Writer, cases, deaths *series, pops map[countyKey]int, ci, di int) {
+	statePops := make(map[string]int)
+	var totalPop int
+	for k, p := range pops {
+		statePops[k.state] += p
+		totalPop += p
+	}
+
+	// state is passed to series.stateDaily, so an empty string selects all counties.
+	writeRow := func(name string, pop int, state string) {
+		row := []string{name, strconv.Itoa(pop)}
+		row = append(row, computeRates(cases.stateDaily(state), ci, pop).strings()...)
+		row = append(row, computeRates(deaths.stateDaily(state), di, pop).strings()...)
+		w.Write(row)
+	}
+
+	w.Write(append([]string{"State", "Population"}, rateHeader()...))
+	for _, st := range cases.states() {
+		writeRow(st, statePops[st], st)
+	}
+	writeRow("Total", totalPop, "")
+}
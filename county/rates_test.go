@@ -0,0 +1,66 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestComputeRates(t *testing.T) {
+	inc := make([]int, 15)
+	for i := range inc {
+		inc[i] = 10
+	}
+	for _, tc := range []struct {
+		end, pop int
+		want     rates
+	}{
+		{15, 100000, rates{avg7: 10, per100k7: 70, per100k14: 140, ok: true}},
+		{14, 200000, rates{avg7: 10, per100k7: 35, per100k14: 70, ok: true}},
+		{15, 0, rates{avg7: 10, per100k7: math.NaN(), per100k14: math.NaN(), ok: true}},
+		{13, 100000, rates{}}, // not enough data for 14-day rate
+	} {
+		got := computeRates(inc, tc.end, tc.pop)
+		if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(rates{}), cmpopts.EquateNaNs()); diff != "" {
+			t.Errorf("computeRates(..., %d, %d) returned bad rates:\n%s", tc.end, tc.pop, diff)
+		}
+	}
+}
+
+func TestComputeRates_Clamped(t *testing.T) {
+	autauga := county{countyKey{"AL", 1001}, "Autauga County"}
+	cum := make([]int, 16)
+	for i := range cum {
+		cum[i] = 10 * i
+	}
+	cum[15] += 100 // backlog reported on the last day
+	s := makeSeries(map[county][]int{autauga: cum})
+	if _, err := s.correct(correctionOptions{mode: correctClamp, outlierFactor: 3, baselineDays: 7}); err != nil {
+		t.Fatal("correct failed: ", err)
+	}
+	// The clamped increases should be used rather than the cumulative counts.
+	got := computeRates(s.increases(autauga.countyKey), 15, 0)
+	if got.avg7 != 10 {
+		t.Errorf("Got clamped 7-day average %v; want 10", got.avg7)
+	}
+}
+
+func TestCounty_Unallocated(t *testing.T) {
+	for _, tc := range []struct {
+		c    county
+		want bool
+	}{
+		{county{countyKey{"AL", 0}, "Statewide Unallocated"}, true},
+		{county{countyKey{"NY", 1}, "New York City Unallocated/Probable"}, true},
+		{county{countyKey{"AL", 1001}, "Autauga County"}, false},
+	} {
+		if got := tc.c.unallocated(); got != tc.want {
+			t.Errorf("unallocated() for %q = %v; want %v", tc.c.name, got, tc.want)
+		}
+	}
+}
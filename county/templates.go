@@ -0,0 +1,56 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+const hotspotsTmpl = `
+{{.SetTerm}}
+{{.SetOutput}}
+
+set timefmt '%Y-%m-%d'
+set xdata time
+set format x '%m/%d'
+set xtics rotate by 45 right font ',12'
+set ytics font ',12'
+set yrange [0:*]
+set grid xtics ytics
+set key off
+{{.FooterLabel}}
+{{.ThemeCmds}}
+
+set multiplot layout {{.Vars.Rows}},{{.Vars.Cols}} \
+  title "{/*0.9 USAFacts daily new COVID-19 cases per 100,000 people (7-day average)}\n" . \
+        "{/*0.7 Top {{len .Vars.Titles}} counties by {{.Vars.SortBy}}}"
+{{range $i, $title := .Vars.Titles -}}
+set title {{$title}} font ',14'
+plot {{$.Data}} index {{$i}} using 1:2 with lines lc rgb '#c62828' lw 2 notitle
+{{end -}}
+unset multiplot
+`
+
+const mapTmpl = `
+{{.SetTerm}}
+{{.SetOutput}}
+
+set title {{.Vars.Title}}
+{{.ThemeCmds}}
+set size ratio -1
+unset border
+unset tics
+unset key
+{{.Vars.Palette}}
+set cbrange [{{.Vars.Min}}:{{.Vars.Max}}]
+{{if .Vars.Log}}set logscale cb{{end}}
+set cbtics font ',14'
+set colorbox vertical user origin 0.9,0.2 size 0.025,0.6
+{{if .Vars.Missing -}}
+set label 'No data' at screen 0.9,0.15 font ',14' textcolor rgb '#555555'
+set object rectangle from screen 0.87,0.14 to screen 0.885,0.16 fc rgb '{{.Vars.NoData}}' fs solid noborder
+{{end -}}
+{{.FooterLabel}}
+
+# The final invisible plot uses the palette so the color box is drawn.
+plot {{.Data}} using 1:2:3 with filledcurves closed fc rgb variable notitle, \
+  {{.Data}} using 1:2 with lines lc rgb '#ffffff' lw 0.25 notitle, \
+  {{.Data}} using 1:2:4 with points ps 0 lc palette z notitle
+`
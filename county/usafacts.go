@@ -0,0 +1,288 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/input"
+)
+
+// countyKey uniquely identifies a county. FIPS codes alone are insufficient,
+// since USAFacts uses 0 for each state's "Statewide Unallocated" row.
+type countyKey struct {
+	state string // two-letter abbreviation, e.g. "AL"
+	fips  int    // county FIPS code, e.g. 1001
+}
+
+// county describes a county.
+type county struct {
+	countyKey
+	name string // e.g. "Autauga County" or "Statewide Unallocated"
+}
+
+// series holds per-county cumulative counts from one of the USAFacts CSV files, e.g.
+//
+//  countyFIPS,County Name,State,stateFIPS,1/22/20,1/23/20,...
+//  0,Statewide Unallocated,AL,1,0,0,...
+//  1001,Autauga County,AL,1,0,0,...
+type series struct {
+	dates    []time.Time           // dates of counts
+	counties map[countyKey]*county // info about counties in counts
+	counts   map[countyKey][]int   // cumulative counts, indexed like dates
+	incs     map[countyKey][]int   // corrected daily increases set by correct, indexed like dates[1:]
+}
+
+// Layouts used by USAFacts for date column headers.
+var dateLayouts = []string{"1/2/06", "2006-01-02"}
+
+// readSeriesFile reads a series from the CSV file at p.
+func readSeriesFile(p string) (*series, error) {
+	f, err := input.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSeries(f)
+}
+
+// readSeries reads a series from a USAFacts CSV file containing cumulative confirmed cases or deaths.
+func readSeries(r io.Reader) (*series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // rows sometimes have trailing empty fields
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading header: %v", err)
+	}
+	cols, err := findColumns(header, "countyFIPS", "County Name", "State")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &series{
+		counties: make(map[countyKey]*county),
+		counts:   make(map[countyKey][]int),
+	}
+	var dateCols []int
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, h); err == nil {
+				if len(s.dates) > 0 && !t.After(s.dates[len(s.dates)-1]) {
+					return nil, fmt.Errorf("date column %q out of order", h)
+				}
+				s.dates = append(s.dates, t)
+				dateCols = append(dateCols, i)
+				break
+			}
+		}
+	}
+	if len(s.dates) == 0 {
+		return nil, fmt.Errorf("no date columns")
+	}
+
+	for {
+		vals, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(vals) <= cols[2] || strings.TrimSpace(strings.Join(vals, "")) == "" {
+			continue // skip blank rows
+		}
+
+		c, err := parseCounty(vals, cols)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := s.counties[c.countyKey]; ok {
+			return nil, fmt.Errorf("duplicate county %v (%v, %v)", c.fips, c.name, c.state)
+		}
+
+		counts := make([]int, len(dateCols))
+		for i, col := range dateCols {
+			if col >= len(vals) {
+				return nil, fmt.Errorf("%v (%v, %v) missing %v", c.fips, c.name, c.state,
+					s.dates[i].Format("2006-01-02"))
+			}
+			if counts[i], err = parseCount(vals[col]); err != nil {
+				return nil, fmt.Errorf("%v (%v, %v) has bad count for %v: %v", c.fips, c.name, c.state,
+					s.dates[i].Format("2006-01-02"), err)
+			}
+		}
+		s.counties[c.countyKey] = c
+		s.counts[c.countyKey] = counts
+	}
+	return s, nil
+}
+
+// readPopulationFile reads county populations from the CSV file at p.
+func readPopulationFile(p string) (map[countyKey]int, error) {
+	f, err := input.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readPopulation(f)
+}
+
+// readPopulation reads county populations from a USAFacts CSV file, e.g.
+//
+//  countyFIPS,County Name,State,population
+//  0,Statewide Unallocated,AL,0
+//  1001,Autauga County,AL,55869
+func readPopulation(r io.Reader) (map[countyKey]int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading header: %v", err)
+	}
+	cols, err := findColumns(header, "countyFIPS", "County Name", "State", "population")
+	if err != nil {
+		return nil, err
+	}
+
+	pops := make(map[countyKey]int)
+	for {
+		vals, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(vals) <= cols[3] || strings.TrimSpace(strings.Join(vals, "")) == "" {
+			continue
+		}
+		c, err := parseCounty(vals, cols)
+		if err != nil {
+			return nil, err
+		}
+		if pops[c.countyKey], err = parseCount(vals[cols[3]]); err != nil {
+			return nil, fmt.Errorf("%v (%v, %v) has bad population: %v", c.fips, c.name, c.state, err)
+		}
+	}
+	return pops, nil
+}
+
+// findColumns returns the positions of the named columns within header.
+func findColumns(header []string, names ...string) ([]int, error) {
+	cols := make([]int, len(names))
+	for i, name := range names {
+		cols[i] = -1
+		for j, h := range header {
+			if strings.TrimSpace(strings.TrimLeft(h, "\ufeff")) == name {
+				cols[i] = j
+				break
+			}
+		}
+		if cols[i] < 0 {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return cols, nil
+}
+
+// parseCounty parses a county from vals, using the FIPS, name, and state
+// positions supplied in the first three elements of cols.
+func parseCounty(vals []string, cols []int) (*county, error) {
+	fips, err := strconv.Atoi(strings.TrimSpace(vals[cols[0]]))
+	if err != nil {
+		return nil, fmt.Errorf("bad FIPS code %q: %v", vals[cols[0]], err)
+	}
+	return &county{
+		countyKey: countyKey{state: strings.TrimSpace(vals[cols[2]]), fips: fips},
+		name:      strings.TrimSpace(vals[cols[1]]),
+	}, nil
+}
+
+// parseCount parses a non-negative count. Empty strings are treated as 0.
+func parseCount(s string) (int, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", "", -1)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// sortedCounties returns the keys of s.counties, sorted by state and then by FIPS code.
+func (s *series) sortedCounties() []countyKey {
+	keys := make([]countyKey, 0, len(s.counties))
+	for k := range s.counties {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].state != keys[j].state {
+			return keys[i].state < keys[j].state
+		}
+		return keys[i].fips < keys[j].fips
+	})
+	return keys
+}
+
+// states returns the sorted two-letter abbreviations of the states in s.
+func (s *series) states() []string {
+	seen := make(map[string]struct{})
+	var states []string
+	for k := range s.counties {
+		if _, ok := seen[k.state]; !ok {
+			seen[k.state] = struct{}{}
+			states = append(states, k.state)
+		}
+	}
+	sort.Strings(states)
+	return states
+}
+
+// daily returns per-day increases in the supplied cumulative counts.
+// The returned slice is one shorter than cum, since the first day's increase is unknown.
+func daily(cum []int) []int {
+	if len(cum) == 0 {
+		return nil
+	}
+	inc := make([]int, len(cum)-1)
+	for i := range inc {
+		inc[i] = cum[i+1] - cum[i]
+	}
+	return inc
+}
+
+// increases returns per-day increases for the county with key k, indexed like s.dates[1:].
+// Corrected increases are returned if s.correct changed the county's data.
+func (s *series) increases(k countyKey) []int {
+	if inc, ok := s.incs[k]; ok {
+		return inc
+	}
+	return daily(s.counts[k])
+}
+
+// stateDaily returns per-day increases summed across all of the counties in state,
+// indexed like s.dates[1:]. If state is empty, all counties are included.
+func (s *series) stateDaily(state string) []int {
+	if len(s.dates) == 0 {
+		return nil
+	}
+	sums := make([]int, len(s.dates)-1)
+	for k := range s.counts {
+		if state != "" && k.state != state {
+			continue
+		}
+		for i, v := range s.increases(k) {
+			sums[i] += v
+		}
+	}
+	return sums
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadSeries(t *testing.T) {
+	const in = "\ufeffcountyFIPS,County Name,State,stateFIPS,1/22/20,1/23/20,1/24/20,\n" +
+		"0,Statewide Unallocated,AL,1,0,1,1,\n" +
+		"1001,Autauga County,AL,1,2,3,5,\n" +
+		"2158,\"Kusilvak Census Area, AK\",AK,2,0,0,4\n" +
+		",,,,,,\n"
+	s, err := readSeries(strings.NewReader(in))
+	if err != nil {
+		t.Fatal("readSeries failed: ", err)
+	}
+
+	wantDates := []time.Time{
+		time.Date(2020, 1, 22, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 23, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 24, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(wantDates, s.dates); diff != "" {
+		t.Error("Bad dates:\n" + diff)
+	}
+
+	unalloc := countyKey{"AL", 0}
+	autauga := countyKey{"AL", 1001}
+	kusilvak := countyKey{"AK", 2158}
+	if diff := cmp.Diff([]countyKey{kusilvak, unalloc, autauga}, s.sortedCounties(),
+		cmp.AllowUnexported(countyKey{})); diff != "" {
+		t.Error("Bad counties:\n" + diff)
+	}
+	if name := s.counties[kusilvak].name; name != "Kusilvak Census Area, AK" {
+		t.Errorf("Got name %q for %v", name, kusilvak)
+	}
+	if diff := cmp.Diff([]int{2, 3, 5}, s.counts[autauga]); diff != "" {
+		t.Errorf("Bad counts for %v:\n%s", autauga, diff)
+	}
+
+	if diff := cmp.Diff([]int{2, 2}, s.stateDaily("AL")); diff != "" {
+		t.Error("Bad daily increases for AL:\n" + diff)
+	}
+	if diff := cmp.Diff([]int{2, 6}, s.stateDaily("")); diff != "" {
+		t.Error("Bad total daily increases:\n" + diff)
+	}
+}
+
+func TestReadPopulation(t *testing.T) {
+	const in = "countyFIPS,County Name,State,population\n" +
+		"0,Statewide Unallocated,AL,0\n" +
+		"1001,Autauga County,AL,55869\n" +
+		"2158,\"Kusilvak Census Area, AK\",AK,8314\n"
+	pops, err := readPopulation(strings.NewReader(in))
+	if err != nil {
+		t.Fatal("readPopulation failed: ", err)
+	}
+	want := map[countyKey]int{{"AL", 0}: 0, {"AL", 1001}: 55869, {"AK", 2158}: 8314}
+	if diff := cmp.Diff(want, pops, cmp.AllowUnexported(countyKey{})); diff != "" {
+		t.Error("Bad populations:\n" + diff)
+	}
+}
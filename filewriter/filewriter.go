@@ -5,28 +5,85 @@
 package filewriter
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
+// defaultMode is the permission mode used for files if Options.Mode is zero.
+const defaultMode = 0644
+
+// Options configures how a FileWriter writes its file.
+type Options struct {
+	// Sync causes Close to fsync the file before renaming it and to fsync its
+	// directory afterward, so the file survives crashes.
+	Sync bool
+	// Mode is the file's permission mode. 0644 is used if zero.
+	Mode os.FileMode
+	// Compress causes data to be compressed using gzip or zstd if the path ends
+	// in ".gz" or ".zst", respectively.
+	Compress bool
+}
+
 // FileWriter writes to a temp file and later atomically renames it.
 // If a write error occurs, it is saved internally and future writes become no-ops.
 // Callers can ignore write errors and just check the return value from Close.
 type FileWriter struct {
-	p   string   // target filename
-	f   *os.File // temp file; nil if creation failed
-	err error    // first error encountered
+	p    string         // target filename
+	f    *os.File       // temp file; nil if creation failed
+	w    io.Writer      // f or c
+	c    io.WriteCloser // compressor writing to f; nil if uncompressed
+	sync bool           // fsync file and dir in Close
+	err  error          // first error encountered
 }
 
-// New returns a new FileWriter to write to the supplied path.
+// New returns a new FileWriter to write to the supplied path using default options.
 func New(p string) *FileWriter {
+	return NewOptions(p, nil)
+}
+
+// NewOptions returns a new FileWriter to write to the supplied path using opts,
+// which may be nil.
+func NewOptions(p string, opts *Options) *FileWriter {
+	if opts == nil {
+		opts = &Options{}
+	}
 	f, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".*")
 	if err != nil {
-		return &FileWriter{"", nil, err}
+		return &FileWriter{err: err}
+	}
+	fw := &FileWriter{p: p, f: f, w: f, sync: opts.Sync}
+
+	// TempFile creates files with mode 0600.
+	mode := opts.Mode
+	if mode == 0 {
+		mode = defaultMode
+	}
+	if fw.err = f.Chmod(mode); fw.err != nil {
+		return fw
+	}
+
+	if opts.Compress {
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".gz":
+			fw.c = gzip.NewWriter(f)
+		case ".zst":
+			var enc *zstd.Encoder
+			if enc, fw.err = zstd.NewWriter(f); fw.err == nil {
+				fw.c = enc
+			}
+		}
+		if fw.c != nil {
+			fw.w = fw.c
+		}
 	}
-	return &FileWriter{p, f, nil}
+	return fw
 }
 
 // Write writes the supplied bytes to the file as in io.Writer.
@@ -34,7 +91,7 @@ func New(p string) *FileWriter {
 func (fw *FileWriter) Write(p []byte) (int, error) {
 	var n int
 	if fw.err == nil {
-		n, fw.err = fw.f.Write(p)
+		n, fw.err = fw.w.Write(p)
 	}
 	return n, fw.err
 }
@@ -44,7 +101,18 @@ func (fw *FileWriter) Write(p []byte) (int, error) {
 func (fw *FileWriter) Printf(format string, args ...interface{}) (int, error) {
 	var n int
 	if fw.err == nil {
-		n, fw.err = fmt.Fprintf(fw.f, format, args...)
+		n, fw.err = fmt.Fprintf(fw.w, format, args...)
+	}
+	return n, fw.err
+}
+
+// ReadFrom copies data from r to the file until EOF as in io.ReaderFrom.
+// This lets io.Copy use the operating system's fast paths for uncompressed files.
+// If an error occurred earlier, nothing is read and the earlier error is returned.
+func (fw *FileWriter) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	if fw.err == nil {
+		n, fw.err = io.Copy(fw.w, r)
 	}
 	return n, fw.err
 }
@@ -56,6 +124,12 @@ func (fw *FileWriter) Close() error {
 		return fw.err
 	}
 	defer os.Remove(fw.f.Name()) // no-op if we successfully rename temp file
+	if fw.c != nil && fw.err == nil {
+		fw.err = fw.c.Close()
+	}
+	if fw.sync && fw.err == nil {
+		fw.err = fw.f.Sync()
+	}
 	cerr := fw.f.Close()
 	if fw.err != nil {
 		return fw.err
@@ -63,5 +137,37 @@ func (fw *FileWriter) Close() error {
 	if cerr != nil {
 		return cerr
 	}
-	return os.Rename(fw.f.Name(), fw.p)
+	if err := os.Rename(fw.f.Name(), fw.p); err != nil {
+		return err
+	}
+	if fw.sync {
+		return syncDir(filepath.Dir(fw.p))
+	}
+	return nil
+}
+
+// Discard removes the temp file without renaming it. It should be called instead of
+// Close if the caller fails to produce the file's data, e.g. due to a read error.
+func (fw *FileWriter) Discard() error {
+	if fw.f == nil { // failed to create temp file
+		return nil
+	}
+	if fw.c != nil {
+		fw.c.Close()
+	}
+	fw.f.Close()
+	return os.Remove(fw.f.Name())
+}
+
+// syncDir fsyncs the directory at p so that renames within it are durable.
+func syncDir(p string) error {
+	d, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	serr := d.Sync()
+	if err := d.Close(); err != nil {
+		return err
+	}
+	return serr
 }
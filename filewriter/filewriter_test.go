@@ -0,0 +1,111 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package filewriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFileWriter(t *testing.T) {
+	td, err := ioutil.TempDir("", "filewriter_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+
+	const data = "first line\nsecond line\n"
+	for _, tc := range []struct {
+		name   string
+		opts   *Options
+		mode   os.FileMode
+		decomp func(r io.Reader) (io.Reader, error)
+	}{
+		{"plain.txt", nil, 0644, nil},
+		{"mode.txt", &Options{Mode: 0640, Sync: true}, 0640, nil},
+		{"uncompressed.gz", nil, 0644, nil},
+		{"compressed.gz", &Options{Compress: true}, 0644,
+			func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"compressed.zst", &Options{Compress: true, Sync: true}, 0644,
+			func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+	} {
+		p := filepath.Join(td, tc.name)
+		fw := NewOptions(p, tc.opts)
+		fw.Printf("first line\n")
+		// Use io.Copy to exercise ReadFrom.
+		if _, err := io.Copy(fw, strings.NewReader("second line\n")); err != nil {
+			t.Errorf("Copying to %v failed: %v", tc.name, err)
+		}
+		if err := fw.Close(); err != nil {
+			t.Errorf("Closing %v failed: %v", tc.name, err)
+			continue
+		}
+
+		if fi, err := os.Stat(p); err != nil {
+			t.Errorf("Failed checking %v: %v", tc.name, err)
+		} else if fi.Mode().Perm() != tc.mode {
+			t.Errorf("%v has mode %v; want %v", tc.name, fi.Mode().Perm(), tc.mode)
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Errorf("Failed reading %v: %v", tc.name, err)
+			continue
+		}
+		if tc.decomp != nil {
+			r, err := tc.decomp(bytes.NewReader(b))
+			if err != nil {
+				t.Errorf("Failed decompressing %v: %v", tc.name, err)
+				continue
+			}
+			if b, err = ioutil.ReadAll(r); err != nil {
+				t.Errorf("Failed decompressing %v: %v", tc.name, err)
+				continue
+			}
+		}
+		if string(b) != data {
+			t.Errorf("%v contains %q; want %q", tc.name, b, data)
+		}
+	}
+
+	// Temp files shouldn't be left behind.
+	if names := listDir(t, td); len(names) != 5 {
+		t.Errorf("Dir contains %q", names)
+	}
+}
+
+func TestFileWriter_CreateError(t *testing.T) {
+	fw := New("/nonexistent-dir/file.txt")
+	if _, err := fw.Printf("foo"); err == nil {
+		t.Error("Printf unexpectedly succeeded")
+	}
+	if err := fw.Close(); err == nil {
+		t.Error("Close unexpectedly succeeded")
+	}
+}
+
+func TestFileWriter_Discard(t *testing.T) {
+	td, err := ioutil.TempDir("", "filewriter_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+
+	fw := NewOptions(filepath.Join(td, "file.gz"), &Options{Compress: true})
+	fw.Printf("foo")
+	if err := fw.Discard(); err != nil {
+		t.Error("Discard failed: ", err)
+	}
+	if names := listDir(t, td); len(names) != 0 {
+		t.Errorf("Dir contains %q after discarding", names)
+	}
+}
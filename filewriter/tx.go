@@ -0,0 +1,209 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package filewriter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Tx writes a set of files to a directory as a single transaction.
+// Files are written to a staging directory alongside the target directory
+// and are only published when Commit is called, so readers never see a mix
+// of old and new files.
+//
+// The target directory is published as a symlink to the staging directory,
+// which Commit atomically replaces. If the target directory is initially a
+// real directory, the first Commit moves it aside and puts a symlink in its
+// place, restoring the directory if that fails.
+//
+// Files in the target directory that weren't written in the transaction are
+// carried over, so the published directory contains both.
+type Tx struct {
+	dir   string // target directory
+	stage string // staging directory
+	done  bool   // true after Commit or Rollback
+}
+
+// stageInfix is inserted between the target directory's name and a random
+// string to name staging directories, e.g. "plots.tx-123456". Commit only
+// removes a symlink's previous target if it has a name like this.
+const stageInfix = ".tx-"
+
+// rename is called to rename files. It's a variable so tests can inject failures.
+var rename = os.Rename
+
+// Begin starts a new transaction for dir, which need not exist yet.
+// The caller must call Commit or Rollback to remove the staging directory.
+func Begin(dir string) (*Tx, error) {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return nil, err
+	}
+	stage, err := ioutil.TempDir(filepath.Dir(dir), filepath.Base(dir)+stageInfix)
+	if err != nil {
+		return nil, err
+	}
+	// TempDir creates the directory with mode 0700, which would be preserved on publish.
+	if err := os.Chmod(stage, 0755); err != nil {
+		os.RemoveAll(stage)
+		return nil, err
+	}
+	return &Tx{dir: dir, stage: stage}, nil
+}
+
+// Path returns the path in the staging directory at which the file with the
+// supplied name should be written, e.g. by an external program.
+func (tx *Tx) Path(name string) string {
+	return filepath.Join(tx.stage, name)
+}
+
+// New returns a FileWriter that writes the file with the supplied name to the staging
+// directory. The FileWriter must be closed before Commit is called.
+func (tx *Tx) New(name string) *FileWriter {
+	return New(tx.Path(name))
+}
+
+// Commit publishes the staged files to the target directory.
+// If publishing fails, the target directory is left unchanged and the staging
+// directory is removed. Errors removing the previous version of the directory
+// after publishing are also returned.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction for %v already finished", tx.dir)
+	}
+	defer tx.Rollback() // no-op if the staging directory was published
+
+	fi, err := os.Lstat(tx.dir)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	isLink := exists && fi.Mode()&os.ModeSymlink != 0
+	if exists && !isLink && !fi.IsDir() {
+		return fmt.Errorf("%v isn't a directory", tx.dir)
+	}
+	if exists {
+		if err := carryOver(tx.dir, tx.stage); err != nil {
+			return err
+		}
+	}
+
+	var oldTarget string
+	if isLink {
+		if oldTarget, err = os.Readlink(tx.dir); err != nil {
+			return err
+		}
+	}
+	link := tx.stage + ".link"
+	if err := os.Symlink(filepath.Base(tx.stage), link); err != nil {
+		return err
+	}
+	defer os.Remove(link) // no-op if the link was renamed
+
+	if exists && !isLink {
+		return tx.migrate(link)
+	}
+	if err := rename(link, tx.dir); err != nil {
+		return err
+	}
+	tx.done = true
+	if isLink {
+		return tx.removeTarget(oldTarget)
+	}
+	return nil
+}
+
+// migrate replaces the real directory at tx.dir with the symlink at link.
+// The directory is renamed aside before the link is renamed into its place,
+// and it's renamed back if the second step fails.
+func (tx *Tx) migrate(link string) error {
+	old := tx.stage + ".old"
+	if err := rename(tx.dir, old); err != nil {
+		return err
+	}
+	if err := rename(link, tx.dir); err != nil {
+		if rerr := rename(old, tx.dir); rerr != nil {
+			return fmt.Errorf("%v (also failed restoring %v: %v)", err, tx.dir, rerr)
+		}
+		return err
+	}
+	tx.done = true
+	return os.RemoveAll(old)
+}
+
+// removeTarget removes target, the symlink's previous target, if it's a
+// staging directory created by an earlier transaction for tx.dir.
+// Other targets (e.g. a directory that the user manages) are left in place.
+func (tx *Tx) removeTarget(target string) error {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(tx.dir), target)
+	}
+	if filepath.Dir(target) != filepath.Dir(tx.dir) ||
+		!strings.HasPrefix(filepath.Base(target), filepath.Base(tx.dir)+stageInfix) {
+		return nil
+	}
+	return os.RemoveAll(target)
+}
+
+// Rollback removes the staging directory without publishing it.
+// It does nothing if the transaction has already been committed,
+// so it can be deferred after Begin.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	return os.RemoveAll(tx.stage)
+}
+
+// carryOver hard-links (or copies) regular files from dir into stage unless
+// files with the same names have already been staged. An error is returned if
+// dir contains other types of files that weren't staged.
+func carryOver(dir, stage string) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		src := filepath.Join(dir, fi.Name())
+		dst := filepath.Join(stage, fi.Name())
+		if _, err := os.Lstat(dst); err == nil {
+			continue // replaced by the transaction
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("can't carry over %v (not a regular file)", src)
+		}
+		if err := os.Link(src, dst); err != nil {
+			if err := copyFile(src, dst, fi.Mode()); err != nil {
+				return fmt.Errorf("failed copying %v: %v", src, err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyFile copies src to a new file at dst with the supplied mode.
+func copyFile(src, dst string, mode os.FileMode) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, werr := io.Copy(df, sf)
+	if err := df.Close(); err != nil {
+		return err
+	}
+	return werr
+}
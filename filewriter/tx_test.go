@@ -0,0 +1,251 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package filewriter
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readDir returns the contents of the regular files in dir keyed by name.
+func readDir(t *testing.T, dir string) map[string]string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Failed reading dir: ", err)
+	}
+	files := make(map[string]string)
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			t.Fatal("Failed reading file: ", err)
+		}
+		files[fi.Name()] = string(b)
+	}
+	return files
+}
+
+// listDir returns the sorted names of all entries in dir.
+func listDir(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal("Failed reading dir: ", err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeTx writes the supplied files using tx.
+func writeTx(t *testing.T, tx *Tx, files map[string]string) {
+	for name, data := range files {
+		fw := tx.New(name)
+		fw.Printf("%s", data)
+		if err := fw.Close(); err != nil {
+			t.Fatalf("Failed writing %v: %v", name, err)
+		}
+	}
+}
+
+func TestTx(t *testing.T) {
+	td, err := ioutil.TempDir("", "filewriter_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+	dir := filepath.Join(td, "out")
+
+	// The first transaction should create the directory.
+	tx, err := Begin(dir)
+	if err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"a.txt": "a1", "b.txt": "b1"})
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%v exists before commit", dir)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal("Commit failed: ", err)
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a1", "b.txt": "b1"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after first commit:\n" + diff)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		t.Error("Failed checking dir: ", err)
+	} else if fi.Mode().Perm() != 0755 {
+		t.Errorf("Dir has mode %v; want %v", fi.Mode().Perm(), os.FileMode(0755))
+	}
+
+	// A rolled-back transaction shouldn't change anything.
+	if tx, err = Begin(dir); err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"a.txt": "bad"})
+	if err := tx.Rollback(); err != nil {
+		t.Fatal("Rollback failed: ", err)
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a1", "b.txt": "b1"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after rollback:\n" + diff)
+	}
+
+	// Unstaged files should be carried over.
+	if tx, err = Begin(dir); err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"a.txt": "a2", "c.txt": "c2"})
+	if err := tx.Commit(); err != nil {
+		t.Fatal("Commit failed: ", err)
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a2", "b.txt": "b1", "c.txt": "c2"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after second commit:\n" + diff)
+	}
+
+	// Committing should fail without changing the dir if it contains a subdirectory.
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if tx, err = Begin(dir); err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"a.txt": "bad"})
+	if err := tx.Commit(); err == nil {
+		t.Error("Commit unexpectedly succeeded with subdirectory")
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a2", "b.txt": "b1", "c.txt": "c2"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after failed commit:\n" + diff)
+	}
+
+	// The dir should be published as a symlink, and old staging directories
+	// shouldn't be left behind.
+	if fi, err := os.Lstat(dir); err != nil {
+		t.Error("Failed checking dir: ", err)
+	} else if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("%v isn't a symlink", dir)
+	}
+	if names := listDir(t, td); len(names) != 2 {
+		t.Errorf("Parent dir contains %q; want symlink and target", names)
+	}
+}
+
+func TestTx_Symlink(t *testing.T) {
+	td, err := ioutil.TempDir("", "filewriter_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+
+	// Point a symlink at an initial version of the directory.
+	dir := filepath.Join(td, "out")
+	if err := os.Mkdir(dir+".orig", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir+".orig", "a.txt"), []byte("a1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("out.orig", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{"b1", "b2"} {
+		tx, err := Begin(dir)
+		if err != nil {
+			t.Fatal("Begin failed: ", err)
+		}
+		writeTx(t, tx, map[string]string{"b.txt": data})
+		if err := tx.Commit(); err != nil {
+			t.Fatal("Commit failed: ", err)
+		}
+		if diff := cmp.Diff(map[string]string{"a.txt": "a1", "b.txt": data}, readDir(t, dir)); diff != "" {
+			t.Errorf("Bad files after committing %q:\n%s", data, diff)
+		}
+		if fi, err := os.Lstat(dir); err != nil {
+			t.Error("Failed checking dir: ", err)
+		} else if fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%v is no longer a symlink", dir)
+		}
+		// The original target wasn't created by a transaction, so it should be
+		// left alone, but earlier staging directories should be removed.
+		if names := listDir(t, td); len(names) != 3 || names[0] != "out" || names[1] != "out.orig" {
+			t.Errorf("Parent dir contains %q; want symlink, original dir, and target", names)
+		}
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a1"}, readDir(t, dir+".orig")); diff != "" {
+		t.Error("Original dir changed:\n" + diff)
+	}
+}
+
+func TestTx_MigrateFailure(t *testing.T) {
+	td, err := ioutil.TempDir("", "filewriter_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+
+	dir := filepath.Join(td, "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make renaming the symlink into the directory's place fail.
+	defer func() { rename = os.Rename }()
+	rename = func(oldpath, newpath string) error {
+		if newpath == dir && strings.HasSuffix(oldpath, ".link") {
+			return errors.New("intentional failure")
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	tx, err := Begin(dir)
+	if err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"a.txt": "bad"})
+	if err := tx.Commit(); err == nil {
+		t.Fatal("Commit unexpectedly succeeded")
+	}
+
+	// The original directory should be restored.
+	if fi, err := os.Lstat(dir); err != nil {
+		t.Fatal("Failed checking dir: ", err)
+	} else if !fi.IsDir() {
+		t.Errorf("%v is no longer a directory", dir)
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a1"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after failed commit:\n" + diff)
+	}
+	if diff := cmp.Diff([]string{"out"}, listDir(t, td)); diff != "" {
+		t.Error("Bad entries in parent dir:\n" + diff)
+	}
+
+	// The migration should succeed once renaming works again.
+	rename = os.Rename
+	if tx, err = Begin(dir); err != nil {
+		t.Fatal("Begin failed: ", err)
+	}
+	writeTx(t, tx, map[string]string{"b.txt": "b1"})
+	if err := tx.Commit(); err != nil {
+		t.Fatal("Commit failed: ", err)
+	}
+	if diff := cmp.Diff(map[string]string{"a.txt": "a1", "b.txt": "b1"}, readDir(t, dir)); diff != "" {
+		t.Error("Bad files after commit:\n" + diff)
+	}
+	if names := listDir(t, td); len(names) != 2 {
+		t.Errorf("Parent dir contains %q; want symlink and target", names)
+	}
+}
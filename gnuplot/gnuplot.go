@@ -2,41 +2,266 @@
 // All rights reserved.
 
 // Package gnuplot makes it slightly easier to generate plots using gnuplot.
+// Scripts can be written as Go templates or generated from Plot descriptions.
 package gnuplot
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
+// DataBlock is the name of the data block defined by Options.Data.
+// Templates can plot it via e.g. "plot $DATA using 1:2".
+const DataBlock = "$DATA"
+
+// dataEnd terminates data blocks.
+const dataEnd = "EOD"
+
+// Options configures how gnuplot is run.
+type Options struct {
+	// Data, if non-nil, is defined as the DataBlock data block at the start of the script,
+	// making the script self-contained. Data must not contain a line consisting of "EOD".
+	Data []byte
+	// ScriptPath is the path to which the script is written before running gnuplot.
+	// If empty, a temp file is used and deleted afterward. Otherwise, the file is
+	// kept so it can be inspected or rerun.
+	ScriptPath string
+	// Warn is called with each warning printed by gnuplot, even if it succeeds.
+	// If nil, warnings are logged.
+	Warn func(msg string)
+}
+
+// KeepOptions returns options that keep the script that writes imgPath alongside it,
+// e.g. "out/plot.png.gnuplot", if keep is true. Default options are returned if keep is false.
+func KeepOptions(imgPath string, keep bool) *Options {
+	if !keep {
+		return &Options{}
+	}
+	return &Options{ScriptPath: imgPath + ".gnuplot"}
+}
+
+// Error is returned when gnuplot fails.
+type Error struct {
+	Err    error  // error returned by exec.Cmd.Run
+	Stdout string // stdout from gnuplot
+	Stderr string // stderr from gnuplot
+	Script string // path to kept script, or empty if the script was deleted
+	Line   int    // 1-indexed line in the script at which gnuplot reported an error, or 0
+	Text   string // text of Line in the script
+}
+
+func (e *Error) Error() string {
+	s := e.Err.Error()
+	if msg := strings.TrimSpace(e.Stderr); msg != "" {
+		s += fmt.Sprintf(": %q", msg)
+	}
+	if e.Line > 0 {
+		s += fmt.Sprintf(" (script line %d: %q)", e.Line, e.Text)
+	}
+	if e.Script != "" {
+		s += fmt.Sprintf(" (script kept at %v)", e.Script)
+	}
+	return s
+}
+
 // ExecTemplate executes the supplied Go template and data to write a .gnuplot file,
 // which it then passes to gnuplot.
 func ExecTemplate(tmpl string, data interface{}) error {
-	// Execute the template to write the .gnuplot file.
-	gf, err := ioutil.TempFile("", "gnuplot.")
+	return ExecTemplateOptions(tmpl, data, nil)
+}
+
+// ExecTemplateOptions is like ExecTemplate but runs gnuplot using opts, which may be nil.
+func ExecTemplateOptions(tmpl string, data interface{}, opts *Options) error {
+	var b bytes.Buffer
+	if err := execTemplate(&b, tmpl, data); err != nil {
+		return err
+	}
+	return Run(b.Bytes(), opts)
+}
+
+// TemplateData holds values commonly needed by templates that plot the DataBlock data
+// block (supplied via Options.Data) to an image file.
+type TemplateData struct {
+	Data        string // name of the data block, i.e. DataBlock
+	SetTerm     string // 'set term' command for writing the image using the theme
+	SetOutput   string // 'set output' command for writing to the image file
+	FooterLabel string // 'set label' command for writing footer label
+	ThemeCmds   string // commands coloring text and borders; must follow titles and labels
+
+	Vars map[string]interface{} // extra variables
+}
+
+// NewTemplateData returns data for executing a template that writes imgPath using theme,
+// which may be nil to use DefaultTheme. The image's format is determined by imgPath's
+// extension, and the footer reports that the plot was generated at now. Extra variables
+// needed by the template should be supplied via vars.
+func NewTemplateData(imgPath string, theme *Theme, now time.Time, vars map[string]interface{}) (*TemplateData, error) {
+	format, ok := FormatForPath(imgPath)
+	if !ok {
+		return nil, fmt.Errorf("can't determine format for %q", imgPath)
+	}
+	if theme == nil {
+		theme = themes[DefaultTheme]
+	}
+	return &TemplateData{
+		Data:      DataBlock,
+		SetTerm:   "set term " + theme.FormatTerm(format),
+		SetOutput: "set output " + Quote(imgPath),
+		FooterLabel: FooterLabel(fmt.Sprintf("Generated on %s by https://github.com/derat/covid",
+			now.Format("2006-01-02")), theme),
+		ThemeCmds: strings.Join(theme.Commands(), "\n"),
+		Vars:      vars,
+	}, nil
+}
+
+// execTemplate executes tmpl with data and writes the resulting script to w.
+// If execution fails, the returned error includes the line in the script that
+// was being written.
+func execTemplate(w io.Writer, tmpl string, data interface{}) error {
+	t, err := template.New("").Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("failed parsing template: %v", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return fmt.Errorf("failed executing template at script line %d: %v", bytes.Count(b.Bytes(), []byte("\n"))+1, err)
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// Run writes script to a file and passes it to gnuplot, using opts (which may be nil).
+// If gnuplot fails, an *Error is returned.
+func Run(script []byte, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	script, err := addData(script, opts.Data)
+	if err != nil {
+		return err
+	}
+	p, cleanup, err := writeScript(script, opts)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(gf.Name())
+	defer cleanup()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("gnuplot", p)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	return checkOutput(script, opts, err, stdout.String(), stderr.String())
+}
 
-	terr := template.Must(template.New("").Parse(tmpl)).Execute(gf, data)
-	cerr := gf.Close()
-	if terr != nil {
-		return terr
+// addData returns a copy of script that starts by defining data as the DataBlock data block.
+// script is returned unchanged if data is nil.
+func addData(script, data []byte) ([]byte, error) {
+	if data == nil {
+		return script, nil
 	}
-	if cerr != nil {
-		return cerr
+	for _, ln := range bytes.Split(data, []byte("\n")) {
+		if string(bytes.TrimSpace(ln)) == dataEnd {
+			return nil, fmt.Errorf("data contains %q line", dataEnd)
+		}
+	}
+	var b bytes.Buffer
+	b.WriteString(DataBlock + " << " + dataEnd + "\n")
+	b.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		b.WriteByte('\n')
 	}
+	b.WriteString(dataEnd + "\n")
+	b.Write(script)
+	return b.Bytes(), nil
+}
 
-	if err := exec.Command("gnuplot", gf.Name()).Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) != 0 {
-			return fmt.Errorf("%v: %q", err, strings.TrimSpace(string(exitErr.Stderr)))
+// writeScript writes script to opts.ScriptPath or to a temp file. The file's path is
+// returned along with a function that should be called to delete it if necessary.
+func writeScript(script []byte, opts *Options) (p string, cleanup func(), err error) {
+	if opts.ScriptPath != "" {
+		if err := ioutil.WriteFile(opts.ScriptPath, script, 0644); err != nil {
+			return "", nil, err
+		}
+		return opts.ScriptPath, func() {}, nil
+	}
+
+	f, err := ioutil.TempFile("", "gnuplot.")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.Remove(f.Name()) }
+	_, werr := f.Write(script)
+	if err := f.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	} else if werr != nil {
+		cleanup()
+		return "", nil, werr
+	}
+	return f.Name(), cleanup, nil
+}
+
+// checkOutput reports warnings from stderr via opts and returns an *Error if runErr is
+// non-nil or stderr reports an error in script.
+func checkOutput(script []byte, opts *Options, runErr error, stdout, stderr string) error {
+	warnings, line := parseStderr(stderr)
+	warn := opts.Warn
+	if warn == nil {
+		warn = func(msg string) { log.Print("gnuplot: ", msg) }
+	}
+	for _, w := range warnings {
+		warn(w)
+	}
+
+	if runErr == nil && line == 0 {
+		return nil
+	}
+	if runErr == nil {
+		runErr = errors.New("script failed")
+	}
+	gerr := &Error{Err: runErr, Stdout: stdout, Stderr: stderr, Script: opts.ScriptPath}
+	if lines := strings.Split(string(script), "\n"); line > 0 && line <= len(lines) {
+		gerr.Line = line
+		gerr.Text = strings.TrimSpace(lines[line-1])
+	}
+	return gerr
+}
+
+// stderrLineRegexp matches a line in gnuplot's stderr that refers to a line in the
+// script, e.g. `"/tmp/gnuplot.123" line 5: undefined variable: foo`.
+// Older versions of gnuplot put a comma after the filename.
+var stderrLineRegexp = regexp.MustCompile(`^"[^"]*",? line (\d+): (.*)$`)
+
+// parseStderr parses stderr from gnuplot. Warnings are returned with script paths removed,
+// e.g. "line 5: warning: Skipping data file with no valid points". line is the
+// script line of the last non-warning message, or 0 if no such message was found.
+func parseStderr(stderr string) (warnings []string, line int) {
+	for _, ln := range strings.Split(stderr, "\n") {
+		ln = strings.TrimSpace(ln)
+		msg := ln
+		var n int
+		if m := stderrLineRegexp.FindStringSubmatch(ln); m != nil {
+			n, _ = strconv.Atoi(m[1])
+			msg = "line " + m[1] + ": " + m[2]
+			ln = m[2]
+		}
+		if strings.HasPrefix(strings.ToLower(ln), "warning:") {
+			warnings = append(warnings, msg)
+		} else if n > 0 {
+			line = n
 		}
-		return err
 	}
-	return nil
+	return warnings, line
 }
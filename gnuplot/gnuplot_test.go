@@ -0,0 +1,164 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeGnuplot installs a fake gnuplot executable in a temp dir that runs the supplied
+// shell code (with the script path in $1). The returned function restores the original
+// $PATH and deletes dir.
+func fakeGnuplot(t *testing.T, code string) (dir string, restore func()) {
+	dir, err := ioutil.TempDir("", "gnuplot_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "gnuplot"), []byte("#!/bin/sh\n"+code+"\n"), 0755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Failed writing fake gnuplot: ", err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	return dir, func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestParseStderr(t *testing.T) {
+	stderr := `"/tmp/gnuplot.123" line 3: warning: Skipping data file with no valid points
+warning: iconv failed to convert degree sign
+
+plot 'foo.dat' using 1:3
+                        ^
+"/tmp/gnuplot.123", line 7: x range is invalid
+`
+	warnings, line := parseStderr(stderr)
+	if diff := cmp.Diff([]string{
+		"line 3: warning: Skipping data file with no valid points",
+		"warning: iconv failed to convert degree sign",
+	}, warnings); diff != "" {
+		t.Error("Bad warnings:\n" + diff)
+	}
+	if line != 7 {
+		t.Errorf("Got line %d; want 7", line)
+	}
+}
+
+func TestExecTemplate_Error(t *testing.T) {
+	var b bytes.Buffer
+	err := execTemplate(&b, "set title 'foo'\nset xlabel 'bar'\n{{.Missing}}\n", struct{}{})
+	if err == nil {
+		t.Fatal("execTemplate unexpectedly succeeded")
+	} else if !strings.Contains(err.Error(), "script line 3") {
+		t.Errorf("execTemplate error %q doesn't contain script line", err)
+	}
+	if err := execTemplate(&b, "{{.Foo", nil); err == nil {
+		t.Error("execTemplate unexpectedly accepted bad template")
+	}
+}
+
+func TestRun(t *testing.T) {
+	_, restore := fakeGnuplot(t, `echo "\"$1\" line 1: warning: something odd" >&2`)
+	defer restore()
+	var warnings []string
+	if err := Run([]byte("plot x\n"), &Options{Warn: func(msg string) { warnings = append(warnings, msg) }}); err != nil {
+		t.Fatal("Run failed: ", err)
+	}
+	if diff := cmp.Diff([]string{"line 1: warning: something odd"}, warnings); diff != "" {
+		t.Error("Bad warnings:\n" + diff)
+	}
+}
+
+func TestRun_Error(t *testing.T) {
+	_, restore := fakeGnuplot(t, `echo hello; echo "\"$1\" line 2: undefined variable: y" >&2; exit 1`)
+	defer restore()
+
+	dir, err := ioutil.TempDir("", "gnuplot_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(dir)
+	sp := filepath.Join(dir, "plot.gnuplot")
+
+	const script = "set title 'foo'\nplot y\n"
+	err = Run([]byte(script), &Options{ScriptPath: sp, Warn: func(string) {}})
+	gerr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Run returned %v; want *Error", err)
+	}
+	if gerr.Stdout != "hello\n" {
+		t.Errorf("Stdout is %q; want %q", gerr.Stdout, "hello\n")
+	}
+	if !strings.Contains(gerr.Stderr, "undefined variable") {
+		t.Errorf("Stderr %q doesn't contain error", gerr.Stderr)
+	}
+	if gerr.Line != 2 || gerr.Text != "plot y" {
+		t.Errorf("Got line %d (%q); want 2 (%q)", gerr.Line, gerr.Text, "plot y")
+	}
+	if b, err := ioutil.ReadFile(sp); err != nil {
+		t.Error("Failed reading kept script: ", err)
+	} else if string(b) != script {
+		t.Errorf("Kept script is %q; want %q", string(b), script)
+	}
+}
+
+func TestAddData(t *testing.T) {
+	const script = "plot $DATA using 1:2\n"
+	for _, tc := range []struct {
+		data string
+		want string
+	}{
+		{"1\t2\n3\t4\n", "$DATA << EOD\n1\t2\n3\t4\nEOD\n" + script},
+		{"1\t2", "$DATA << EOD\n1\t2\nEOD\n" + script},
+		{"", "$DATA << EOD\nEOD\n" + script},
+	} {
+		got, err := addData([]byte(script), []byte(tc.data))
+		if err != nil {
+			t.Errorf("addData(%q) failed: %v", tc.data, err)
+		} else if string(got) != tc.want {
+			t.Errorf("addData(%q) = %q; want %q", tc.data, got, tc.want)
+		}
+	}
+	if got, err := addData([]byte(script), nil); err != nil || string(got) != script {
+		t.Errorf("addData with nil data = %q, %v; want %q", got, err, script)
+	}
+	if _, err := addData([]byte(script), []byte("1\nEOD\n2\n")); err == nil {
+		t.Error("addData unexpectedly accepted data with terminator")
+	}
+}
+
+func TestNewTemplateData(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	td, err := NewTemplateData("out/it's.svg", nil, now, map[string]interface{}{"A": 1})
+	if err != nil {
+		t.Fatal("NewTemplateData failed: ", err)
+	}
+	for _, tc := range []struct{ name, got, want string }{
+		{"Data", td.Data, DataBlock},
+		{"SetTerm", td.SetTerm, "set term svg font 'Roboto,22' linewidth 2 size 1280,960"},
+		{"SetOutput", td.SetOutput, "set output 'out/it''s.svg'"},
+		{"FooterLabel", td.FooterLabel, "set label front '{/*0.7 Generated on 2020-09-01 by " +
+			"https://github.com/derat/covid}' at screen 0.99,0.015 right textcolor rgb 'black'"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%v is %q; want %q", tc.name, tc.got, tc.want)
+		}
+	}
+	if td.Vars["A"] != 1 {
+		t.Errorf("Vars is %v; want A=1", td.Vars)
+	}
+	if _, err := NewTemplateData("out/plot.gif", nil, now, nil); err == nil {
+		t.Error("NewTemplateData unexpectedly succeeded for unknown format")
+	}
+}
@@ -0,0 +1,321 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Plot describes a plot. Its Script method generates a gnuplot script that draws it,
+// so callers can construct plots without writing templates.
+type Plot struct {
+	Title  string // drawn at the top of the plot; empty to omit
+	Term   string // arguments for 'set term', e.g. "pngcairo size 1280,960"; empty to omit
+	Output string // path passed to 'set output'; empty to omit
+	Footer string // small text drawn in the bottom-right corner; empty to omit
+
+	// Prescan causes the series to first be plotted using the "unknown" terminal so that
+	// ranges can use GPVAL_DATA_* variables, e.g. Axis.Min = "GPVAL_DATA_X_MIN-0.5".
+	Prescan bool
+
+	X, Y    Axis
+	CB      Axis     // color box used by Image series
+	Key     Key      // legend
+	Grid    bool     // draw grid lines in front of the data at major X and Y tics
+	Size    string   // arguments for 'set size', e.g. "ratio 0.4"; empty to omit
+	Font    string   // font used for tic labels, e.g. ",20"; empty for default
+	Margins          // additional space around the plot
+	Palette []string // colors evenly spaced along the color box, e.g. "#ffffcc"
+	Colors  []string // colors for line types 1 through len(Colors)
+
+	Theme  *Theme   // colors text, borders, grid lines, and the footer; nil for defaults
+	Extra  []string // extra commands run before plotting
+	Series []Series
+}
+
+// AxisType describes how values are mapped onto an axis.
+type AxisType int
+
+const (
+	Linear AxisType = iota
+	Time            // values are timestamps parsed using Axis.TimeFormat
+	Log             // values are plotted using a base-10 logarithmic scale
+)
+
+// Axis describes one of a plot's axes.
+type Axis struct {
+	Type         AxisType
+	Label        string // empty to omit
+	LabelOptions string // extra arguments for e.g. 'set xlabel', e.g. "offset 0,-1.5"
+	Min, Max     string // range bounds as gnuplot expressions, e.g. "0"; empty to autoscale
+	TimeFormat   string // format used to parse timestamps for Time axes; defaults to "%Y-%m-%d"
+	Format       string // format for tic labels, e.g. "%m/%d"
+	Tics         string // extra arguments for e.g. 'set xtics', e.g. "scale 0 rotate by 90 right"
+	Fix          bool   // autoscale the axis to the data's exact range instead of extending to tics
+}
+
+// Key describes a plot's legend.
+type Key struct {
+	Hide    bool
+	Options string // arguments for 'set key', e.g. "top left invert"
+}
+
+// Margins describes the space around a plot. Values are passed to e.g. 'set bmargin'.
+// Empty values use gnuplot's defaults, except that Bottom defaults to "5" if Plot.Footer
+// is set.
+type Margins struct {
+	Left, Right, Top, Bottom string
+}
+
+// Style describes how a series is drawn.
+type Style int
+
+const (
+	Lines        Style = iota
+	LinesPoints        // lines with points at each value
+	Points             // points without lines
+	FilledCurves       // filled area between two columns (or between a column and an axis)
+	Image              // heatmap with x, y, and value columns
+	Boxplot            // boxplot computed by gnuplot from raw values
+	Candlesticks       // boxplot with precomputed x, box min, whisker min, whisker max, and box max columns
+)
+
+func (s Style) String() string {
+	switch s {
+	case Lines:
+		return "lines"
+	case LinesPoints:
+		return "linespoints"
+	case Points:
+		return "points"
+	case FilledCurves:
+		return "filledcurves"
+	case Image:
+		return "image"
+	case Boxplot:
+		return "boxplot"
+	case Candlesticks:
+		return "candlesticks"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
+// Series describes data drawn in a plot.
+type Series struct {
+	Data    string  // data source, e.g. a quoted filename; defaults to DataBlock
+	For     string  // iteration specifier, e.g. "[i=2:5]"; empty to plot once
+	Index   string  // 'index' argument selecting data blocks within Data, e.g. "0"; empty for all
+	Using   string  // columns, e.g. "1:2"
+	Style   Style   // drawing style
+	Options string  // extra style options, e.g. "x1" for FilledCurves or "pt 7"
+	Color   string  // line color, e.g. "#3f51b5" or "black"; empty for default
+	Width   float64 // line width; 0 for default
+	Title   string  // title displayed in key; empty for none
+
+	// ColumnTitle uses the data's column header as the title instead of Title.
+	ColumnTitle bool
+}
+
+// Script returns a gnuplot script that draws p.
+func (p *Plot) Script() string {
+	var b strings.Builder
+	add := func(format string, args ...interface{}) { fmt.Fprintf(&b, format+"\n", args...) }
+
+	if p.Title != "" {
+		add("set title %s", Quote(p.Title))
+	}
+	if p.Prescan {
+		// See http://www.phyast.pitt.edu/~zov1/gnuplot/html/statistics.html.
+		add("set term unknown")
+		add("%s", p.plotCmd())
+	}
+	if p.Term != "" {
+		add("set term %s", p.Term)
+	}
+	if p.Output != "" {
+		add("set output %s", Quote(p.Output))
+	}
+	b.WriteString("\n")
+
+	if p.Size != "" {
+		add("set size %s", p.Size)
+	}
+	if p.Font != "" {
+		add("set tics font %s", Quote(p.Font))
+	}
+	p.X.write(&b, "x")
+	p.Y.write(&b, "y")
+	p.CB.write(&b, "cb")
+	if len(p.Palette) > 0 {
+		add("%s", SetPalette(p.Palette))
+	}
+	if p.Grid {
+		if p.Theme != nil && p.Theme.Grid != "" {
+			add("set grid front xtics ytics lc rgb %s", Quote(p.Theme.Grid))
+		} else {
+			add("set grid front xtics ytics")
+		}
+	}
+	if p.Key.Hide {
+		add("set key off")
+	} else if p.Key.Options != "" {
+		add("set key %s", p.Key.Options)
+	}
+	bottom := p.Bottom
+	if bottom == "" && p.Footer != "" {
+		bottom = "5"
+	}
+	for _, m := range []struct{ name, val string }{
+		{"l", p.Left}, {"r", p.Right}, {"t", p.Top}, {"b", bottom},
+	} {
+		if m.val != "" {
+			add("set %smargin %s", m.name, m.val)
+		}
+	}
+	if p.Footer != "" {
+		add("%s", FooterLabel(p.Footer, p.Theme))
+	}
+	for i, c := range p.Colors {
+		add("set linetype %d lc rgb %s", i+1, Quote(c))
+	}
+	if p.Theme != nil {
+		for _, cmd := range p.Theme.Commands() {
+			add("%s", cmd)
+		}
+	}
+	for _, cmd := range p.Extra {
+		add("%s", cmd)
+	}
+
+	b.WriteString("\n")
+	add("%s", p.plotCmd())
+	return b.String()
+}
+
+// SetPalette returns a 'set palette' command that spaces colors evenly along the color box.
+func SetPalette(colors []string) string {
+	stops := make([]string, len(colors))
+	for i, c := range colors {
+		var pos float64
+		if len(colors) > 1 {
+			pos = float64(i) / float64(len(colors)-1)
+		}
+		stops[i] = fmt.Sprintf("%s %s", strconv.FormatFloat(pos, 'f', -1, 64), Quote(c))
+	}
+	return fmt.Sprintf("set palette defined (%s)", strings.Join(stops, ", "))
+}
+
+// FooterLabel returns a 'set label' command that draws small text in the bottom-right
+// corner of the image. The text is colored using theme, which may be nil.
+func FooterLabel(text string, theme *Theme) string {
+	cmd := fmt.Sprintf("set label front %s at screen 0.99,0.015 right", Quote("{/*0.7 "+text+"}"))
+	if theme != nil && theme.Foreground != "" {
+		cmd += " textcolor rgb " + Quote(theme.Foreground)
+	}
+	return cmd
+}
+
+// plotCmd returns a 'plot' command drawing p's series.
+func (p *Plot) plotCmd() string {
+	if len(p.Series) == 0 {
+		return "plot NaN notitle"
+	}
+	parts := make([]string, len(p.Series))
+	for i, s := range p.Series {
+		parts[i] = s.String()
+	}
+	return "plot " + strings.Join(parts, ", \\\n  ")
+}
+
+// String returns the part of a 'plot' command that draws s.
+func (s Series) String() string {
+	var parts []string
+	if s.For != "" {
+		parts = append(parts, "for "+s.For)
+	}
+	if s.Data != "" {
+		parts = append(parts, s.Data)
+	} else {
+		parts = append(parts, DataBlock)
+	}
+	if s.Index != "" {
+		parts = append(parts, "index "+s.Index)
+	}
+	if s.Using != "" {
+		parts = append(parts, "using "+s.Using)
+	}
+	parts = append(parts, "with "+s.Style.String())
+	if s.Options != "" {
+		parts = append(parts, s.Options)
+	}
+	if s.Color != "" {
+		parts = append(parts, "lc rgb "+Quote(s.Color))
+	}
+	if s.Width > 0 {
+		parts = append(parts, "lw "+strconv.FormatFloat(s.Width, 'f', -1, 64))
+	}
+	if s.ColumnTitle {
+		parts = append(parts, "title columnheader")
+	} else if s.Title != "" {
+		parts = append(parts, "title "+Quote(s.Title))
+	} else {
+		parts = append(parts, "notitle")
+	}
+	return strings.Join(parts, " ")
+}
+
+// write writes commands configuring a to b. name is the axis's name, e.g. "x" or "cb".
+func (a *Axis) write(b *strings.Builder, name string) {
+	add := func(format string, args ...interface{}) { fmt.Fprintf(b, format+"\n", args...) }
+	switch a.Type {
+	case Time:
+		tf := a.TimeFormat
+		if tf == "" {
+			tf = "%Y-%m-%d"
+		}
+		add("set %sdata time", name)
+		add("set timefmt %s", Quote(tf))
+	case Log:
+		add("set logscale %s", name)
+	}
+	if a.Format != "" {
+		add("set format %s %s", name, Quote(a.Format))
+	}
+	if a.Label != "" {
+		cmd := fmt.Sprintf("set %slabel %s", name, Quote(a.Label))
+		if a.LabelOptions != "" {
+			cmd += " " + a.LabelOptions
+		}
+		add("%s", cmd)
+	}
+	if a.Min != "" || a.Max != "" {
+		min, max := a.Min, a.Max
+		if min == "" {
+			min = "*"
+		}
+		if max == "" {
+			max = "*"
+		}
+		add("set %srange [%s:%s]", name, min, max)
+	}
+	if a.Tics != "" {
+		add("set %stics %s", name, a.Tics)
+	}
+	if a.Fix {
+		add("set autoscale %sfix", name)
+	}
+}
+
+// Quote returns s as a gnuplot string. Single quotes are used unless s contains newlines,
+// which are only interpreted within double quotes.
+func Quote(s string) string {
+	if !strings.Contains(s, "\n") {
+		return quote(s)
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlot_Script(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		plot Plot
+		want []string // lines of script
+	}{
+		{
+			name: "empty",
+			plot: Plot{},
+			want: []string{"", "", "plot NaN notitle"},
+		},
+		{
+			name: "lines",
+			plot: Plot{
+				Title:  "Daily tests",
+				Term:   "pngcairo size 1280,960",
+				Output: "/tmp/it's.png",
+				Footer: "Generated today",
+				X:      Axis{Type: Time, Label: "Date", Format: "%m/%d"},
+				Y:      Axis{Type: Log, Label: "Tests", Min: "1"},
+				Key:    Key{Options: "top left"},
+				Grid:   true,
+				Series: []Series{
+					{Using: "1:2", Style: Lines, Color: "#3f51b5", Width: 2, Title: "Molecular"},
+					{Data: "'other.dat'", Index: "1", Using: "1:3:4", Style: FilledCurves, Color: "#ddd"},
+				},
+			},
+			want: []string{
+				"set title 'Daily tests'",
+				"set term pngcairo size 1280,960",
+				"set output '/tmp/it''s.png'",
+				"",
+				"set xdata time",
+				"set timefmt '%Y-%m-%d'",
+				"set format x '%m/%d'",
+				"set xlabel 'Date'",
+				"set logscale y",
+				"set ylabel 'Tests'",
+				"set yrange [1:*]",
+				"set grid front xtics ytics",
+				"set key top left",
+				"set bmargin 5",
+				"set label front '{/*0.7 Generated today}' at screen 0.99,0.015 right",
+				"",
+				"plot $DATA using 1:2 with lines lc rgb '#3f51b5' lw 2 title 'Molecular', \\",
+				"  'other.dat' index 1 using 1:3:4 with filledcurves lc rgb '#ddd' notitle",
+			},
+		},
+		{
+			name: "heatmap",
+			plot: Plot{
+				Title:   "Line one\nLine \"two\"",
+				Prescan: true,
+				Size:    "ratio 0.4",
+				Font:    ",20",
+				X:       Axis{Min: "GPVAL_DATA_X_MIN-0.5", Tics: "scale 0", Fix: true},
+				Y:       Axis{Label: "Age", LabelOptions: "offset 0,-1.5", Max: "10"},
+				CB:      Axis{Label: "Fraction", Min: "0", Max: "1"},
+				Palette: []string{"#b2182b", "#f7f7f7", "#2166ac"},
+				Key:     Key{Hide: true},
+				Margins: Margins{Left: "at screen 0.1", Bottom: "3"},
+				Footer:  "Footer",
+				Colors:  []string{"red", "blue"},
+				Extra:   []string{"set view map"},
+				Series:  []Series{{Using: "1:2:3", Style: Image}},
+			},
+			want: []string{
+				`set title "Line one\nLine \"two\""`,
+				"set term unknown",
+				"plot $DATA using 1:2:3 with image notitle",
+				"",
+				"set size ratio 0.4",
+				"set tics font ',20'",
+				"set xrange [GPVAL_DATA_X_MIN-0.5:*]",
+				"set xtics scale 0",
+				"set autoscale xfix",
+				"set ylabel 'Age' offset 0,-1.5",
+				"set yrange [*:10]",
+				"set cblabel 'Fraction'",
+				"set cbrange [0:1]",
+				"set palette defined (0 '#b2182b', 0.5 '#f7f7f7', 1 '#2166ac')",
+				"set key off",
+				"set lmargin at screen 0.1",
+				"set bmargin 3",
+				"set label front '{/*0.7 Footer}' at screen 0.99,0.015 right",
+				"set linetype 1 lc rgb 'red'",
+				"set linetype 2 lc rgb 'blue'",
+				"set view map",
+				"",
+				"plot $DATA using 1:2:3 with image notitle",
+			},
+		},
+		{
+			name: "theme",
+			plot: Plot{
+				Grid:   true,
+				Footer: "Footer",
+				Theme:  &Theme{Foreground: "white", Grid: "#555555"},
+				Series: []Series{{Using: "1:2", Style: Points}},
+			},
+			want: []string{
+				"",
+				"set grid front xtics ytics lc rgb '#555555'",
+				"set bmargin 5",
+				"set label front '{/*0.7 Footer}' at screen 0.99,0.015 right textcolor rgb 'white'",
+				"set border lc rgb 'white'",
+				"set tics textcolor rgb 'white'",
+				"set key textcolor rgb 'white'",
+				"set title textcolor rgb 'white'",
+				"set xlabel textcolor rgb 'white'",
+				"set ylabel textcolor rgb 'white'",
+				"set cblabel textcolor rgb 'white'",
+				"",
+				"plot $DATA using 1:2 with points notitle",
+			},
+		},
+		{
+			name: "iteration",
+			plot: Plot{
+				Series: []Series{
+					{For: "[i=3:2:-1]", Using: "1:i", Style: FilledCurves, Options: "x1 linestyle i-1", ColumnTitle: true},
+					{Using: "1:2:3:4:5", Style: Candlesticks, Options: "whiskerbars", Title: "Dist"},
+					{Using: "(1):2", Style: Boxplot},
+				},
+			},
+			want: []string{
+				"",
+				"",
+				"plot for [i=3:2:-1] $DATA using 1:i with filledcurves x1 linestyle i-1 title columnheader, \\",
+				"  $DATA using 1:2:3:4:5 with candlesticks whiskerbars title 'Dist', \\",
+				"  $DATA using (1):2 with boxplot notitle",
+			},
+		},
+	} {
+		got := strings.Split(strings.TrimSuffix(tc.plot.Script(), "\n"), "\n")
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: Script() returned unexpected lines:\n%s", tc.name, diff)
+		}
+	}
+}
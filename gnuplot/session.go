@@ -0,0 +1,251 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Session runs scripts using a pool of long-lived gnuplot processes, avoiding the
+// cost of starting gnuplot for each plot. Scripts are passed to the processes via
+// stdin. gnuplot exits when it encounters an error in a script, so dead processes
+// are replaced before running the next script.
+//
+// Run may be called concurrently by multiple goroutines.
+type Session struct {
+	size  int           // number of processes
+	procs chan *process // idle processes; nil if not started yet or killed
+}
+
+// NewSession returns a new Session that runs up to n scripts concurrently.
+// Processes are started as needed.
+func NewSession(n int) *Session {
+	if n < 1 {
+		n = 1
+	}
+	s := &Session{size: n, procs: make(chan *process, n)}
+	for i := 0; i < n; i++ {
+		s.procs <- nil
+	}
+	return s
+}
+
+// ExecTemplate is like the package-level ExecTemplateOptions but runs the script using s.
+func (s *Session) ExecTemplate(ctx context.Context, tmpl string, data interface{}, opts *Options) error {
+	var b bytes.Buffer
+	if err := execTemplate(&b, tmpl, data); err != nil {
+		return err
+	}
+	return s.Run(ctx, b.Bytes(), opts)
+}
+
+// Run runs script using opts (which may be nil) on an idle gnuplot process, waiting for
+// one to become available if needed. If gnuplot reports an error, an *Error is returned.
+// If ctx is done before the script finishes, the process is killed and ctx.Err is returned.
+func (s *Session) Run(ctx context.Context, script []byte, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	script, err := addData(script, opts.Data)
+	if err != nil {
+		return err
+	}
+	p, cleanup, err := writeScript(script, opts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var proc *process
+	select {
+	case proc = <-s.procs:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { s.procs <- proc }()
+
+	if proc != nil && !proc.alive() {
+		proc.kill()
+		proc = nil
+	}
+	if proc == nil {
+		if proc, err = startProcess(); err != nil {
+			return fmt.Errorf("failed starting gnuplot: %v", err)
+		}
+	}
+	stdout, stderr, err := proc.run(ctx, p)
+	if err == errExited {
+		// Report the process's exit status like Run does. Waiting also
+		// ensures that all of the process's stdout has been collected.
+		if werr := proc.wait(); werr != nil {
+			err = werr
+		}
+		stdout = proc.stdout.String()
+		proc = nil
+	} else if err != nil {
+		proc.kill()
+		proc = nil
+		if err == ctx.Err() {
+			return err
+		}
+	}
+	return checkOutput(script, opts, err, stdout, stderr)
+}
+
+// Close waits for running scripts to finish and then stops s's processes.
+// s must not be used afterward.
+func (s *Session) Close() error {
+	var firstErr error
+	for i := 0; i < s.size; i++ {
+		if proc := <-s.procs; proc != nil {
+			if err := proc.close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// process is a gnuplot process that reads commands from stdin.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr chan string // lines from stderr; closed when stderr is closed
+	stdout syncBuffer
+	runs   int // number of scripts run so far
+}
+
+// startProcess starts a new gnuplot process.
+func startProcess() (*process, error) {
+	p := &process{cmd: exec.Command("gnuplot"), stderr: make(chan string)}
+	p.cmd.Stdout = &p.stdout
+	var err error
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stderr, err := p.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			p.stderr <- sc.Text()
+		}
+		close(p.stderr)
+	}()
+	return p, nil
+}
+
+// errExited is returned by process.run if gnuplot exited before finishing the script.
+var errExited = errors.New("gnuplot exited")
+
+// run instructs gnuplot to run the script at path and waits for it to finish.
+// A marker is printed to stderr after the script to detect when it's done.
+// 'reset session' doesn't reset the print destination, so 'set print' is used to
+// send the marker to stderr even if the script redirected printed output.
+// If gnuplot exits first, the lines that it wrote to stderr are returned with errExited.
+func (p *process) run(ctx context.Context, path string) (stdout, stderr string, err error) {
+	p.runs++
+	marker := fmt.Sprintf("gnuplot-session-done-%d", p.runs)
+	p.stdout.reset()
+	cmds := fmt.Sprintf("reset session\nload %s\nunset output\nset print\nprint %q\n", quote(path), marker)
+	if _, err := io.WriteString(p.stdin, cmds); err != nil {
+		return "", "", err
+	}
+
+	var lines []string
+	for {
+		select {
+		case ln, ok := <-p.stderr:
+			if !ok {
+				return p.stdout.String(), strings.Join(lines, "\n"), errExited
+			}
+			if ln == marker {
+				return p.stdout.String(), strings.Join(lines, "\n"), nil
+			}
+			lines = append(lines, ln)
+		case <-ctx.Done():
+			return p.stdout.String(), strings.Join(lines, "\n"), ctx.Err()
+		}
+	}
+}
+
+// alive discards any output that p wrote to stderr while idle and reports
+// whether p is still running.
+func (p *process) alive() bool {
+	for {
+		select {
+		case _, ok := <-p.stderr:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// wait waits for p to exit after its stderr has been closed.
+func (p *process) wait() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// close closes p's stdin and waits for it to exit.
+func (p *process) close() error {
+	p.stdin.Close()
+	for range p.stderr {
+	}
+	return p.cmd.Wait()
+}
+
+// kill kills p and waits for it to exit.
+func (p *process) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	for range p.stderr {
+	}
+	p.cmd.Wait()
+}
+
+// quote returns s as a single-quoted gnuplot string.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// syncBuffer is a bytes.Buffer that can be safely written and read by different goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
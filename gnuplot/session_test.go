@@ -0,0 +1,167 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSessionGnuplot emulates the commands sent by Session. Each process appends a line
+// to a "starts" file in its directory. Scripts containing "FAIL" report an error on their
+// second line and make the process exit (like real gnuplot), scripts containing "WARN"
+// report a warning, and scripts containing "SLEEP" hang for a while. Scripts containing
+// "set print '" redirect printed output to a "printed" file until a bare "set print"
+// command is received.
+const fakeSessionGnuplot = `
+echo x >>"$(dirname "$0")/starts"
+redirected=
+while IFS= read -r line; do
+  case "$line" in
+    "load '"*)
+      f=${line#load \'}
+      f=${f%\'}
+      grep -q WARN "$f" && echo "\"$f\" line 1: warning: odd" >&2
+      if grep -q FAIL "$f"; then
+        echo "\"$f\" line 2: undefined variable: y" >&2
+        exit 1
+      fi
+      grep -q SLEEP "$f" && sleep 5 >/dev/null 2>&1
+      grep -q "set print '" "$f" && redirected=1
+      ;;
+    "set print")
+      redirected=
+      ;;
+    print*)
+      m=${line#print \"}
+      if [ -n "$redirected" ]; then
+        echo "${m%\"}" >>"$(dirname "$0")/printed"
+      else
+        echo "${m%\"}" >&2
+      fi
+      ;;
+  esac
+done
+`
+
+func TestSession(t *testing.T) {
+	dir, restore := fakeGnuplot(t, fakeSessionGnuplot)
+	defer restore()
+
+	const nprocs = 2
+	s := NewSession(nprocs)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 6)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.Run(ctx, []byte(fmt.Sprintf("set title '%d'\nplot x\n", i)), nil)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Run %d failed: %v", i, err)
+		}
+	}
+
+	var warnings []string
+	opts := &Options{Warn: func(msg string) { warnings = append(warnings, msg) }}
+	err := s.Run(ctx, []byte("set title 'WARN FAIL'\nplot y\n"), opts)
+	if gerr, ok := err.(*Error); !ok {
+		t.Errorf("Failing script returned %v; want *Error", err)
+	} else if gerr.Line != 2 || gerr.Text != "plot y" {
+		t.Errorf("Failing script reported line %d (%q); want 2 (%q)", gerr.Line, gerr.Text, "plot y")
+	}
+	if len(warnings) != 1 || warnings[0] != "line 1: warning: odd" {
+		t.Errorf("Got warnings %q; want %q", warnings, []string{"line 1: warning: odd"})
+	}
+	if err := s.Run(ctx, []byte("plot x\n"), nil); err != nil {
+		t.Error("Run failed after error: ", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := s.Run(tctx, []byte("SLEEP\n"), nil); err != context.DeadlineExceeded {
+		t.Errorf("Slow script returned %v; want %v", err, context.DeadlineExceeded)
+	}
+	if err := s.Run(ctx, []byte("plot x\n"), nil); err != nil {
+		t.Error("Run failed after timeout: ", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Error("Close failed: ", err)
+	}
+
+	// The exited and killed processes should've been replaced, but processes
+	// shouldn't be started for each script.
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "starts")); err != nil {
+		t.Error("Failed reading starts: ", err)
+	} else if n := strings.Count(string(b), "\n"); n < nprocs+1 || n > nprocs+2 {
+		t.Errorf("Started %d process(es); want %d to %d", n, nprocs+1, nprocs+2)
+	}
+}
+
+func TestSession_SetPrint(t *testing.T) {
+	_, restore := fakeGnuplot(t, fakeSessionGnuplot)
+	defer restore()
+
+	s := NewSession(1)
+	defer s.Close()
+
+	// Scripts that redirect printed output shouldn't prevent Session from seeing
+	// when they (or later scripts) are done.
+	for _, script := range []string{"set print '/tmp/out.txt'\nprint 'hi'\n", "plot x\n"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.Run(ctx, []byte(script), nil)
+		cancel()
+		if err != nil {
+			t.Errorf("Run(%q) failed: %v", script, err)
+		}
+	}
+}
+
+func TestSession_Restart(t *testing.T) {
+	dir, restore := fakeGnuplot(t, fakeSessionGnuplot)
+	defer restore()
+
+	s := NewSession(1)
+	defer s.Close()
+	ctx := context.Background()
+
+	// gnuplot exits after the failing script. Its error should be reported for that
+	// script and a new process should be used to run the next one.
+	err := s.Run(ctx, []byte("set title 'FAIL'\nplot y\n"), nil)
+	if gerr, ok := err.(*Error); !ok {
+		t.Errorf("Failing script returned %v; want *Error", err)
+	} else if gerr.Line != 2 || gerr.Text != "plot y" {
+		t.Errorf("Failing script reported line %d (%q); want 2 (%q)", gerr.Line, gerr.Text, "plot y")
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Run(ctx, []byte("plot x\n"), nil); err != nil {
+			t.Errorf("Run %d after failure failed: %v", i, err)
+		}
+	}
+
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "starts")); err != nil {
+		t.Error("Failed reading starts: ", err)
+	} else if n := strings.Count(string(b), "\n"); n != 2 {
+		t.Errorf("Started %d process(es); want 2", n)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got, want := quote("/tmp/it's.gnuplot"), "'/tmp/it''s.gnuplot'"; got != want {
+		t.Errorf("quote returned %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format is an output file format.
+type Format string
+
+const (
+	PNG    Format = "png"
+	SVG    Format = "svg"
+	PDF    Format = "pdf"
+	Canvas Format = "html" // standalone HTML page drawing the plot in a canvas element
+)
+
+// formatTerms maps formats to gnuplot terminals.
+var formatTerms = map[Format]string{
+	PNG:    "pngcairo",
+	SVG:    "svg",
+	PDF:    "pdfcairo",
+	Canvas: "canvas",
+}
+
+// ParseFormat returns the format named by s, e.g. "png" or "html". Case is ignored.
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(s))
+	if _, ok := formatTerms[f]; !ok {
+		return "", fmt.Errorf("unknown format %q", s)
+	}
+	return f, nil
+}
+
+// FormatForPath returns the format used for files with p's extension, e.g. PNG for "a.PNG".
+func FormatForPath(p string) (Format, bool) {
+	f, err := ParseFormat(strings.TrimPrefix(filepath.Ext(p), "."))
+	return f, err == nil
+}
+
+// Ext returns the extension used for files in f, e.g. ".png".
+func (f Format) Ext() string { return "." + string(f) }
+
+// Term returns the gnuplot terminal used to write f, e.g. "pngcairo".
+func (f Format) Term() string { return formatTerms[f] }
+
+// Theme describes the appearance of plots.
+type Theme struct {
+	Font          string   // default font, e.g. "Roboto,22"
+	Width, Height int      // image size in pixels (vector formats use 128 pixels per inch)
+	LineWidth     float64  // multiplier for all line widths
+	Background    string   // background color; empty for the terminal's default
+	Foreground    string   // color of text, borders, and single-series lines
+	Grid          string   // color of grid lines; empty for gnuplot's default
+	Colors        []string // colors for distinct series, in order
+	Shades        []string // fill colors for nested ranges, from outermost to innermost
+	Sequential    []string // "#rrggbb" color scale for magnitudes, from low to high
+	Diverging     []string // "#rrggbb" color scale for values around a midpoint, from low to high
+}
+
+// DefaultTheme is the name of the theme used if none is specified.
+const DefaultTheme = "light"
+
+// themes contains named themes.
+var themes = map[string]*Theme{
+	"light": {
+		Font:       "Roboto,22",
+		Width:      1280,
+		Height:     960,
+		LineWidth:  2,
+		Foreground: "black",
+		Colors:     []string{"#3f51b5", "#009688", "#ef9a9a", "#9e9e9e", "#ff9800", "#795548", "#e91e63", "#8bc34a"},
+		Shades:     []string{"#dddddd", "#bbbbbb"},
+		// Based on Anna Schneider's https://github.com/aschn/gnuplot-colorbrewer/blob/master/sequential/YlOrRd.plt
+		Sequential: []string{"#ffffcc", "#ffeda0", "#fed976", "#feb24c", "#fd8d3c",
+			"#fc4e2a", "#e31a1c", "#b10026", "#80001c", "#660016"},
+		Diverging: []string{"#b2182b", "#f7f7f7", "#2166ac"},
+	},
+	"dark": {
+		Font:       "Roboto,22",
+		Width:      1280,
+		Height:     960,
+		LineWidth:  2,
+		Background: "#202124",
+		Foreground: "#e8eaed",
+		Grid:       "#5f6368",
+		Colors:     []string{"#8ab4f8", "#81c995", "#f28b82", "#9aa0a6", "#fdd663", "#c58af9", "#ff8bcb", "#78d9ec"},
+		Shades:     []string{"#3c4043", "#5f6368"},
+		// Magma, which goes from dark to light.
+		Sequential: []string{"#000004", "#3b0f70", "#8c2981", "#de4968", "#fe9f6d", "#fcfdbf"},
+		Diverging:  []string{"#f28b82", "#303134", "#8ab4f8"},
+	},
+	"colorblind": {
+		Font:       "Roboto,22",
+		Width:      1280,
+		Height:     960,
+		LineWidth:  2.5,
+		Foreground: "black",
+		// Okabe and Ito's palette: https://jfly.uni-koeln.de/color/
+		Colors: []string{"#0072b2", "#009e73", "#d55e00", "#999999", "#e69f00", "#56b4e9", "#cc79a7", "#f0e442"},
+		Shades: []string{"#dddddd", "#bbbbbb"},
+		// Viridis, reversed so low values are light.
+		Sequential: []string{"#fde725", "#7ad151", "#22a884", "#2a788e", "#414487", "#440154"},
+		Diverging:  []string{"#e66101", "#f7f7f7", "#5e3c99"},
+	},
+	"print": {
+		Font:       "Helvetica,18",
+		Width:      1600,
+		Height:     1200,
+		LineWidth:  3,
+		Foreground: "black",
+		Grid:       "#bbbbbb",
+		Colors:     []string{"black", "#666666", "#999999", "#cccccc"},
+		Shades:     []string{"#eeeeee", "#cccccc"},
+		Sequential: []string{"#ffffff", "#000000"},
+		Diverging:  []string{"#252525", "#f7f7f7", "#969696"},
+	},
+}
+
+// ThemeNames returns the names of all themes in ascending order.
+func ThemeNames() []string {
+	var names []string
+	for n := range themes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTheme returns the theme with the supplied name, e.g. "dark".
+func LookupTheme(name string) (*Theme, error) {
+	t, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q", name)
+	}
+	return t, nil
+}
+
+// Size returns the terminal size to use when writing f, e.g. "1280,960" or "10in,7.5in".
+func (t *Theme) Size(f Format) string {
+	if f == PDF {
+		in := func(px int) string { return strconv.FormatFloat(float64(px)/128, 'f', -1, 64) + "in" }
+		return in(t.Width) + "," + in(t.Height)
+	}
+	return fmt.Sprintf("%d,%d", t.Width, t.Height)
+}
+
+// Term returns arguments for 'set term' that use t's font, line width, and background
+// with the supplied terminal, e.g. "pngcairo". size is omitted if empty.
+func (t *Theme) Term(term, size string) string {
+	s := fmt.Sprintf("%s font %s linewidth %s", term, Quote(t.Font),
+		strconv.FormatFloat(t.LineWidth, 'f', -1, 64))
+	if size != "" {
+		s += " size " + size
+	}
+	if t.Background != "" {
+		s += " background " + Quote(t.Background)
+	}
+	return s
+}
+
+// FormatTerm returns arguments for 'set term' to write f using t.
+func (t *Theme) FormatTerm(f Format) string {
+	return t.Term(f.Term(), t.Size(f))
+}
+
+// Commands returns commands that color text and borders. They must be run after
+// titles and axis labels have been set.
+func (t *Theme) Commands() []string {
+	if t.Foreground == "" {
+		return nil
+	}
+	fg := Quote(t.Foreground)
+	cmds := []string{"set border lc rgb " + fg}
+	for _, s := range []string{"tics", "key", "title", "xlabel", "ylabel", "cblabel"} {
+		cmds = append(cmds, "set "+s+" textcolor rgb "+fg)
+	}
+	return cmds
+}
+
+// Color returns the color for the i-th series, starting over if i exceeds len(t.Colors).
+func (t *Theme) Color(i int) string {
+	return t.Colors[i%len(t.Colors)]
+}
+
+// Scale returns n colors evenly spaced along t.Sequential.
+func (t *Theme) Scale(n int) []string {
+	return interpolate(t.Sequential, n)
+}
+
+// interpolate returns n colors evenly spaced along the scale described by stops,
+// which contains "#rrggbb" colors.
+func interpolate(stops []string, n int) []string {
+	if n <= 0 || len(stops) == 0 {
+		return nil
+	}
+	if n == len(stops) || len(stops) == 1 {
+		cols := make([]string, n)
+		for i := range cols {
+			cols[i] = stops[i%len(stops)]
+		}
+		return cols
+	}
+
+	cols := make([]string, n)
+	for i := range cols {
+		var pos float64 // position within stops
+		if n > 1 {
+			pos = float64(i) * float64(len(stops)-1) / float64(n-1)
+		}
+		lo := int(math.Floor(pos))
+		if lo >= len(stops)-1 {
+			cols[i] = stops[len(stops)-1]
+			continue
+		}
+		a, aok := parseColor(stops[lo])
+		b, bok := parseColor(stops[lo+1])
+		if !aok || !bok {
+			cols[i] = stops[int(math.Round(pos))]
+			continue
+		}
+		frac := pos - float64(lo)
+		var c [3]int
+		for j := range c {
+			c[j] = int(math.Round(float64(a[j]) + frac*float64(b[j]-a[j])))
+		}
+		cols[i] = fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return cols
+}
+
+// parseColor parses a "#rrggbb" color.
+func parseColor(s string) ([3]int, bool) {
+	var c [3]int
+	if len(s) != 7 || s[0] != '#' {
+		return c, false
+	}
+	for i := range c {
+		v, err := strconv.ParseUint(s[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return c, false
+		}
+		c[i] = int(v)
+	}
+	return c, true
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package gnuplot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatForPath(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		want Format
+		ok   bool
+	}{
+		{"out/plot.png", PNG, true},
+		{"plot.PDF", PDF, true},
+		{"plot.html", Canvas, true},
+		{"plot.gif", "", false},
+		{"plot", "", false},
+	} {
+		if got, ok := FormatForPath(tc.path); got != tc.want || ok != tc.ok {
+			t.Errorf("FormatForPath(%q) = %q, %v; want %q, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestTheme_FormatTerm(t *testing.T) {
+	th := &Theme{Font: "Roboto,22", Width: 1280, Height: 960, LineWidth: 2, Background: "#000000"}
+	for f, want := range map[Format]string{
+		PNG:    "pngcairo font 'Roboto,22' linewidth 2 size 1280,960 background '#000000'",
+		PDF:    "pdfcairo font 'Roboto,22' linewidth 2 size 10in,7.5in background '#000000'",
+		Canvas: "canvas font 'Roboto,22' linewidth 2 size 1280,960 background '#000000'",
+	} {
+		if got := th.FormatTerm(f); got != want {
+			t.Errorf("FormatTerm(%q) = %q; want %q", f, got, want)
+		}
+	}
+}
+
+func TestThemes(t *testing.T) {
+	for _, name := range ThemeNames() {
+		th, err := LookupTheme(name)
+		if err != nil {
+			t.Errorf("LookupTheme(%q) failed: %v", name, err)
+			continue
+		}
+		if len(th.Colors) < 4 || len(th.Shades) < 2 || len(th.Diverging) < 2 {
+			t.Errorf("Theme %q has too few colors", name)
+		}
+		for _, c := range append(append([]string{}, th.Sequential...), th.Diverging...) {
+			if _, ok := parseColor(c); !ok {
+				t.Errorf("Theme %q has non-RGB scale color %q", name, c)
+			}
+		}
+	}
+	if _, err := LookupTheme("bogus"); err == nil {
+		t.Error("LookupTheme(\"bogus\") unexpectedly succeeded")
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	for _, tc := range []struct {
+		stops []string
+		n     int
+		want  []string
+	}{
+		{[]string{"#000000", "#ffffff"}, 3, []string{"#000000", "#808080", "#ffffff"}},
+		{[]string{"#000000", "#ff0000", "#ffffff"}, 5, []string{"#000000", "#800000", "#ff0000", "#ff8080", "#ffffff"}},
+		{[]string{"#000000", "#ffffff"}, 2, []string{"#000000", "#ffffff"}},
+		{[]string{"#123456"}, 2, []string{"#123456", "#123456"}},
+		{[]string{"#000000", "#ffffff"}, 0, nil},
+	} {
+		if diff := cmp.Diff(tc.want, interpolate(tc.stops, tc.n)); diff != "" {
+			t.Errorf("interpolate(%q, %d) returned unexpected colors:\n%s", tc.stops, tc.n, diff)
+		}
+	}
+}
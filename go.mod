@@ -2,4 +2,7 @@ module github.com/derat/covid
 
 go 1.14
 
-require github.com/google/go-cmp v0.5.1
+require (
+	github.com/google/go-cmp v0.5.1
+	github.com/klauspost/compress v1.11.3
+)
@@ -0,0 +1,183 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+// Package input opens input files specified on the command line.
+//
+// Inputs can be specified as local paths, "-" for stdin, or file://, http://, or
+// https:// URLs. Compressed data is detected by sniffing its first few bytes and
+// is transparently decompressed: gzip, zstd, bzip2, and zip archives containing
+// a single file are supported.
+package input
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Stdin is the spec used to read from stdin.
+const Stdin = "-"
+
+// Client is used to fetch http:// and https:// URLs.
+var Client = http.DefaultClient
+
+// Open opens the input described by spec and returns a reader that produces
+// its decompressed data. The caller must close the returned reader.
+func Open(spec string) (io.ReadCloser, error) {
+	rc, err := openRaw(spec)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := decompress(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return dr, nil
+}
+
+// Name returns the base name of the file described by spec, e.g. "20200901.csv"
+// for "http://example.org/data/20200901.csv?download=1", or spec itself for Stdin.
+func Name(spec string) string {
+	if spec == Stdin {
+		return spec
+	}
+	p := spec
+	if u, err := url.Parse(spec); err == nil && len(u.Scheme) > 1 {
+		p = u.Path
+	}
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		p = p[i+1:]
+	}
+	return p
+}
+
+// openRaw opens the possibly-compressed data described by spec.
+func openRaw(spec string) (io.ReadCloser, error) {
+	if spec == Stdin {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	u, err := url.Parse(spec)
+	// Single-letter schemes are probably Windows drive letters.
+	if err != nil || len(u.Scheme) <= 1 {
+		return os.Open(spec)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("can't open file URL with host %q", u.Host)
+		}
+		return os.Open(u.Path)
+	case "http", "https":
+		resp, err := Client.Get(spec)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("server returned %v", resp.Status)
+		}
+		return resp.Body, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+}
+
+// Magic numbers at the start of compressed data.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+	zipMagic   = []byte("PK\x03\x04")
+)
+
+// decompress sniffs the data in rc and returns a reader that decompresses it if needed.
+// Closing the returned reader closes rc. rc is left open if an error is returned.
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading gzip data: %v", err)
+		}
+		return &multiCloser{zr, []io.Closer{zr, rc}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading zstd data: %v", err)
+		}
+		return &multiCloser{zr, []io.Closer{closerFunc(func() error { zr.Close(); return nil }), rc}}, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return &multiCloser{bzip2.NewReader(br), []io.Closer{rc}}, nil
+	case bytes.HasPrefix(magic, zipMagic):
+		return openZip(br, rc)
+	default:
+		return &multiCloser{br, []io.Closer{rc}}, nil
+	}
+}
+
+// openZip reads a zip archive from r and returns a reader for the single file within it.
+// As in decompress, closing the returned reader closes rc.
+func openZip(r io.Reader, rc io.ReadCloser) (io.ReadCloser, error) {
+	// Zip archives have their directory at the end, so we need to read the whole thing.
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("failed reading zip archive: %v", err)
+	}
+	var files []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("zip archive contains %d files; want 1", len(files))
+	}
+	fr, err := files[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	return &multiCloser{fr, []io.Closer{fr, rc}}, nil
+}
+
+// multiCloser reads from an io.Reader and closes multiple io.Closers in order.
+type multiCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (mc *multiCloser) Close() error {
+	var firstErr error
+	for _, c := range mc.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// closerFunc adapts a function to io.Closer.
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,237 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testData = "date,value\n2020-09-01,5\n"
+
+// compress returns testData compressed using the supplied format.
+func compress(t *testing.T, format string) []byte {
+	var b bytes.Buffer
+	switch format {
+	case "plain":
+		b.WriteString(testData)
+	case "gzip":
+		w := gzip.NewWriter(&b)
+		w.Write([]byte(testData))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case "zstd":
+		w, err := zstd.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(testData))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case "bzip2":
+		// The standard library can't write bzip2 data.
+		b.Write(bzip2Data)
+	case "zip":
+		w := zip.NewWriter(&b)
+		if _, err := w.Create("dir/"); err != nil {
+			t.Fatal(err)
+		}
+		f, err := w.Create("dir/data.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(testData))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("Unknown format %q", format)
+	}
+	return b.Bytes()
+}
+
+// readSpec opens spec and returns its data.
+func readSpec(spec string) (string, error) {
+	rc, err := Open(spec)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(rc)
+	if cerr := rc.Close(); err == nil {
+		err = cerr
+	}
+	return string(b), err
+}
+
+func TestOpen(t *testing.T) {
+	td, err := ioutil.TempDir("", "input_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(td)
+
+	files := make(map[string][]byte) // served by test server
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if b, ok := files[req.URL.Path[1:]]; ok {
+			w.Write(b)
+		} else {
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	for _, format := range []string{"plain", "gzip", "zstd", "bzip2", "zip"} {
+		// Use a misleading extension to check that the format is sniffed.
+		name := format + ".csv"
+		b := compress(t, format)
+		files[name] = b
+		p := filepath.Join(td, name)
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, spec := range []string{p, "file://" + p, srv.URL + "/" + name} {
+			if got, err := readSpec(spec); err != nil {
+				t.Errorf("Reading %v failed: %v", spec, err)
+			} else if got != testData {
+				t.Errorf("Reading %v returned %q; want %q", spec, got, testData)
+			}
+		}
+	}
+
+	for _, spec := range []string{
+		filepath.Join(td, "missing.csv"),
+		srv.URL + "/missing.csv",
+		"ftp://example.org/data.csv",
+	} {
+		if _, err := readSpec(spec); err == nil {
+			t.Errorf("Reading %v unexpectedly succeeded", spec)
+		}
+	}
+}
+
+func TestOpen_Stdin(t *testing.T) {
+	// Run this test binary in a subprocess with testData on stdin.
+	if os.Getenv("INPUT_TEST_STDIN") != "" {
+		got, err := readSpec(Stdin)
+		if err != nil {
+			t.Fatal("Reading stdin failed: ", err)
+		}
+		if got != testData {
+			t.Fatalf("Reading stdin returned %q; want %q", got, testData)
+		}
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestOpen_Stdin$")
+	cmd.Env = append(os.Environ(), "INPUT_TEST_STDIN=1")
+	cmd.Stdin = bytes.NewReader(compress(t, "gzip"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("Subprocess failed: %v\n%s", err, out)
+	}
+}
+
+func TestOpen_ZipFileCount(t *testing.T) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, fn := range []string{"a.csv", "b.csv"} {
+		if _, err := w.Create(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "input_test.*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(b.Bytes())
+	f.Close()
+	if _, err := readSpec(f.Name()); err == nil {
+		t.Error("Reading zip archive with two files unexpectedly succeeded")
+	}
+}
+
+// countingCloser counts calls to Close.
+type countingCloser struct {
+	io.Reader
+	closes int
+}
+
+func (c *countingCloser) Close() error {
+	c.closes++
+	return nil
+}
+
+func TestDecompress_Close(t *testing.T) {
+	// Open closes the underlying reader when decompress fails, so decompress
+	// should only close it via the returned reader.
+	var two bytes.Buffer
+	w := zip.NewWriter(&two)
+	for _, fn := range []string{"a.csv", "b.csv"} {
+		if _, err := w.Create(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	cc := &countingCloser{Reader: bytes.NewReader(two.Bytes())}
+	if _, err := decompress(cc); err == nil {
+		t.Error("Decompressing zip archive with two files unexpectedly succeeded")
+	} else if cc.closes != 0 {
+		t.Errorf("Failed decompress closed reader %d time(s); want 0", cc.closes)
+	}
+
+	for _, format := range []string{"plain", "gzip", "zip"} {
+		cc := &countingCloser{Reader: bytes.NewReader(compress(t, format))}
+		rc, err := decompress(cc)
+		if err != nil {
+			t.Errorf("Decompressing %v failed: %v", format, err)
+			continue
+		}
+		rc.Close()
+		if cc.closes != 1 {
+			t.Errorf("Closing %v reader closed underlying reader %d time(s); want 1", format, cc.closes)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	for _, tc := range []struct{ spec, want string }{
+		{"20200901.csv", "20200901.csv"},
+		{"data/20200901.csv.gz", "20200901.csv.gz"},
+		{"file:///tmp/20200901.csv", "20200901.csv"},
+		{"http://example.org/data/20200901.csv?download=1", "20200901.csv"},
+		{Stdin, Stdin},
+	} {
+		if got := Name(tc.spec); got != tc.want {
+			t.Errorf("Name(%q) = %q; want %q", tc.spec, got, tc.want)
+		}
+	}
+}
+
+// bzip2Data contains testData compressed using bzip2.
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xb1, 0x4b,
+	0x19, 0x87, 0x00, 0x00, 0x08, 0xd9, 0x80, 0x00, 0x10, 0x00, 0x06, 0x72,
+	0x20, 0x26, 0x04, 0x07, 0x00, 0x20, 0x00, 0x22, 0x26, 0xd4, 0x69, 0xe5,
+	0x03, 0xd4, 0x29, 0x80, 0x00, 0xd9, 0xc8, 0x45, 0x29, 0x91, 0x05, 0x07,
+	0xcc, 0x37, 0xe8, 0x6b, 0xe2, 0xee, 0x48, 0xa7, 0x0a, 0x12, 0x16, 0x29,
+	0x63, 0x30, 0xe0,
+}
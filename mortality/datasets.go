@@ -0,0 +1,302 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// column lists the names that a CSV column has used.
+// The CDC has renamed columns over time, so all names are checked.
+type column []string
+
+// index returns the position of c within the supplied header row, or -1 if it isn't present.
+func (c column) index(header []string) int {
+	for i, s := range header {
+		s = trimHeader(s)
+		for _, name := range c {
+			if s == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// String returns the first name in c.
+func (c column) String() string {
+	if len(c) == 0 {
+		return ""
+	}
+	return c[0]
+}
+
+// filter matches rows with a specific value in a column.
+type filter struct {
+	col column
+	val string
+}
+
+// metric describes how a value is extracted from a dataset's rows.
+type metric struct {
+	desc string // used in plot titles, e.g. "All-Cause"
+
+	// valueCols contains the columns whose values are summed to produce the metric.
+	valueCols []column
+	// filters contains conditions that rows must satisfy to be added to the metric.
+	filters []filter
+	// subFilters optionally contains conditions for rows whose values are
+	// subtracted from the metric. If non-empty, weeks without subtracted rows
+	// are dropped.
+	subFilters []filter
+}
+
+// datasetDef describes the layout of one of the NCHS's weekly mortality datasets.
+type datasetDef struct {
+	title string // used in plot titles
+	url   string // human-readable URL for the dataset
+
+	weekEndCol column
+	stateCol   column
+	// typeCol contains "Unweighted" or "Predicted (weighted)".
+	// It is empty if the dataset doesn't include predicted values.
+	typeCol column
+	// thresholdCol contains the upper-bound threshold for expected deaths.
+	// It is empty if the dataset doesn't support computing excess deaths.
+	thresholdCol column
+
+	metrics       map[string]metric // keyed by name passed via -metric
+	defaultMetric string            // key into metrics
+
+	// schemas lists the layouts that the dataset's CSV files have used, oldest first.
+	schemas []schema
+}
+
+// columns returns all of the columns that are needed to compute m.
+// def.thresholdCol is not included.
+func (def *datasetDef) columns(m *metric) []column {
+	cols := []column{def.weekEndCol, def.stateCol}
+	if len(def.typeCol) > 0 {
+		cols = append(cols, def.typeCol)
+	}
+	cols = append(cols, m.valueCols...)
+	for _, f := range append(append([]filter{}, m.filters...), m.subFilters...) {
+		cols = append(cols, f.col)
+	}
+	return cols
+}
+
+// metricNames returns the sorted keys from def.metrics.
+func (def *datasetDef) metricNames() []string {
+	names := make([]string, 0, len(def.metrics))
+	for n := range def.metrics {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getMetric returns the named metric, or the default metric if name is empty.
+func (def *datasetDef) getMetric(name string) (*metric, error) {
+	if name == "" {
+		name = def.defaultMetric
+	}
+	m, ok := def.metrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q (valid: %s)", name, strings.Join(def.metricNames(), ", "))
+	}
+	return &m, nil
+}
+
+// datasetNames returns the sorted keys from datasets.
+func datasetNames() []string {
+	names := make([]string, 0, len(datasets))
+	for n := range datasets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Column names shared by multiple datasets.
+var (
+	weekEndingDateCol = column{"Week Ending Date"}
+	typeCol           = column{"Type"}
+)
+
+// datasets contains the supported datasets, keyed by name passed via -dataset.
+var datasets = map[string]*datasetDef{
+	// https://data.cdc.gov/NCHS/Excess-Deaths-Associated-with-COVID-19/xkkf-xrst/
+	"excess": {
+		title:        "CDC Weekly",
+		url:          "https://data.cdc.gov/NCHS/Excess-Deaths-Associated-with-COVID-19/xkkf-xrst/",
+		weekEndCol:   weekEndingDateCol,
+		stateCol:     column{"State"},
+		typeCol:      typeCol,
+		thresholdCol: column{"Upper Bound Threshold", "Threshold"}, // column name changed
+		metrics: map[string]metric{
+			"all": {
+				desc:      "All-Cause",
+				valueCols: []column{{"Observed Number"}},
+				filters:   []filter{{column{"Outcome"}, "All causes"}},
+			},
+			"covid": {
+				desc:       "COVID-19",
+				valueCols:  []column{{"Observed Number"}},
+				filters:    []filter{{column{"Outcome"}, "All causes"}},
+				subFilters: []filter{{column{"Outcome"}, "All causes, excluding COVID-19"}},
+			},
+		},
+		defaultMetric: "all",
+		schemas: []schema{
+			{
+				version: "2020-04",
+				header: []string{"Week Ending Date", "State", "Observed Number", "Upper Bound Threshold",
+					"Exceeds Threshold", "Average Expected Count", "Excess Lower Estimate",
+					"Excess Higher Estimate", "Year", "Total Excess Lower Estimate in 2020",
+					"Total Excess Higher Estimate in 2020", "Percent Excess Lower Estimate",
+					"Percent Excess Higher Estimate", "Type", "Outcome", "Suppress", "Note"},
+				dateLayout: "01/02/2006",
+			},
+			{
+				version: "2020-07",
+				header: []string{"Week Ending Date", "State", "Observed Number", "Threshold",
+					"Exceeds Threshold", "Average Expected Count", "Excess Lower Estimate",
+					"Excess Higher Estimate", "Year", "Total Excess Lower Estimate in 2020",
+					"Total Excess Higher Estimate in 2020", "Percent Excess Lower Estimate",
+					"Percent Excess Higher Estimate", "Type", "Outcome", "Suppress", "Note"},
+				dateLayout: "2006-01-02",
+			},
+		},
+	},
+
+	// https://data.cdc.gov/NCHS/Weekly-counts-of-deaths-by-jurisdiction-and-age-gr/y5bj-9g5w
+	"age": {
+		title:      "CDC Weekly",
+		url:        "https://data.cdc.gov/NCHS/Weekly-counts-of-deaths-by-jurisdiction-and-age-gr/y5bj-9g5w/",
+		weekEndCol: weekEndingDateCol,
+		stateCol:   column{"Jurisdiction"},
+		typeCol:    typeCol,
+		metrics: map[string]metric{
+			"all":      {desc: "All-Age", valueCols: []column{{"Number of Deaths"}}},
+			"under25":  ageMetric("Under 25 years"),
+			"25-44":    ageMetric("25-44 years"),
+			"45-64":    ageMetric("45-64 years"),
+			"65-74":    ageMetric("65-74 years"),
+			"75-84":    ageMetric("75-84 years"),
+			"85andold": ageMetric("85 years and older"),
+		},
+		defaultMetric: "all",
+		schemas: []schema{
+			{
+				version: "2020-06",
+				header: []string{"Jurisdiction", "Week Ending Date", "State Abbreviation", "Year", "Week",
+					"Age Group", "Number of Deaths", "Time Period", "Type", "Suppress", "Note"},
+				dateLayout: "01/02/2006",
+			},
+		},
+	},
+
+	// https://data.cdc.gov/NCHS/Weekly-Counts-of-Deaths-by-State-and-Select-Causes/muzy-jte6
+	"cause": {
+		title:      "CDC Weekly",
+		url:        "https://data.cdc.gov/NCHS/Weekly-Counts-of-Deaths-by-State-and-Select-Causes/muzy-jte6/",
+		weekEndCol: weekEndingDateCol,
+		stateCol:   column{"Jurisdiction of Occurrence"},
+		metrics: map[string]metric{
+			"all":     causeMetric("All-Cause", allCauseCol),
+			"natural": causeMetric("Natural-Cause", column{"Natural Cause"}),
+			"covid":   causeMetric("COVID-19", covidUnderlyingCol),
+			"covid-multiple": causeMetric("COVID-19 (Multiple Cause)",
+				column{"COVID-19 (U071, Multiple Cause of Death)"}),
+			"respiratory":     causeMetric("Respiratory", fluPneumoniaCol, lowerRespCol, otherRespCol),
+			"flu-pneumonia":   causeMetric("Influenza and Pneumonia", fluPneumoniaCol),
+			"lower-resp":      causeMetric("Chronic Lower Respiratory", lowerRespCol),
+			"circulatory":     causeMetric("Circulatory", heartCol, cerebrovascularCol),
+			"heart":           causeMetric("Heart Disease", heartCol),
+			"cerebrovascular": causeMetric("Cerebrovascular", cerebrovascularCol),
+			"alzheimer":       causeMetric("Alzheimer Disease", column{"Alzheimer disease (G30)"}),
+			"diabetes":        causeMetric("Diabetes", column{"Diabetes mellitus (E10-E14)"}),
+			"cancer":          causeMetric("Cancer", column{"Malignant neoplasms (C00-C97)"}),
+		},
+		defaultMetric: "all",
+		schemas: []schema{
+			{
+				version: "2020-05",
+				header: []string{"Jurisdiction of Occurrence", "MMWR Year", "MMWR Week", "Week Ending Date",
+					"All Cause", "Natural Cause", "Septicemia (A40-A41)", "Malignant neoplasms (C00-C97)",
+					"Diabetes mellitus (E10-E14)", "Alzheimer disease (G30)",
+					"Influenza and pneumonia (J09-J18)", "Chronic lower respiratory diseases (J40-J47)",
+					"Other diseases of respiratory system (J00-J06,J30-J39,J67,J70-J98)",
+					"Nephritis, nephrotic syndrome and nephrosis (N00-N07,N17-N19,N25-N27)",
+					"Symptoms, signs and abnormal clinical and laboratory findings, not elsewhere classified (R00-R99)",
+					"Diseases of heart (I00-I09,I11,I13,I20-I51)", "Cerebrovascular diseases (I60-I69)",
+					"COVID-19 (U071, Multiple Cause of Death)", "COVID-19 (U071, Underlying Cause of Death)"},
+				dateLayout: "2006-01-02",
+			},
+		},
+	},
+
+	// https://data.cdc.gov/NCHS/Provisional-COVID-19-Death-Counts-by-Week-Ending-D/r8kw-7aab
+	"jurisdiction": {
+		title:      "CDC Provisional",
+		url:        "https://data.cdc.gov/NCHS/Provisional-COVID-19-Death-Counts-by-Week-Ending-D/r8kw-7aab/",
+		weekEndCol: column{"End Week", "End Date"},
+		stateCol:   column{"State"},
+		metrics: map[string]metric{
+			"all":       {desc: "All-Cause", valueCols: []column{{"Total Deaths"}}},
+			"covid":     {desc: "COVID-19", valueCols: []column{{"COVID-19 Deaths"}}},
+			"pneumonia": {desc: "Pneumonia", valueCols: []column{{"Pneumonia Deaths"}}},
+			"influenza": {desc: "Influenza", valueCols: []column{{"Influenza Deaths"}}},
+			"pic": {desc: "Pneumonia, Influenza, or COVID-19",
+				valueCols: []column{{"Pneumonia, Influenza, or COVID-19 Deaths"}}},
+		},
+		defaultMetric: "all",
+		schemas: []schema{
+			{
+				version: "2020-05",
+				header: []string{"Data as of", "Start week", "End Week", "State", "COVID-19 Deaths",
+					"Total Deaths", "Percent of Expected Deaths", "Pneumonia Deaths",
+					"Pneumonia and COVID-19 Deaths", "Influenza Deaths",
+					"Pneumonia, Influenza, or COVID-19 Deaths", "Footnote"},
+				dateLayout: "01/02/2006",
+			},
+			{
+				version: "2020-09",
+				header: []string{"Data as of", "Start Date", "End Date", "State", "COVID-19 Deaths",
+					"Total Deaths", "Percent of Expected Deaths", "Pneumonia Deaths",
+					"Pneumonia and COVID-19 Deaths", "Influenza Deaths",
+					"Pneumonia, Influenza, or COVID-19 Deaths", "Footnote"},
+				dateLayout: "01/02/2006",
+			},
+		},
+	},
+}
+
+// Columns from the "cause" dataset that are used by multiple metrics.
+var (
+	allCauseCol        = column{"All Cause"}
+	covidUnderlyingCol = column{"COVID-19 (U071, Underlying Cause of Death)"}
+	fluPneumoniaCol    = column{"Influenza and pneumonia (J09-J18)"}
+	lowerRespCol       = column{"Chronic lower respiratory diseases (J40-J47)"}
+	otherRespCol       = column{"Other diseases of respiratory system (J00-J06,J30-J39,J67,J70-J98)"}
+	heartCol           = column{"Diseases of heart (I00-I09,I11,I13,I20-I51)"}
+	cerebrovascularCol = column{"Cerebrovascular diseases (I60-I69)"}
+)
+
+// ageMetric returns a metric for rows in the "age" dataset with the supplied age group.
+func ageMetric(group string) metric {
+	return metric{
+		desc:      "Age " + strings.TrimSuffix(group, " years"),
+		valueCols: []column{{"Number of Deaths"}},
+		filters:   []filter{{column{"Age Group"}, group}},
+	}
+}
+
+// causeMetric returns a metric summing the supplied columns from the "cause" dataset.
+func causeMetric(desc string, cols ...column) metric {
+	return metric{desc: desc, valueCols: cols}
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/derat/covid/obs"
+)
+
+// exportMetric returns the obs.Metric used when exporting the named metric from the
+// named dataset. COVID-19 and all-cause deaths use common metrics, while other
+// metrics are prefixed by their datasets, e.g. "cause:respiratory".
+func exportMetric(dataset, metric string, predicted, excess bool) obs.Metric {
+	var m obs.Metric
+	switch metric {
+	case "covid":
+		m = obs.Deaths
+	case "all":
+		m = obs.AllDeaths
+	default:
+		m = obs.Metric(dataset + ":" + metric)
+	}
+	if predicted {
+		m += ":predicted"
+	}
+	if excess {
+		m += ":excess"
+	}
+	return m
+}
+
+// records returns weekly records containing ds's values as metric m.
+// Each file's date is used as its values' snapshot date.
+func (ds *dataSet) records(m obs.Metric) ([]obs.Record, error) {
+	geo, ok := obs.StateGeo(ds.state)
+	if !ok {
+		return nil, fmt.Errorf("unknown state %q", ds.state)
+	}
+	var recs []obs.Record
+	for _, we := range ds.sortedWeekEnds() {
+		date, err := time.Parse(dateLayout, we)
+		if err != nil {
+			return nil, err
+		}
+		for fd, v := range ds.weekSeries[we] {
+			snap, err := time.Parse(dateLayout, fd)
+			if err != nil {
+				return nil, err
+			}
+			recs = append(recs, obs.Record{
+				Date:     date,
+				Period:   obs.Weekly,
+				Geo:      geo,
+				Metric:   m,
+				Value:    float64(v),
+				Source:   obs.CDC,
+				Snapshot: snap,
+			})
+		}
+	}
+	obs.Sort(recs)
+	return recs, nil
+}
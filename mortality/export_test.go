@@ -0,0 +1,60 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/derat/covid/obs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportMetric(t *testing.T) {
+	for _, tc := range []struct {
+		dataset, metric   string
+		predicted, excess bool
+		want              obs.Metric
+	}{
+		{"excess", "covid", false, false, obs.Deaths},
+		{"excess", "all", false, true, obs.AllDeaths + ":excess"},
+		{"jurisdiction", "covid", true, false, obs.Deaths + ":predicted"},
+		{"cause", "respiratory", false, false, "cause:respiratory"},
+	} {
+		if got := exportMetric(tc.dataset, tc.metric, tc.predicted, tc.excess); got != tc.want {
+			t.Errorf("exportMetric(%q, %q, %v, %v) = %q; want %q",
+				tc.dataset, tc.metric, tc.predicted, tc.excess, got, tc.want)
+		}
+	}
+}
+
+func TestDataSet_Records(t *testing.T) {
+	ds := newDataSet(datasets["excess"], nil, "Puerto Rico", time.Time{}, time.Time{}, false, false)
+	ds.weekSeries = map[string]timeseries{
+		"20200627": {"20200708": 80, "20200702": 50},
+		"20200704": {"20200708": 3},
+	}
+	date := func(m time.Month, d int) time.Time { return time.Date(2020, m, d, 0, 0, 0, 0, time.UTC) }
+	rec := func(we, fd time.Time, v float64) obs.Record {
+		return obs.Record{Date: we, Period: obs.Weekly, Geo: "PR", Metric: obs.Deaths,
+			Value: v, Source: obs.CDC, Snapshot: fd}
+	}
+	want := []obs.Record{
+		rec(date(6, 27), date(7, 2), 50),
+		rec(date(6, 27), date(7, 8), 80),
+		rec(date(7, 4), date(7, 8), 3),
+	}
+	got, err := ds.records(obs.Deaths)
+	if err != nil {
+		t.Fatal("records failed: ", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Bad records:\n" + diff)
+	}
+
+	ds.state = "Atlantis"
+	if _, err := ds.records(obs.Deaths); err == nil {
+		t.Error("records unexpectedly succeeded for unknown state")
+	}
+}
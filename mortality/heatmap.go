@@ -0,0 +1,156 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// sortedStates returns the keys from m, sorted in ascending order.
+func sortedStates(m map[string]*dataSet) []string {
+	states := make([]string, 0, len(m))
+	for st := range m {
+		states = append(states, st)
+	}
+	sort.Strings(states)
+	return states
+}
+
+// daysBetween returns the number of days from a to b, both formatted using dateLayout.
+func daysBetween(a, b string) int {
+	at, _ := time.Parse(dateLayout, a)
+	bt, _ := time.Parse(dateLayout, b)
+	return int(math.Round(float64(bt.Sub(at)) / float64(24*time.Hour)))
+}
+
+// completeness returns the fraction of each week's eventual count that had been reported
+// d days after the end of the week, for d in [0, maxLag]. The outer slice is ordered by
+// ds.sortedWeekEnds(). The eventual count is the maximum value that was ever reported for
+// the week, as in summarize. NaN is used for days before the first snapshot that included
+// the week and after the last snapshot.
+func (ds *dataSet) completeness(maxLag int) [][]float64 {
+	fileDates := ds.sortedFileDates()
+	weekEnds := ds.sortedWeekEnds()
+	comp := make([][]float64, len(weekEnds))
+
+	for i, we := range weekEnds {
+		ts := ds.weekSeries[we]
+		max := 0
+		for _, v := range ts {
+			if v > max {
+				max = v
+			}
+		}
+
+		comp[i] = make([]float64, maxLag+1)
+		for d := range comp[i] {
+			comp[i][d] = math.NaN()
+		}
+		if max <= 0 {
+			continue
+		}
+
+		// Fill each day with the value from the most-recent snapshot,
+		// stopping at the last snapshot.
+		last := -1
+		for _, fd := range fileDates {
+			v, ok := ts[fd]
+			if !ok {
+				continue
+			}
+			lag := daysBetween(we, fd)
+			if lag < 0 || lag > maxLag {
+				continue
+			}
+			frac := float64(v) / float64(max)
+			for d := lag; d <= maxLag; d++ {
+				comp[i][d] = frac
+			}
+			last = lag
+		}
+		if last >= 0 {
+			for d := last + 1; d <= maxLag; d++ {
+				comp[i][d] = math.NaN()
+			}
+		}
+	}
+	return comp
+}
+
+// writeHeatmap writes ds's completeness data to w in gnuplot's format.
+// Each line contains an X index, the week-ending date, the days since the week ended,
+// and the fraction of the week's eventual count that had been reported.
+func (ds *dataSet) writeHeatmap(w io.Writer, maxLag int) error {
+	var writeErr error
+	writef := func(format string, args ...interface{}) {
+		if writeErr == nil {
+			_, writeErr = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	writef("X\tWeek\tLag\tFraction\n")
+	weekEnds := ds.sortedWeekEnds()
+	for i, comp := range ds.completeness(maxLag) {
+		wt, _ := time.Parse(dateLayout, weekEnds[i])
+		for d, frac := range comp {
+			if math.IsNaN(frac) {
+				writef("%d\t%s\t%d\tNaN\n", i, wt.Format("01/02"), d)
+			} else {
+				writef("%d\t%s\t%d\t%0.3f\n", i, wt.Format("01/02"), d, frac)
+			}
+		}
+	}
+	return writeErr
+}
+
+// writeHeatmapData writes each dataSet's completeness data to w as a separate gnuplot data block.
+func writeHeatmapData(w io.Writer, sets []*dataSet, maxLag int) error {
+	for i, ds := range sets {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n\n"); err != nil {
+				return err
+			}
+		}
+		if err := ds.writeHeatmap(w, maxLag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plotHeatmap plots heatmaps of the supplied dataSets' completeness data using out.
+// If sets contains multiple dataSets, they are drawn as small multiples.
+func plotHeatmap(sets []*dataSet, maxLag int, out output) error {
+	var b bytes.Buffer
+	if err := writeHeatmapData(&b, sets, maxLag); err != nil {
+		return fmt.Errorf("failed writing data: %v", err)
+	}
+
+	states := make([]string, len(sets))
+	for i, ds := range sets {
+		states[i] = ds.state
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(len(sets)))))
+	rows := (len(sets) + cols - 1) / cols
+
+	td, err := templateData(out, map[string]interface{}{
+		"Title":  "Reporting Completeness of " + sets[0].title(len(sets) == 1),
+		"URL":    sets[0].def.url,
+		"MaxLag": maxLag,
+		"States": states,
+		"Rows":   rows,
+		"Cols":   cols,
+	})
+	if err != nil {
+		return err
+	}
+	return gnuplot.ExecTemplateOptions(heatmapTmpl, td, out.scriptOptions(b.Bytes()))
+}
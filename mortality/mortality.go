@@ -4,24 +4,30 @@
 package main
 
 import (
+	"bytes"
 	"encoding/csv"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
+
+	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/input"
+	"github.com/derat/covid/obs"
 )
 
-const dateLayout = "20060102"
+const (
+	dateLayout = "20060102"
+
+	// allStates can be passed via -state to read data for all states.
+	allStates = "all"
+)
 
 func main() {
 	now := time.Now()
@@ -30,13 +36,28 @@ func main() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] <YYYYMMDD.csv> ...\n", os.Args[0])
 		flag.PrintDefaults()
 	}
-	action := flag.String("action", "plot", `Action to perform ("plot", "summarize")`)
-	state := flag.String("state", "", `State as it appears in CSV files, e.g. "California", or empty for all`)
+	action := flag.String("action", "plot", `Action to perform ("plot", "heatmap", "summarize", "export", "schemas")`)
+	dataset := flag.String("dataset", "excess",
+		fmt.Sprintf("CDC dataset that CSV files were downloaded from (%s)", strings.Join(datasetNames(), ", ")))
+	metricName := flag.String("metric", "", `Metric to read from dataset, e.g. "all" or "covid" (empty for dataset's default)`)
+	state := flag.String("state", "", `State as it appears in CSV files, e.g. "California", `+
+		`empty for "United States", or "`+allStates+`" for all states`)
+	maxLag := flag.Int("max-lag", 120, "Maximum days after week end to show in heatmaps")
 	start := flag.String("start", now.AddDate(0, -3, 0).Format(dateLayout), `Starting week-ending date`)
 	end := flag.String("end", now.Format(dateLayout), `Ending week-ending date`)
-	covid := flag.Bool("covid", false, "Show only deaths attributed to COVID-19")
+	covid := flag.Bool("covid", false, `Show only deaths attributed to COVID-19 (shorthand for -metric=covid)`)
 	predicted := flag.Bool("predicted", false, "Use predicted deaths rather than observed")
 	excess := flag.Bool("excess", false, "Show excess (vs. upper-bound threshold) deaths")
+	fileDate := flag.String("file-date", "", `Download date (YYYYMMDD) for input files not named YYYYMMDD.csv, `+
+		`e.g. URLs (empty to use today for stdin)`)
+	var out output
+	flag.StringVar(&out.path, "out", "", `Image file to write plots to (".png", ".svg", ".pdf", ".html"); `+
+		`state is appended with -state=`+allStates+` (empty to display interactively)`)
+	flag.StringVar(&out.term, "term", "", `gnuplot terminal for -out, e.g. "pngcairo" (empty to use extension)`)
+	flag.BoolVar(&out.keep, "keep-scripts", false, "Keep self-contained gnuplot scripts next to -out for debugging")
+	flag.StringVar(&out.size, "size", "", `gnuplot terminal size for -out, e.g. "1280,960" (empty for theme's size)`)
+	themeName := flag.String("theme", gnuplot.DefaultTheme,
+		fmt.Sprintf("Plot theme (%s)", strings.Join(gnuplot.ThemeNames(), ", ")))
 	flag.Parse()
 
 	if len(flag.Args()) == 0 {
@@ -44,8 +65,34 @@ func main() {
 		os.Exit(2)
 	}
 
-	if *covid && *excess {
-		log.Fatal("Can't use -covid and -excess simultaneously")
+	def, ok := datasets[*dataset]
+	if !ok {
+		log.Fatalf("Unknown -dataset %q", *dataset)
+	}
+	var err error
+	if out.theme, err = gnuplot.LookupTheme(*themeName); err != nil {
+		log.Fatal("Bad -theme: ", err)
+	}
+	if *covid {
+		if *metricName != "" && *metricName != "covid" {
+			log.Fatal("Can't use -covid and -metric simultaneously")
+		}
+		*metricName = "covid"
+	}
+	met, err := def.getMetric(*metricName)
+	if err != nil {
+		log.Fatal("Bad -metric: ", err)
+	}
+	if *excess {
+		if len(def.thresholdCol) == 0 {
+			log.Fatalf("-excess not supported for %q dataset", *dataset)
+		}
+		if len(met.subFilters) > 0 {
+			log.Fatal("Can't use -excess with subtracted metrics like COVID-19")
+		}
+	}
+	if *predicted && len(def.typeCol) == 0 {
+		log.Fatalf("-predicted not supported for %q dataset", *dataset)
 	}
 
 	if *state == "" {
@@ -59,67 +106,134 @@ func main() {
 	if err != nil {
 		log.Fatalf("Bad -end date %q: %v", *end, err)
 	}
+	if *fileDate != "" {
+		if _, err := time.Parse(dateLayout, *fileDate); err != nil {
+			log.Fatalf("Bad -file-date %q: %v", *fileDate, err)
+		}
+	}
 
 	// Read the CSV files.
-	ds := newDataSet(*state, startDate, endDate, *covid, *predicted, *excess)
-	for _, p := range flag.Args() {
-		if err := ds.readFile(p); err != nil {
-			log.Fatalf("Failed reading %v: %v", p, err)
+	var sets []*dataSet // sorted by state
+	var snaps []*snapshot
+	if *state == allStates {
+		m := make(map[string]*dataSet)
+		for _, p := range flag.Args() {
+			snap, err := readFile(p, *fileDate, def, met, func(st string) *dataSet {
+				ds, ok := m[st]
+				if !ok {
+					ds = newDataSet(def, met, st, startDate, endDate, *predicted, *excess)
+					m[st] = ds
+				}
+				return ds
+			})
+			if err != nil {
+				log.Fatalf("Failed reading %v: %v", p, err)
+			}
+			snaps = append(snaps, snap)
+		}
+		for _, st := range sortedStates(m) {
+			sets = append(sets, m[st])
+		}
+	} else {
+		ds := newDataSet(def, met, *state, startDate, endDate, *predicted, *excess)
+		for _, p := range flag.Args() {
+			snap, err := ds.readFile(p, *fileDate)
+			if err != nil {
+				log.Fatalf("Failed reading %v: %v", p, err)
+			}
+			snaps = append(snaps, snap)
+		}
+		sets = []*dataSet{ds}
+	}
+	if *action != "schemas" {
+		for _, snap := range snaps {
+			for _, w := range snap.warnings {
+				log.Printf("%v (schema %v): %v", snap.path, snap.version, w)
+			}
 		}
 	}
+	if len(sets) == 0 && *action != "schemas" {
+		log.Fatal("No data found")
+	}
 
 	switch *action {
 	case "plot":
-		// Write the data to a temp file.
-		dp, err := writeData(ds)
-		if err != nil {
-			log.Fatal("Failed writing data file: ", err)
+		if len(sets) > 1 && out.path == "" {
+			log.Fatalf("-state=%v requires -out for plot", allStates)
 		}
-		defer os.Remove(dp)
-
-		// Write the gnuplot commands to a temp file.
-		gp, err := writeGnuplot(ds, dp)
-		if err != nil {
-			log.Fatal("Failed writing gnuplot file: ", err)
+		for _, ds := range sets {
+			o := out
+			if len(sets) > 1 {
+				o = out.forState(ds.state)
+			}
+			if err := plotLines(ds, o); err != nil {
+				log.Fatalf("Failed plotting %v: %v", ds.state, err)
+			}
 		}
-		defer os.Remove(gp)
-
-		if err := exec.Command("gnuplot", "-p", gp).Run(); err != nil {
-			log.Fatal("Failed running gnuplot: ", err)
+	case "heatmap":
+		if err := plotHeatmap(sets, *maxLag, out); err != nil {
+			log.Fatal("Failed plotting heatmap: ", err)
 		}
 	case "summarize":
-		if err := ds.summarize(os.Stdout); err != nil {
-			log.Fatal("Failed writing summary: ", err)
+		for _, ds := range sets {
+			if len(sets) > 1 {
+				fmt.Printf("== %s ==\n\n", ds.state)
+			}
+			if err := ds.summarize(os.Stdout); err != nil {
+				log.Fatal("Failed writing summary: ", err)
+			}
+		}
+	case "export":
+		name := *metricName
+		if name == "" {
+			name = def.defaultMetric
+		}
+		m := exportMetric(*dataset, name, *predicted, *excess)
+		var recs []obs.Record
+		for _, ds := range sets {
+			rs, err := ds.records(m)
+			if err != nil {
+				log.Fatalf("Failed exporting %v: %v", ds.state, err)
+			}
+			recs = append(recs, rs...)
+		}
+		obs.Sort(recs)
+		if err := obs.WriteCSV(os.Stdout, recs); err != nil {
+			log.Fatal("Failed writing records: ", err)
+		}
+	case "schemas":
+		for _, snap := range snaps {
+			fmt.Printf("%s: %s %s (%d warning(s))\n", snap.path, *dataset, snap.version, len(snap.warnings))
+			for _, w := range snap.warnings {
+				fmt.Printf("  %s\n", w)
+			}
 		}
 	default:
 		log.Fatalf("Invalid action %q", *action)
 	}
 }
 
-// writeData creates a temp file and writes ds's data to it.
-// The file's path is returned.
-func writeData(ds *dataSet) (string, error) {
-	f, err := ioutil.TempFile("", "mortality.data.")
-	if err != nil {
-		return "", err
-	}
-	if err := ds.write(f); err != nil {
-		f.Close()
-		os.Remove(f.Name())
-		return "", err
+// plotLines plots ds's data with one line per week using out.
+func plotLines(ds *dataSet, out output) error {
+	var b bytes.Buffer
+	if err := ds.write(&b); err != nil {
+		return fmt.Errorf("failed writing data: %v", err)
 	}
-	err = f.Close()
-	return f.Name(), err
-}
 
-// writeGnuplot writes a gnuplot file for plotting data from dataPath,
-// the path returned by an earlier writeData(ds) call.
-func writeGnuplot(ds *dataSet, dataPath string) (string, error) {
-	f, err := ioutil.TempFile("", "mortality.gnuplot.")
+	td, err := templateData(out, map[string]interface{}{
+		"Title":    ds.title(true),
+		"URL":      ds.def.url,
+		"NumLines": len(ds.weekSeries),
+	})
 	if err != nil {
-		return "", err
+		return err
 	}
+	return gnuplot.ExecTemplateOptions(linesTmpl, td, out.scriptOptions(b.Bytes()))
+}
 
+// title returns a title describing ds's data, e.g. "CDC Weekly Observed All-Cause Mortality".
+// If withState is true, " for <state>" is appended.
+func (ds *dataSet) title(withState bool) string {
 	var titleParts []string
 	addTitlePart := func(cond bool, a, b string) {
 		if cond {
@@ -128,61 +242,13 @@ func writeGnuplot(ds *dataSet, dataPath string) (string, error) {
 			titleParts = append(titleParts, b)
 		}
 	}
-	addTitlePart(true, "CDC Weekly", "")
-	addTitlePart(ds.predicted, "Predicted", "Observed")
+	addTitlePart(true, ds.def.title, "")
+	addTitlePart(len(ds.def.typeCol) > 0 && ds.predicted, "Predicted", "Observed")
 	addTitlePart(ds.excess, "Excess", "")
-	addTitlePart(ds.covid, "COVID-19", "All-Cause")
-	addTitlePart(true, "Mortality for", "")
-	addTitlePart(ds.state != "", ds.state, "United States")
-	title := strings.Join(titleParts, " ")
-
-	if err := template.Must(template.New("").Funcs(map[string]interface{}{
-		"indexCol": func(i int) int { return i + 2 },
-	}).Parse(`
-set title "{{.Title}}\n\n" . \
-  "{/*0.8 Source: https://data.cdc.gov/NCHS/Excess-Deaths-Associated-with-COVID-19/xkkf-xrst/\n}" . \
-  "{/*0.8 Shows changes to CDC data over time.}"
-
-set xlabel 'Data Update Date'
-set xdata time
-set timefmt '%Y%m%d'
-
-set ylabel 'Deaths'
-set yrange [*<0:*]
-set grid xtics ytics
-
-set key autotitle columnheader outside top right title 'Week Ending'
-
-# https://stackoverflow.com/a/57239036
-set linetype  1 lc rgb "dark-violet" lw 1 dt 1 pt 0
-set linetype  2 lc rgb "#009e73"     lw 1 dt 1 pt 7
-set linetype  3 lc rgb "#56b4e9"     lw 1 dt 1 pt 6 pi -1
-set linetype  4 lc rgb "#e69f00"     lw 1 dt 1 pt 5 pi -1
-set linetype  5 lc rgb "#f0e442"     lw 1 dt 1 pt 8
-set linetype  6 lc rgb "#0072b2"     lw 1 dt 1 pt 3
-set linetype  7 lc rgb "#e51e10"     lw 1 dt 1 pt 11
-set linetype  8 lc rgb "black"       lw 1 dt 1
-set linetype  9 lc rgb "dark-violet" lw 1 dt 3 pt 0
-set linetype 10 lc rgb "#009e73"     lw 1 dt 3 pt 7
-set linetype 11 lc rgb "#56b4e9"     lw 1 dt 3 pt 6 pi -1
-set linetype 12 lc rgb "#e69f00"     lw 1 dt 3 pt 5 pi -1
-set linetype 13 lc rgb "#f0e442"     lw 1 dt 3 pt 8
-set linetype 14 lc rgb "#0072b2"     lw 1 dt 3 pt 3
-set linetype 15 lc rgb "#e51e10"     lw 1 dt 3 pt 11
-set linetype 16 lc rgb "black"       lw 1 dt 3
-set linetype cycle 16
-
-num_lines = {{.NumLines}}
-plot for [i=2:num_lines+2] '{{.DataPath}}' using 1:i with lines
-`)).Execute(f, struct {
-		Title    string
-		DataPath string
-		NumLines int
-	}{title, dataPath, len(ds.weekSeries)}); err != nil {
-		f.Close()
-		return "", err
-	}
-	return f.Name(), f.Close()
+	addTitlePart(true, ds.metric.desc, "")
+	addTitlePart(true, "Mortality", "")
+	addTitlePart(withState, "for "+ds.state, "")
+	return strings.Join(titleParts, " ")
 }
 
 // timeseries contains the values of a variable at different points in time.
@@ -192,23 +258,25 @@ type timeseries map[string]int
 // It parses CSV files downloaded on different days and tracks how each week's
 // reported mortality has changed over time.
 type dataSet struct {
-	state      string    // state name, e.g. "California"
-	start, end time.Time // start and end dates
-	covid      bool
+	def        *datasetDef // layout of CSV files
+	metric     *metric     // value to extract from def
+	state      string      // state name, e.g. "California"
+	start, end time.Time   // start and end dates
 	predicted  bool
 	excess     bool
 	fileDates  map[string]struct{}   // dates of parsed data as e.g. "20200425"
 	weekSeries map[string]timeseries // keyed by week end as e.g. "20200425"
 }
 
-// newDataSet returns a new dataSet that saves mortality data for week-ending
-// dates between start and end for the supplied state.
-func newDataSet(state string, start, end time.Time, covid, predicted, excess bool) *dataSet {
+// newDataSet returns a new dataSet that saves m's values from def for
+// week-ending dates between start and end for the supplied state.
+func newDataSet(def *datasetDef, m *metric, state string, start, end time.Time, predicted, excess bool) *dataSet {
 	return &dataSet{
+		def:        def,
+		metric:     m,
 		state:      state,
 		start:      start,
 		end:        end,
-		covid:      covid,
 		predicted:  predicted,
 		excess:     excess,
 		fileDates:  make(map[string]struct{}),
@@ -238,106 +306,181 @@ func (ds *dataSet) sortedFileDates() []string {
 
 // readFile parses the CSV file at p.
 // The path's base filename must have the form 'YYYYMMDD.csv'
-// (describing the day when the file was downloaded).
-func (ds *dataSet) readFile(p string) error {
-	f, err := os.Open(p)
+// (describing the day when the file was downloaded) unless defDate is supplied
+// as described in getFileDate.
+func (ds *dataSet) readFile(p, defDate string) (*snapshot, error) {
+	fileDate, err := getFileDate(p, defDate)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
+	ds.fileDates[fileDate] = struct{}{}
 
-	// Extract the date from the filename.
-	base := filepath.Base(p)
-	ext := filepath.Ext(base)
-	fileDate := base[:len(base)-len(ext)]
+	return readFile(p, defDate, ds.def, ds.metric, func(state string) *dataSet {
+		if state == ds.state {
+			return ds
+		}
+		return nil
+	})
+}
+
+// getFileDate extracts the date (e.g. "20200425") from p's base filename.
+// If the name doesn't contain a date, defDate is returned if it is non-empty.
+// Otherwise, today's date is used for stdin, which has no name.
+func getFileDate(p, defDate string) (string, error) {
+	fileDate := input.Name(p)
+	if i := strings.IndexByte(fileDate, '.'); i >= 0 {
+		fileDate = fileDate[:i] // strip extensions like ".csv.gz"
+	}
 	if _, err := time.Parse(dateLayout, fileDate); err != nil {
-		return fmt.Errorf("file not named YYYYMMDD.csv: %v", err)
+		switch {
+		case defDate != "":
+			return defDate, nil
+		case p == input.Stdin:
+			return time.Now().Format(dateLayout), nil
+		}
+		return "", fmt.Errorf("file not named YYYYMMDD.csv (use -file-date?): %v", err)
 	}
-	ds.fileDates[fileDate] = struct{}{}
+	return fileDate, nil
+}
+
+// readFile parses the CSV file at p, which must be named as described in dataSet.readFile
+// unless defDate is supplied.
+// getSet is called with each row's state and returns the dataSet that should receive the row,
+// or nil if the row should be skipped. All returned dataSets must use def and m.
+// Problems that don't prevent m from being computed are reported as warnings in the
+// returned snapshot rather than as errors.
+func readFile(p, defDate string, def *datasetDef, m *metric, getSet func(state string) *dataSet) (*snapshot, error) {
+	fileDate, err := getFileDate(p, defDate)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{path: p, fileDate: fileDate}
+
+	f, err := input.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
 	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1 // check row lengths ourselves
 
-	// Find the positions of columns that we care about.
-	cols, err := r.Read()
+	// Identify the file's layout and find the positions of columns that we care about.
+	header, err := r.Read()
 	if err != nil {
-		return fmt.Errorf("failed reading header: %v", err)
-	}
-	var weekEndCol, stateCol, observedCol, thresholdCol, typeCol, outcomeCol int
-	for nameList, dst := range map[string]*int{
-		"Week Ending Date":                &weekEndCol,
-		"State":                           &stateCol,
-		"Observed Number":                 &observedCol,
-		"Upper Bound Threshold,Threshold": &thresholdCol, // column named changed
-		"Type":                            &typeCol,
-		"Outcome":                         &outcomeCol,
-	} {
-		names := strings.Split(nameList, ",")
-		found := false
-	ColumnLoop:
-		for i, s := range cols {
-			s = strings.TrimLeft(s, "\ufeff") // sigh
-			for _, name := range names {
-				if s == name {
-					*dst = i
-					found = true
-					break ColumnLoop
-				}
+		return nil, fmt.Errorf("failed reading header: %v", err)
+	}
+	var schemaLayout string
+	if sch := def.detectSchema(header, snap); sch != nil {
+		schemaLayout = sch.dateLayout
+	}
+	dateLayouts := def.dateLayouts(schemaLayout)
+
+	cols := make(map[string]int) // keyed by column.String()
+	findCol := func(c column, required bool) error {
+		i, renamed := c.find(header)
+		if i < 0 {
+			if required {
+				return fmt.Errorf("missing column %q (schema %v)", strings.Join(c, ","), snap.version)
 			}
+			snap.warnf("missing column %q", strings.Join(c, ","))
+			return nil
+		}
+		if renamed != "" {
+			snap.warnf("using column %q for %q", renamed, c.String())
 		}
-		if !found {
-			return fmt.Errorf("missing column %q", nameList)
+		cols[c.String()] = i
+		return nil
+	}
+	for _, c := range def.columns(m) {
+		if err := findCol(c, true); err != nil {
+			return snap, err
+		}
+	}
+	if len(def.thresholdCol) > 0 {
+		findCol(def.thresholdCol, false) // only needed for excess deaths
+	}
+	get := func(vals []string, c column) string { return vals[cols[c.String()]] }
+	matches := func(vals []string, filters []filter) bool {
+		for _, f := range filters {
+			if get(vals, f.col) != f.val {
+				return false
+			}
 		}
+		return true
 	}
 
-	// Week-ending dates for which we saw excluding-COVID numbers.
-	gotExclCovid := make(map[string]struct{})
+	// Week-ending dates for which we saw values to subtract (e.g. excluding-COVID numbers),
+	// keyed by dataSets that received rows from this file.
+	gotSub := make(map[*dataSet]map[string]struct{})
 
 	for {
 		vals, err := r.Read()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return snap, err
 		}
-
-		if vals[stateCol] != ds.state {
+		if len(vals) != len(header) {
+			snap.warnf("skipped row(s) with %d field(s) instead of %d", len(vals), len(header))
 			continue
 		}
 
-		if (ds.predicted && vals[typeCol] != "Predicted (weighted)") ||
-			(!ds.predicted && vals[typeCol] != "Unweighted") {
+		ds := getSet(get(vals, def.stateCol))
+		if ds == nil {
 			continue
 		}
+		if _, ok := gotSub[ds]; !ok {
+			ds.fileDates[fileDate] = struct{}{}
+			gotSub[ds] = make(map[string]struct{})
+		}
 
-		// The CDC started with dates formatted as MM/DD/YYYY but later changed to YYYY-MM-DD.
-		s := vals[weekEndCol]
-		weekEnd, err := time.Parse("2006-01-02", s)
-		if err != nil {
-			if weekEnd, err = time.Parse("01/02/2006", s); err != nil {
-				return fmt.Errorf("failed to parse week-ending date %q: %v", s, err)
+		if len(def.typeCol) > 0 {
+			if t := get(vals, def.typeCol); (ds.predicted && t != "Predicted (weighted)") ||
+				(!ds.predicted && t != "Unweighted") {
+				continue
 			}
 		}
-		if weekEnd.Before(ds.start) || weekEnd.After(ds.end) {
+
+		add := matches(vals, m.filters)
+		sub := len(m.subFilters) > 0 && matches(vals, m.subFilters)
+		if !add && !sub {
 			continue
 		}
 
-		s = vals[observedCol]
-		if s == "" {
+		s := get(vals, def.weekEndCol)
+		var weekEnd time.Time
+		for i, layout := range dateLayouts {
+			if weekEnd, err = time.Parse(layout, s); err == nil {
+				if i > 0 && schemaLayout != "" {
+					snap.warnf("week-ending dates use %q instead of %q", layout, schemaLayout)
+				}
+				break
+			}
+		}
+		if err != nil {
+			return snap, fmt.Errorf("failed to parse week-ending date %q", s)
+		}
+		if weekEnd.Before(ds.start) || weekEnd.After(ds.end) {
 			continue
 		}
-		observed, err := strconv.Atoi(s)
+
+		observed, ok, err := sumValues(vals, cols, m.valueCols)
 		if err != nil {
-			return fmt.Errorf("failed to parse observed value %q: %v", s, err)
+			return snap, err
+		} else if !ok {
+			continue
 		}
 
 		if ds.excess {
-			s = vals[thresholdCol]
-			if s == "" {
-				continue
+			if _, ok := cols[def.thresholdCol.String()]; !ok {
+				return snap, fmt.Errorf("missing column %q", strings.Join(def.thresholdCol, ","))
 			}
-			threshold, err := strconv.Atoi(s)
+			threshold, ok, err := sumValues(vals, cols, []column{def.thresholdCol})
 			if err != nil {
-				return fmt.Errorf("failed to parse threshold value %q: %v", s, err)
+				return snap, err
+			} else if !ok {
+				continue
 			}
 			observed -= threshold
 		}
@@ -349,25 +492,46 @@ func (ds *dataSet) readFile(p string) error {
 			ds.weekSeries[ws] = ts
 		}
 
-		if o := vals[outcomeCol]; o == "All causes" {
+		if add {
 			ts[fileDate] += observed
-		} else if ds.covid && o == "All causes, excluding COVID-19" {
+		} else if sub {
 			ts[fileDate] -= observed
-			gotExclCovid[ws] = struct{}{}
+			gotSub[ds][ws] = struct{}{}
 		}
 	}
 
 	// For recent weeks, actual (as opposed to estimated) excluding-COVID numbers aren't reported.
 	// Clear these data points to avoid incorrectly reporting all-cause deaths here.
-	if ds.covid {
-		for we, ts := range ds.weekSeries {
-			if _, ok := gotExclCovid[we]; !ok {
-				delete(ts, fileDate)
+	if len(m.subFilters) > 0 {
+		for ds, weeks := range gotSub {
+			for we, ts := range ds.weekSeries {
+				if _, ok := weeks[we]; !ok {
+					delete(ts, fileDate)
+				}
 			}
 		}
 	}
 
-	return nil
+	return snap, nil
+}
+
+// sumValues sums the integer values in vals from the supplied columns.
+// cols maps from column.String() to positions within vals.
+// false is returned if any of the values are empty (e.g. due to suppression of small counts).
+func sumValues(vals []string, cols map[string]int, sumCols []column) (int, bool, error) {
+	var sum int
+	for _, c := range sumCols {
+		s := strings.Replace(vals[cols[c.String()]], ",", "", -1) // "1,234" with format=true
+		if s == "" {
+			return 0, false, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to parse %q value %q: %v", c.String(), s, err)
+		}
+		sum += v
+	}
+	return sum, true, nil
 }
 
 // write writes ds's data to w in gnuplot's format, i.e. lines with tab-separated values.
@@ -0,0 +1,169 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// writeTestFile writes data to a file with the supplied base name in dir and returns its path.
+func writeTestFile(t *testing.T, dir, base, data string) string {
+	p := filepath.Join(dir, base)
+	if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal("Failed writing test file: ", err)
+	}
+	return p
+}
+
+// readTestFiles creates a dataSet and reads the supplied files (keyed by base name) into it.
+func readTestFiles(t *testing.T, dataset, metric string, excess bool, files map[string]string) *dataSet {
+	dir, err := ioutil.TempDir("", "mortality_test.")
+	if err != nil {
+		t.Fatal("Failed creating temp dir: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	def := datasets[dataset]
+	m, err := def.getMetric(metric)
+	if err != nil {
+		t.Fatal("Failed getting metric: ", err)
+	}
+	ds := newDataSet(def, m, "United States",
+		time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), false, excess)
+	for base, data := range files {
+		if _, err := ds.readFile(writeTestFile(t, dir, base, data), ""); err != nil {
+			t.Fatalf("Failed reading %v: %v", base, err)
+		}
+	}
+	return ds
+}
+
+func TestDataSet_ReadFile_Excess(t *testing.T) {
+	files := map[string]string{
+		"20200701.csv": "\ufeffWeek Ending Date,State,Observed Number,Upper Bound Threshold,Type,Outcome\n" +
+			"06/20/2020,United States,100,80,Unweighted,All causes\n" +
+			"06/20/2020,United States,90,70,Unweighted,\"All causes, excluding COVID-19\"\n" +
+			"06/27/2020,United States,50,80,Unweighted,All causes\n" +
+			"06/27/2020,United States,55,80,Predicted (weighted),All causes\n" +
+			"06/27/2020,California,10,8,Unweighted,All causes\n",
+		"20200708.csv": "Week Ending Date,State,Observed Number,Threshold,Type,Outcome\n" +
+			"2020-06-20,United States,110,80,Unweighted,All causes\n" +
+			"2020-06-20,United States,95,70,Unweighted,\"All causes, excluding COVID-19\"\n" +
+			"2020-06-27,United States,\"1,100\",80,Unweighted,All causes\n" +
+			"2020-06-27,United States,\"1,000\",70,Unweighted,\"All causes, excluding COVID-19\"\n",
+	}
+
+	for _, tc := range []struct {
+		metric string
+		excess bool
+		want   map[string]timeseries
+	}{
+		{"all", false, map[string]timeseries{
+			"20200620": {"20200701": 100, "20200708": 110},
+			"20200627": {"20200701": 50, "20200708": 1100},
+		}},
+		{"all", true, map[string]timeseries{
+			"20200620": {"20200701": 20, "20200708": 30},
+			"20200627": {"20200701": -30, "20200708": 1020},
+		}},
+		{"covid", false, map[string]timeseries{
+			"20200620": {"20200701": 10, "20200708": 15},
+			"20200627": {"20200708": 100}, // excluding-COVID value missing from first file
+		}},
+	} {
+		ds := readTestFiles(t, "excess", tc.metric, tc.excess, files)
+		if diff := cmp.Diff(tc.want, ds.weekSeries); diff != "" {
+			t.Errorf("metric %q with excess=%v produced bad data:\n%s", tc.metric, tc.excess, diff)
+		}
+	}
+}
+
+func TestDataSet_ReadFile_Cause(t *testing.T) {
+	files := map[string]string{
+		"20200901.csv": "Jurisdiction of Occurrence,MMWR Year,MMWR Week,Week Ending Date,All Cause," +
+			"\"Influenza and pneumonia (J09-J18)\",\"Chronic lower respiratory diseases (J40-J47)\"," +
+			"\"Other diseases of respiratory system (J00-J06,J30-J39,J67,J70-J98)\"\n" +
+			"United States,2020,34,2020-08-22,1000,20,30,5\n" +
+			"United States,2020,35,2020-08-29,900,10,,5\n", // suppressed value
+	}
+	ds := readTestFiles(t, "cause", "respiratory", false, files)
+	want := map[string]timeseries{"20200822": {"20200901": 55}}
+	if diff := cmp.Diff(want, ds.weekSeries); diff != "" {
+		t.Error("Bad data:\n" + diff)
+	}
+}
+
+func TestDataSet_ReadFile_Jurisdiction(t *testing.T) {
+	files := map[string]string{
+		"20200601.csv": "Data as of,Start week,End Week,State,COVID-19 Deaths,Total Deaths," +
+			"Percent of Expected Deaths,Pneumonia Deaths,Pneumonia and COVID-19 Deaths,Influenza Deaths," +
+			"\"Pneumonia, Influenza, or COVID-19 Deaths\",Footnote\n" +
+			"06/01/2020,05/17/2020,05/23/2020,United States,10,100,1.0,5,2,1,14,\n",
+		"20200901.csv": "Data as of,Start Date,End Date,State,COVID-19 Deaths,Total Deaths," +
+			"Percent of Expected Deaths,Pneumonia Deaths,Pneumonia and COVID-19 Deaths,Influenza Deaths," +
+			"\"Pneumonia, Influenza, or COVID-19 Deaths\",Footnote\n" +
+			"09/01/2020,05/17/2020,05/23/2020,United States,20,200,1.0,5,2,1,24,\n" +
+			"09/01/2020,08/16/2020,08/22/2020,United States,30,300,1.0,5,2,1,34,\n",
+	}
+	ds := readTestFiles(t, "jurisdiction", "covid", false, files)
+	want := map[string]timeseries{
+		"20200523": {"20200601": 10, "20200901": 20},
+		"20200822": {"20200901": 30},
+	}
+	if diff := cmp.Diff(want, ds.weekSeries); diff != "" {
+		t.Error("Bad data:\n" + diff)
+	}
+}
+
+func TestGetFileDate(t *testing.T) {
+	today := time.Now().Format(dateLayout)
+	for _, tc := range []struct {
+		p, defDate string
+		want       string // empty if an error is expected
+	}{
+		{"data/20200901.csv", "", "20200901"},
+		{"data/20200901.csv.gz", "20200815", "20200901"},
+		{"http://example.org/rows.csv?accessType=DOWNLOAD", "20200815", "20200815"},
+		{"http://example.org/rows.csv?accessType=DOWNLOAD", "", ""},
+		{"-", "20200815", "20200815"},
+		{"-", "", today},
+	} {
+		got, err := getFileDate(tc.p, tc.defDate)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("getFileDate(%q, %q) unexpectedly succeeded", tc.p, tc.defDate)
+			}
+		} else if err != nil {
+			t.Errorf("getFileDate(%q, %q) failed: %v", tc.p, tc.defDate, err)
+		} else if got != tc.want {
+			t.Errorf("getFileDate(%q, %q) = %q; want %q", tc.p, tc.defDate, got, tc.want)
+		}
+	}
+}
+
+func TestDataSet_Completeness(t *testing.T) {
+	ds := newDataSet(datasets["excess"], nil, "United States", time.Time{}, time.Time{}, false, false)
+	ds.fileDates = map[string]struct{}{"20200702": {}, "20200705": {}, "20200708": {}}
+	ds.weekSeries = map[string]timeseries{
+		"20200627": {"20200702": 50, "20200705": 100, "20200708": 80},
+		"20200704": {"20200705": 0, "20200708": 0}, // no deaths reported yet
+	}
+	got := ds.completeness(12)
+	nan := math.NaN()
+	want := [][]float64{
+		{nan, nan, nan, nan, nan, 0.5, 0.5, 0.5, 1, 1, 1, 0.8, nan},
+		{nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateNaNs()); diff != "" {
+		t.Error("completeness(12) returned bad data:\n" + diff)
+	}
+}
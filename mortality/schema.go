@@ -0,0 +1,140 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// schema describes one historical layout of a dataset's CSV file.
+type schema struct {
+	version    string   // reported for each snapshot, e.g. "2020-04"
+	header     []string // complete header row, used as a fingerprint
+	dateLayout string   // layout of week-ending dates, e.g. "2006-01-02"
+}
+
+// unknownVersion is reported for snapshots that don't match any of a dataset's schemas.
+const unknownVersion = "unknown"
+
+// snapshot describes a CSV file that was read.
+type snapshot struct {
+	path     string   // path to CSV file
+	fileDate string   // download date, e.g. "20200425"
+	version  string   // schema.version or unknownVersion
+	warnings []string // non-fatal problems encountered while reading the file
+}
+
+// warnf adds a warning to s. Duplicate warnings are ignored.
+func (s *snapshot) warnf(format string, args ...interface{}) {
+	w := fmt.Sprintf(format, args...)
+	for _, o := range s.warnings {
+		if o == w {
+			return
+		}
+	}
+	s.warnings = append(s.warnings, w)
+}
+
+// detectSchema returns the schema from def whose header most closely matches the supplied
+// header row and adds warnings to snap about columns that differ from the schema's.
+// nil is returned if no schema shares at least half of its columns with header.
+func (def *datasetDef) detectSchema(header []string, snap *snapshot) *schema {
+	got := make(map[string]struct{}, len(header))
+	for _, s := range header {
+		got[trimHeader(s)] = struct{}{}
+	}
+
+	var best *schema
+	var bestShared, bestScore int
+	for i := range def.schemas {
+		sch := &def.schemas[i]
+		shared := 0
+		for _, s := range sch.header {
+			if _, ok := got[s]; ok {
+				shared++
+			}
+		}
+		// Penalize columns that are missing from either header.
+		score := 2*shared - len(sch.header) - len(got)
+		if best == nil || score > bestScore {
+			best, bestShared, bestScore = sch, shared, score
+		}
+	}
+	if best == nil || 2*bestShared < len(best.header) {
+		snap.version = unknownVersion
+		snap.warnf("header doesn't match any known schema")
+		return nil
+	}
+
+	snap.version = best.version
+	want := make(map[string]struct{}, len(best.header))
+	for _, s := range best.header {
+		want[s] = struct{}{}
+		if _, ok := got[s]; !ok {
+			snap.warnf("missing column %q from schema %v", s, best.version)
+		}
+	}
+	for _, s := range header {
+		if _, ok := want[trimHeader(s)]; !ok {
+			snap.warnf("unknown column %q not in schema %v", trimHeader(s), best.version)
+		}
+	}
+	return best
+}
+
+// dateLayouts returns the distinct layouts that may be used by week-ending dates in def's
+// CSV files, starting with first (if non-empty).
+func (def *datasetDef) dateLayouts(first string) []string {
+	var layouts []string
+	seen := make(map[string]struct{})
+	add := func(l string) {
+		if _, ok := seen[l]; !ok && l != "" {
+			seen[l] = struct{}{}
+			layouts = append(layouts, l)
+		}
+	}
+	add(first)
+	for _, sch := range def.schemas {
+		add(sch.dateLayout)
+	}
+	// The CDC started with dates formatted as MM/DD/YYYY but later changed to YYYY-MM-DD.
+	add("2006-01-02")
+	add("01/02/2006")
+	return layouts
+}
+
+// find returns the position of c within the supplied header row, or -1 if it isn't present.
+// If none of c's names are present, columns with similar names (ignoring case, whitespace,
+// and punctuation) are considered and the matching name is returned via renamed.
+func (c column) find(header []string) (idx int, renamed string) {
+	if i := c.index(header); i >= 0 {
+		return i, ""
+	}
+	for i, s := range header {
+		norm := normalizeHeader(s)
+		for _, name := range c {
+			if norm == normalizeHeader(name) {
+				return i, trimHeader(s)
+			}
+		}
+	}
+	return -1, ""
+}
+
+// trimHeader trims whitespace and byte order marks from a column name.
+func trimHeader(s string) string {
+	return strings.TrimSpace(strings.TrimLeft(s, "\ufeff")) // sigh
+}
+
+// normalizeHeader lowercases s and removes everything but letters and digits.
+func normalizeHeader(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
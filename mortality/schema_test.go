@@ -0,0 +1,59 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDatasetDef_DetectSchema(t *testing.T) {
+	def := datasets["excess"]
+	v1 := def.schemas[0].header
+	v2 := def.schemas[1].header
+
+	for _, tc := range []struct {
+		header   []string
+		version  string
+		warnings []string
+	}{
+		{append([]string{"\ufeff" + v1[0]}, v1[1:]...), "2020-04", nil},
+		{v2, "2020-07", nil},
+		{append(append([]string{}, v2...), "New Column"), "2020-07",
+			[]string{`unknown column "New Column" not in schema 2020-07`}},
+		{v2[1:], "2020-07", []string{`missing column "Week Ending Date" from schema 2020-07`}},
+		{[]string{"Foo", "Bar", "State"}, unknownVersion, []string{"header doesn't match any known schema"}},
+	} {
+		snap := &snapshot{}
+		def.detectSchema(tc.header, snap)
+		name := strings.Join(tc.header, ",")
+		if snap.version != tc.version {
+			t.Errorf("detectSchema(%q) chose %q; want %q", name, snap.version, tc.version)
+		}
+		if diff := cmp.Diff(tc.warnings, snap.warnings); diff != "" {
+			t.Errorf("detectSchema(%q) produced bad warnings:\n%s", name, diff)
+		}
+	}
+}
+
+func TestColumn_Find(t *testing.T) {
+	header := []string{"\ufeffWeek Ending Date", "state", "Observed  Number", "Threshold"}
+	for _, tc := range []struct {
+		col     column
+		idx     int
+		renamed string
+	}{
+		{column{"Week Ending Date"}, 0, ""},
+		{column{"State"}, 1, "state"},
+		{column{"Observed Number"}, 2, "Observed  Number"},
+		{column{"Upper Bound Threshold", "Threshold"}, 3, ""},
+		{column{"Outcome"}, -1, ""},
+	} {
+		if idx, renamed := tc.col.find(header); idx != tc.idx || renamed != tc.renamed {
+			t.Errorf("find(%q) = %v, %q; want %v, %q", tc.col, idx, renamed, tc.idx, tc.renamed)
+		}
+	}
+}
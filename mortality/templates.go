@@ -0,0 +1,202 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+// output describes where and how plots are written.
+type output struct {
+	path  string         // image file, or empty to display plots in an interactive window
+	term  string         // gnuplot terminal, e.g. "pngcairo"; derived from path's extension if empty
+	size  string         // terminal size, e.g. "1280,960"; theme's size for path's format if empty
+	theme *gnuplot.Theme // fonts and colors; gnuplot.DefaultTheme if nil
+	keep  bool           // keep gnuplot scripts alongside path for debugging
+}
+
+// forState returns a copy of o that writes to a file specific to the supplied state.
+// The state's name is inserted before the extension, e.g. "out/plot.png" becomes
+// "out/plot-new-york.png".
+func (o output) forState(state string) output {
+	if o.path == "" {
+		return o
+	}
+	ext := filepath.Ext(o.path)
+	slug := strings.ToLower(strings.Join(strings.Fields(state), "-"))
+	o.path = strings.TrimSuffix(o.path, ext) + "-" + slug + ext
+	return o
+}
+
+// keeping returns true if gnuplot scripts should be kept alongside o.path.
+// Scripts aren't kept for interactive plots.
+func (o output) keeping() bool {
+	return o.keep && o.path != ""
+}
+
+// scriptOptions returns options for running gnuplot to plot data to o.
+func (o output) scriptOptions(data []byte) *gnuplot.Options {
+	opts := gnuplot.KeepOptions(o.path, o.keeping())
+	opts.Data = data
+	return opts
+}
+
+// getTheme returns o.theme or the default theme if it's unset.
+func (o output) getTheme() *gnuplot.Theme {
+	if o.theme != nil {
+		return o.theme
+	}
+	t, err := gnuplot.LookupTheme(gnuplot.DefaultTheme)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// setTerm returns a 'set term' command for o.
+func (o output) setTerm() (string, error) {
+	theme := o.getTheme()
+	term, size := o.term, o.size
+	if format, ok := gnuplot.FormatForPath(o.path); ok {
+		if term == "" {
+			term = format.Term()
+		}
+		if size == "" && term == format.Term() {
+			size = theme.Size(format)
+		}
+	}
+	if term == "" {
+		return "", fmt.Errorf("can't determine terminal for %q", o.path)
+	}
+	return "set term " + theme.Term(term, size), nil
+}
+
+// lineTypes returns 'set linetype' commands defining 16 line types using theme's colors.
+// The first 8 are solid and the last 8 are dashed.
+func lineTypes(theme *gnuplot.Theme) string {
+	const n = 8
+	var cmds []string
+	for i := 0; i < 2*n; i++ {
+		cmds = append(cmds, fmt.Sprintf("set linetype %d lc rgb %s lw 1 dt %d",
+			i+1, gnuplot.Quote(theme.Color(i%n)), 1+2*(i/n)))
+	}
+	cmds = append(cmds, fmt.Sprintf("set linetype cycle %d", 2*n))
+	return strings.Join(cmds, "\n")
+}
+
+// templateData returns data for executing one of this file's templates to plot data from
+// the gnuplot.DataBlock data block using out. Extra variables needed by the template should
+// be supplied via vars.
+func templateData(out output, vars map[string]interface{}) (interface{}, error) {
+	theme := out.getTheme()
+	data := struct {
+		Data        string // name of gnuplot data block
+		SetTerm     string // 'set term' command for writing image data; empty if interactive
+		SetOutput   string // 'set output' command for writing to image file; empty if interactive
+		FooterLabel string // 'set label' command for writing footer label; empty if interactive
+		Pause       string // 'pause' command for keeping interactive window open; empty if not interactive
+
+		LineTypes  string // 'set linetype' commands using the theme's colors
+		SetPalette string // 'set palette' command using the theme's diverging scale
+		ThemeCmds  string // commands coloring text and borders; must follow titles and labels
+
+		Vars map[string]interface{} // extra variables
+	}{
+		Data:       gnuplot.DataBlock,
+		LineTypes:  lineTypes(theme),
+		SetPalette: gnuplot.SetPalette(theme.Diverging),
+		ThemeCmds:  strings.Join(theme.Commands(), "\n"),
+		Vars:       vars,
+	}
+
+	if out.path == "" {
+		data.Pause = "pause mouse close"
+		return data, nil
+	}
+
+	var err error
+	if data.SetTerm, err = out.setTerm(); err != nil {
+		return nil, err
+	}
+	data.SetOutput = "set output " + gnuplot.Quote(out.path)
+	data.FooterLabel = gnuplot.FooterLabel(fmt.Sprintf("Generated on %s by https://github.com/derat/covid",
+		time.Now().Format("2006-01-02")), theme)
+	return data, nil
+}
+
+const (
+	linesTmpl = `
+{{.SetTerm}}
+{{.SetOutput}}
+
+set title "{{.Vars.Title}}\n\n" . \
+  "{/*0.8 Source: {{.Vars.URL}}\n}" . \
+  "{/*0.8 Shows changes to CDC data over time.}"
+
+set xlabel 'Data Update Date'
+set xdata time
+set timefmt '%Y%m%d'
+
+set ylabel 'Deaths'
+set yrange [*<0:*]
+set grid xtics ytics
+set bmargin 5
+{{.FooterLabel}}
+
+set key autotitle columnheader outside top right title 'Week Ending'
+
+{{.LineTypes}}
+{{.ThemeCmds}}
+
+num_lines = {{.Vars.NumLines}}
+plot for [i=2:num_lines+2] {{.Data}} using 1:i with lines
+
+{{.Pause}}
+`
+
+	heatmapTmpl = `
+{{.SetTerm}}
+{{.SetOutput}}
+
+{{- if eq (len .Vars.States) 1}}
+set title "{{.Vars.Title}}\n\n" . \
+  "{/*0.8 Source: {{.Vars.URL}}\n}" . \
+  "{/*0.8 Shows fraction of each week's eventual count reported after each day.}"
+{{- end}}
+
+set xlabel 'Week Ending'
+set ylabel 'Days Since Week Ended'
+set xtics scale 0 rotate by 90 right
+set ytics scale 0
+set yrange [-0.5:{{.Vars.MaxLag}}.5]
+set cbrange [0:1]
+set cblabel 'Fraction Reported'
+{{.SetPalette}}
+set bmargin 5
+{{.FooterLabel}}
+{{.ThemeCmds}}
+
+{{if gt (len .Vars.States) 1 -}}
+set multiplot layout {{.Vars.Rows}},{{.Vars.Cols}} title "{{.Vars.Title}}"
+unset xlabel
+unset ylabel
+unset cblabel
+unset bmargin
+set tics font ',12'
+{{end -}}
+{{range $i, $state := .Vars.States -}}
+{{if gt (len $.Vars.States) 1}}set title '{{$state}}' font ',14'
+{{end -}}
+plot {{$.Data}} index {{$i}} using 1:3:4:xtic(int($1)%4==0 ? strcol(2) : '') with image notitle
+{{end -}}
+{{if gt (len .Vars.States) 1}}unset multiplot{{end}}
+
+{{.Pause}}
+`
+)
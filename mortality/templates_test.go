@@ -0,0 +1,65 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/derat/covid/gnuplot"
+)
+
+func TestOutput_ForState(t *testing.T) {
+	for _, tc := range []struct{ path, state, want string }{
+		{"out/plot.png", "New York", "out/plot-new-york.png"},
+		{"plot.svg", "California", "plot-california.svg"},
+		{"", "Texas", ""},
+	} {
+		if got := (output{path: tc.path}).forState(tc.state).path; got != tc.want {
+			t.Errorf("forState(%q) with path %q = %q; want %q", tc.state, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestOutput_SetTerm(t *testing.T) {
+	dark, err := gnuplot.LookupTheme("dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		out  output
+		want string // empty if error expected
+	}{
+		{output{path: "a.png"}, "set term pngcairo font 'Roboto,22' linewidth 2 size 1280,960"},
+		{output{path: "a.PDF"}, "set term pdfcairo font 'Roboto,22' linewidth 2 size 10in,7.5in"},
+		{output{path: "a.svg", size: "800,600"}, "set term svg font 'Roboto,22' linewidth 2 size 800,600"},
+		{output{path: "a.png", term: "png"}, "set term png font 'Roboto,22' linewidth 2"},
+		{output{path: "a.html"}, "set term canvas font 'Roboto,22' linewidth 2 size 1280,960"},
+		{output{path: "a.png", theme: dark},
+			"set term pngcairo font 'Roboto,22' linewidth 2 size 1280,960 background '#202124'"},
+		{output{path: "a.gif"}, ""},
+	} {
+		got, err := tc.out.setTerm()
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("setTerm() for %+v unexpectedly succeeded", tc.out)
+			}
+		} else if err != nil {
+			t.Errorf("setTerm() for %+v failed: %v", tc.out, err)
+		} else if got != tc.want {
+			t.Errorf("setTerm() for %+v = %q; want %q", tc.out, got, tc.want)
+		}
+	}
+}
+
+func TestTemplateData_SetOutput(t *testing.T) {
+	data, err := templateData(output{path: "out/it's.png"}, nil)
+	if err != nil {
+		t.Fatal("templateData failed: ", err)
+	}
+	got := reflect.ValueOf(data).FieldByName("SetOutput").String()
+	if want := `set output 'out/it''s.png'`; got != want {
+		t.Errorf("templateData set SetOutput to %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package obs
+
+import "strings"
+
+// Record.Geo values used for areas that aren't states.
+const (
+	US  = "US"  // United States
+	NYC = "NYC" // New York City, which the CDC reports separately from New York State
+)
+
+// stateAbbrevs maps lowercase state and territory names to postal abbreviations.
+var stateAbbrevs = map[string]string{
+	"alabama":                  "AL",
+	"alaska":                   "AK",
+	"american samoa":           "AS",
+	"arizona":                  "AZ",
+	"arkansas":                 "AR",
+	"california":               "CA",
+	"colorado":                 "CO",
+	"connecticut":              "CT",
+	"delaware":                 "DE",
+	"district of columbia":     "DC",
+	"florida":                  "FL",
+	"georgia":                  "GA",
+	"guam":                     "GU",
+	"hawaii":                   "HI",
+	"idaho":                    "ID",
+	"illinois":                 "IL",
+	"indiana":                  "IN",
+	"iowa":                     "IA",
+	"kansas":                   "KS",
+	"kentucky":                 "KY",
+	"louisiana":                "LA",
+	"maine":                    "ME",
+	"maryland":                 "MD",
+	"massachusetts":            "MA",
+	"michigan":                 "MI",
+	"minnesota":                "MN",
+	"mississippi":              "MS",
+	"missouri":                 "MO",
+	"montana":                  "MT",
+	"nebraska":                 "NE",
+	"nevada":                   "NV",
+	"new hampshire":            "NH",
+	"new jersey":               "NJ",
+	"new mexico":               "NM",
+	"new york":                 "NY",
+	"new york city":            NYC,
+	"north carolina":           "NC",
+	"north dakota":             "ND",
+	"northern mariana islands": "MP",
+	"ohio":                     "OH",
+	"oklahoma":                 "OK",
+	"oregon":                   "OR",
+	"pennsylvania":             "PA",
+	"puerto rico":              "PR",
+	"rhode island":             "RI",
+	"south carolina":           "SC",
+	"south dakota":             "SD",
+	"tennessee":                "TN",
+	"texas":                    "TX",
+	"united states":            US,
+	"utah":                     "UT",
+	"vermont":                  "VT",
+	"virgin islands":           "VI",
+	"virginia":                 "VA",
+	"washington":               "WA",
+	"west virginia":            "WV",
+	"wisconsin":                "WI",
+	"wyoming":                  "WY",
+}
+
+// StateGeo returns the Record.Geo value for the supplied state or territory name,
+// e.g. "PR" for "Puerto Rico" or US for "United States". Case is ignored.
+// False is returned if the name is unknown.
+func StateGeo(name string) (string, bool) {
+	geo, ok := stateAbbrevs[strings.ToLower(strings.TrimSpace(name))]
+	return geo, ok
+}
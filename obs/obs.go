@@ -0,0 +1,291 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+// Package obs defines a common representation for observations read from different
+// data sources so they can be joined, compared, and exported.
+package obs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of data sources.
+const (
+	Bioportal = "bioportal" // Puerto Rico Department of Health Bioportal
+	CDC       = "cdc"       // CDC mortality datasets
+	USAFacts  = "usafacts"  // USAFacts county-level data
+	Tracking  = "tracking"  // COVID Tracking Project
+)
+
+// Period describes the span of time covered by a record.
+type Period int
+
+const (
+	Daily  Period = iota // a single day
+	Weekly               // seven days ending on the record's date
+)
+
+func (p Period) String() string {
+	switch p {
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	default:
+		return strconv.Itoa(int(p))
+	}
+}
+
+// parsePeriod parses a string returned by Period.String.
+func parsePeriod(s string) (Period, error) {
+	switch s {
+	case "daily":
+		return Daily, nil
+	case "weekly":
+		return Weekly, nil
+	default:
+		return -1, fmt.Errorf("bad period %q", s)
+	}
+}
+
+// Metric describes what a record's value measures.
+// Sources may also use their own metrics, e.g. "cause:respiratory".
+type Metric string
+
+const (
+	Tests        Metric = "tests"        // new test results
+	Positives    Metric = "positives"    // new positive test results
+	Positivity   Metric = "positivity"   // fraction of test results that were positive
+	Cases        Metric = "cases"        // new confirmed cases
+	Deaths       Metric = "deaths"       // new COVID-19 deaths
+	AllDeaths    Metric = "all-deaths"   // new deaths from all causes
+	Hospitalized Metric = "hospitalized" // current COVID-19 hospitalizations
+	ICU          Metric = "icu"          // current COVID-19 ICU patients
+)
+
+// Additive returns true if m's values for consecutive periods can be summed,
+// i.e. they're counts of new events rather than ratios or current levels.
+func (m Metric) Additive() bool {
+	switch m {
+	case Positivity, Hospitalized, ICU:
+		return false
+	default:
+		return true
+	}
+}
+
+// Record is a single observation.
+type Record struct {
+	Date     time.Time // day, or last day of week for Weekly (midnight UTC)
+	Period   Period
+	Geo      string // "US", state abbreviation (e.g. "PR"), or 5-digit county FIPS code (e.g. "01001")
+	Metric   Metric
+	Value    float64
+	Source   string    // e.g. Bioportal
+	Snapshot time.Time // date on which the data was published (midnight UTC); zero if unknown
+}
+
+// Day returns midnight UTC on t's date in its own location.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// CountyGeo returns the Record.Geo value for the county with the supplied FIPS code.
+func CountyGeo(fips int) string {
+	return fmt.Sprintf("%05d", fips)
+}
+
+// dateLayout is used to format dates in CSV files.
+const dateLayout = "2006-01-02"
+
+// csvHeader contains the columns written by WriteCSV.
+var csvHeader = []string{"date", "period", "geo", "metric", "value", "source", "snapshot"}
+
+// WriteCSV writes recs to w as CSV:
+//
+//  date,period,geo,metric,value,source,snapshot
+//  2020-09-20,daily,PR,tests,4021,bioportal,2020-09-25
+func WriteCSV(w io.Writer, recs []Record) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, r := range recs {
+		var snap string
+		if !r.Snapshot.IsZero() {
+			snap = r.Snapshot.Format(dateLayout)
+		}
+		cw.Write([]string{r.Date.Format(dateLayout), r.Period.String(), r.Geo, string(r.Metric),
+			strconv.FormatFloat(r.Value, 'f', -1, 64), r.Source, snap})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads records written by WriteCSV.
+func ReadCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading header: %v", err)
+	}
+	if got := strings.Join(header, ","); got != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("bad header %q", got)
+	}
+
+	var recs []Record
+	for line := 2; ; line++ {
+		vals, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		rec := Record{Geo: vals[2], Metric: Metric(vals[3]), Source: vals[5]}
+		if rec.Date, err = time.Parse(dateLayout, vals[0]); err != nil {
+			return nil, fmt.Errorf("line %d: bad date %q", line, vals[0])
+		}
+		if rec.Period, err = parsePeriod(vals[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if rec.Value, err = strconv.ParseFloat(vals[4], 64); err != nil {
+			return nil, fmt.Errorf("line %d: bad value %q", line, vals[4])
+		}
+		if vals[6] != "" {
+			if rec.Snapshot, err = time.Parse(dateLayout, vals[6]); err != nil {
+				return nil, fmt.Errorf("line %d: bad snapshot %q", line, vals[6])
+			}
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// key identifies a series of snapshots of a single value.
+type key struct {
+	date   time.Time
+	period Period
+	geo    string
+	metric Metric
+	source string
+}
+
+func (r *Record) key() key { return key{r.Date, r.Period, r.Geo, r.Metric, r.Source} }
+
+// Sort sorts recs by date, period, geography, metric, source, and snapshot.
+func Sort(recs []Record) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		a, b := &recs[i], &recs[j]
+		switch {
+		case !a.Date.Equal(b.Date):
+			return a.Date.Before(b.Date)
+		case a.Period != b.Period:
+			return a.Period < b.Period
+		case a.Geo != b.Geo:
+			return a.Geo < b.Geo
+		case a.Metric != b.Metric:
+			return a.Metric < b.Metric
+		case a.Source != b.Source:
+			return a.Source < b.Source
+		default:
+			return a.Snapshot.Before(b.Snapshot)
+		}
+	})
+}
+
+// Latest returns the records from recs with the most recent snapshots
+// for each date, period, geography, metric, and source.
+func Latest(recs []Record) []Record {
+	latest := make(map[key]int) // indexes into recs
+	for i := range recs {
+		k := recs[i].key()
+		if j, ok := latest[k]; !ok || recs[i].Snapshot.After(recs[j].Snapshot) {
+			latest[k] = i
+		}
+	}
+	out := make([]Record, 0, len(latest))
+	for _, i := range latest {
+		out = append(out, recs[i])
+	}
+	Sort(out)
+	return out
+}
+
+// ToWeekly returns weekly records summing the latest daily records from recs for weeks ending
+// on end. Only additive metrics and complete weeks are included. Weekly records in recs that
+// end on end are also included.
+func ToWeekly(recs []Record, end time.Weekday) []Record {
+	type sum struct {
+		rec  Record // Date is the week's end
+		days int
+	}
+	sums := make(map[key]*sum)
+	var out []Record
+	for _, r := range Latest(recs) {
+		switch {
+		case r.Period == Weekly && r.Date.Weekday() == end:
+			out = append(out, r)
+		case r.Period == Daily && r.Metric.Additive():
+			wr := r
+			wr.Period = Weekly
+			wr.Date = r.Date.AddDate(0, 0, (int(end)-int(r.Date.Weekday())+7)%7)
+			k := wr.key()
+			s, ok := sums[k]
+			if !ok {
+				wr.Value = 0
+				s = &sum{rec: wr}
+				sums[k] = s
+			}
+			s.rec.Value += r.Value
+			if r.Snapshot.After(s.rec.Snapshot) {
+				s.rec.Snapshot = r.Snapshot
+			}
+			s.days++
+		}
+	}
+	for _, s := range sums {
+		if s.days == 7 {
+			out = append(out, s.rec)
+		}
+	}
+	Sort(out)
+	return out
+}
+
+// Row contains values from different sources for the same date, period, geography, and metric.
+type Row struct {
+	Date   time.Time
+	Period Period
+	Geo    string
+	Metric Metric
+	Values map[string]float64 // keyed by source
+}
+
+// Join groups the latest records from recs into rows, sorted by date, period, geography, and
+// metric. The sorted names of all sources in recs are also returned.
+func Join(recs []Record) (rows []Row, sources []string) {
+	seen := make(map[string]struct{})
+	idx := make(map[key]int) // source is always empty
+	for _, r := range Latest(recs) {
+		k := r.key()
+		k.source = ""
+		i, ok := idx[k]
+		if !ok {
+			i = len(rows)
+			idx[k] = i
+			rows = append(rows, Row{r.Date, r.Period, r.Geo, r.Metric, make(map[string]float64)})
+		}
+		rows[i].Values[r.Source] = r.Value
+		if _, ok := seen[r.Source]; !ok {
+			seen[r.Source] = struct{}{}
+			sources = append(sources, r.Source)
+		}
+	}
+	sort.Strings(sources)
+	return rows, sources
+}
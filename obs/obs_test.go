@@ -0,0 +1,108 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package obs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// day returns midnight UTC on the supplied day in September 2020.
+func day(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, time.UTC) }
+
+func TestWriteReadCSV(t *testing.T) {
+	recs := []Record{
+		{day(20), Daily, "PR", Tests, 4021, Bioportal, day(25)},
+		{day(19), Weekly, "NYC", AllDeaths, 1234.5, CDC, time.Time{}},
+	}
+	var b bytes.Buffer
+	if err := WriteCSV(&b, recs); err != nil {
+		t.Fatal("WriteCSV failed: ", err)
+	}
+	const want = "date,period,geo,metric,value,source,snapshot\n" +
+		"2020-09-20,daily,PR,tests,4021,bioportal,2020-09-25\n" +
+		"2020-09-19,weekly,NYC,all-deaths,1234.5,cdc,\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Error("WriteCSV wrote bad data:\n" + diff)
+	}
+	got, err := ReadCSV(&b)
+	if err != nil {
+		t.Fatal("ReadCSV failed: ", err)
+	}
+	if diff := cmp.Diff(recs, got); diff != "" {
+		t.Error("ReadCSV returned bad records:\n" + diff)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	recs := []Record{
+		{day(5), Weekly, "PR", Deaths, 10, CDC, day(10)},
+		{day(5), Weekly, "PR", Deaths, 12, CDC, day(17)},
+		{day(5), Weekly, "PR", Deaths, 11, CDC, day(12)},
+		{day(5), Weekly, "PR", Deaths, 9, Tracking, day(6)},
+	}
+	want := []Record{recs[1], recs[3]}
+	if diff := cmp.Diff(want, Latest(recs)); diff != "" {
+		t.Error("Latest returned bad records:\n" + diff)
+	}
+}
+
+func TestToWeekly(t *testing.T) {
+	var recs []Record
+	// Saturday, September 5 through Sunday, September 20.
+	for d := 5; d <= 20; d++ {
+		recs = append(recs,
+			Record{day(d), Daily, "PR", Tests, float64(d), Tracking, day(21)},
+			Record{day(d), Daily, "PR", Hospitalized, 100, Tracking, day(21)})
+	}
+	recs = append(recs,
+		Record{day(12), Weekly, "PR", Deaths, 5, CDC, day(20)},
+		Record{day(13), Weekly, "PR", Deaths, 6, CDC, day(20)}) // wrong weekday
+	want := []Record{
+		{day(12), Weekly, "PR", Deaths, 5, CDC, day(20)},
+		{day(12), Weekly, "PR", Tests, 6 + 7 + 8 + 9 + 10 + 11 + 12, Tracking, day(21)},
+		{day(19), Weekly, "PR", Tests, 13 + 14 + 15 + 16 + 17 + 18 + 19, Tracking, day(21)},
+	}
+	if diff := cmp.Diff(want, ToWeekly(recs, time.Saturday)); diff != "" {
+		t.Error("ToWeekly returned bad records:\n" + diff)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	recs := []Record{
+		{day(2), Daily, "PR", Tests, 100, Tracking, day(3)},
+		{day(1), Daily, "PR", Tests, 90, Bioportal, day(4)},
+		{day(2), Daily, "PR", Tests, 110, Bioportal, day(4)},
+		{day(2), Daily, "PR", Positives, 5, Bioportal, day(4)},
+	}
+	rows, sources := Join(recs)
+	wantRows := []Row{
+		{day(1), Daily, "PR", Tests, map[string]float64{Bioportal: 90}},
+		{day(2), Daily, "PR", Positives, map[string]float64{Bioportal: 5}},
+		{day(2), Daily, "PR", Tests, map[string]float64{Bioportal: 110, Tracking: 100}},
+	}
+	if diff := cmp.Diff(wantRows, rows); diff != "" {
+		t.Error("Join returned bad rows:\n" + diff)
+	}
+	if diff := cmp.Diff([]string{Bioportal, Tracking}, sources); diff != "" {
+		t.Error("Join returned bad sources:\n" + diff)
+	}
+}
+
+func TestStateGeo(t *testing.T) {
+	for name, want := range map[string]string{
+		"Puerto Rico":   "PR",
+		"united states": US,
+		"New York City": NYC,
+		" Texas ":       "TX",
+		"Atlantis":      "",
+	} {
+		if got, ok := StateGeo(name); got != want || ok != (want != "") {
+			t.Errorf("StateGeo(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+}
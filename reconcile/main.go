@@ -0,0 +1,197 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/filewriter"
+	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/input"
+	"github.com/derat/covid/obs"
+)
+
+// metricDescs contains descriptions of metrics used in plot titles and labels.
+var metricDescs = map[obs.Metric]string{
+	obs.Tests:     "new COVID-19 tests",
+	obs.Positives: "new positive COVID-19 tests",
+	obs.Deaths:    "new COVID-19 deaths",
+	obs.AllDeaths: "new deaths from all causes",
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] <out-dir> <records.csv> ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	geo := flag.String("geo", "PR", `Geography to compare, e.g. "PR" or "US"`)
+	metricsStr := flag.String("metrics", "tests,positives,deaths", "Comma-separated metrics to compare")
+	threshold := flag.Float64("threshold", 0.25, "Fractional difference between sources above which values are flagged")
+	minValue := flag.Float64("min-value", 10, "Minimum largest value for flagging differences (avoids noise in small counts)")
+	weekEndStr := flag.String("week-end", "sat", "Last day of weeks used for weekly comparisons")
+	themeName := flag.String("theme", gnuplot.DefaultTheme,
+		fmt.Sprintf("Plot theme (%s)", strings.Join(gnuplot.ThemeNames(), ", ")))
+	keepScripts := flag.Bool("keep-scripts", false, "Keep gnuplot scripts next to plots for debugging")
+	startStr := flag.String("start", "", "Earliest date to compare as YYYY-MM-DD (empty for all)")
+	flag.Parse()
+
+	if len(flag.Args()) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	outDir := flag.Arg(0)
+
+	var metrics []obs.Metric
+	for _, s := range strings.Split(*metricsStr, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			metrics = append(metrics, obs.Metric(s))
+		}
+	}
+	if len(metrics) == 0 {
+		log.Fatal("No -metrics supplied")
+	}
+	weekEnd, err := parseWeekday(*weekEndStr)
+	if err != nil {
+		log.Fatal("Bad -week-end: ", err)
+	}
+	theme, err := gnuplot.LookupTheme(*themeName)
+	if err != nil {
+		log.Fatal("Bad -theme: ", err)
+	}
+	var start time.Time
+	if *startStr != "" {
+		if start, err = time.Parse("2006-01-02", *startStr); err != nil {
+			log.Fatalf("Bad -start %q: %v", *startStr, err)
+		}
+	}
+
+	var recs []obs.Record
+	for _, p := range flag.Args()[1:] {
+		f, err := input.Open(p)
+		if err != nil {
+			log.Fatal("Failed opening records: ", err)
+		}
+		rs, err := obs.ReadCSV(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed reading %v: %v", p, err)
+		}
+		recs = append(recs, rs...)
+	}
+	recs = filter(recs, *geo, metrics, start)
+	if len(recs) == 0 {
+		log.Fatalf("No records for %v", *geo)
+	}
+
+	var daily []obs.Record
+	for _, r := range recs {
+		if r.Period == obs.Daily {
+			daily = append(daily, r)
+		}
+	}
+	dailyRows, dailySources := obs.Join(daily)
+	weeklyRows, weeklySources := obs.Join(obs.ToWeekly(recs, weekEnd))
+	dailyComps := compare(dailyRows, *threshold, *minValue)
+	weeklyComps := compare(weeklyRows, *threshold, *minValue)
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatal("Failed creating output dir: ", err)
+	}
+	for _, out := range []struct {
+		fn    string                  // output file, e.g. "daily.csv"
+		write func(w io.Writer) error // writes data
+	}{
+		{"daily.csv", func(w io.Writer) error { return writeComparisonCSV(w, dailyComps, dailySources) }},
+		{"weekly.csv", func(w io.Writer) error { return writeComparisonCSV(w, weeklyComps, weeklySources) }},
+		{"divergences.txt", func(w io.Writer) error {
+			if err := writeDivergences(w, weeklyComps, weeklySources); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+			return writeDivergences(w, dailyComps, dailySources)
+		}},
+	} {
+		fw := filewriter.New(filepath.Join(outDir, out.fn))
+		werr := out.write(fw)
+		if err := fw.Close(); err != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, err)
+		} else if werr != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, werr)
+		}
+	}
+
+	var ndaily, nweekly int
+	for _, c := range dailyComps {
+		if c.flagged {
+			ndaily++
+		}
+	}
+	for _, c := range weeklyComps {
+		if c.flagged {
+			nweekly++
+		}
+	}
+	log.Printf("Flagged %d weekly and %d daily value(s) differing by more than %v%%",
+		nweekly, ndaily, 100*(*threshold))
+
+	now := time.Now()
+	flagTitle := fmt.Sprintf("Sources differ by more than %v%%", 100*(*threshold))
+
+	for _, m := range metrics {
+		desc, ok := metricDescs[m]
+		if !ok {
+			desc = string(m)
+		}
+		for _, plot := range []struct {
+			period  obs.Period
+			comps   []comparison
+			sources []string
+			style   string // gnuplot plot style
+		}{
+			{obs.Daily, dailyComps, dailySources, "lines"},
+			{obs.Weekly, weeklyComps, weeklySources, "linespoints"},
+		} {
+			srcs := plotSources(plot.comps, m, plot.sources)
+			if len(srcs) == 0 {
+				continue
+			}
+			out := fmt.Sprintf("%s_%s.png", m, plot.period)
+			var b bytes.Buffer
+			if err := writePlotData(&b, plot.comps, m, srcs); err != nil {
+				log.Fatalf("Failed writing data for %v: %v", out, err)
+			}
+			xlabel := "Date"
+			if plot.period == obs.Weekly {
+				xlabel = "Week ending"
+			}
+			ip := filepath.Join(outDir, out)
+			td, err := gnuplot.NewTemplateData(ip, theme, now, map[string]interface{}{
+				"Title":     fmt.Sprintf("%s %s by source in %s", strings.Title(plot.period.String()), desc, *geo),
+				"XLabel":    xlabel,
+				"YLabel":    strings.ToUpper(desc[:1]) + desc[1:],
+				"Sources":   srcs,
+				"Style":     plot.style,
+				"FlagTitle": flagTitle,
+			})
+			if err != nil {
+				log.Fatalf("Failed plotting %v: %v", out, err)
+			}
+			opts := gnuplot.KeepOptions(ip, *keepScripts)
+			opts.Data = b.Bytes()
+			if err := gnuplot.ExecTemplateOptions(sourcesTmpl, td, opts); err != nil {
+				log.Fatalf("Failed plotting %v: %v", out, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/derat/covid/obs"
+)
+
+// comparison holds values reported by different sources along with how much they diverge.
+type comparison struct {
+	obs.Row
+	div     float64 // see divergence
+	flagged bool    // div exceeded the threshold
+}
+
+// compare compares the values in each of rows. A row is flagged if at least two sources
+// reported values, the largest value is at least minValue, and the values' divergence
+// exceeds threshold.
+func compare(rows []obs.Row, threshold, minValue float64) []comparison {
+	comps := make([]comparison, len(rows))
+	for i, row := range rows {
+		c := comparison{Row: row, div: divergence(row.Values)}
+		if !math.IsNaN(c.div) && c.div > threshold && maxValue(row.Values) >= minValue {
+			c.flagged = true
+		}
+		comps[i] = c
+	}
+	return comps
+}
+
+// divergence returns the difference between the largest and smallest of vals as a fraction
+// of the largest value. 0 is returned if all values are zero, and NaN is returned if vals
+// contains fewer than two values.
+func divergence(vals map[string]float64) float64 {
+	if len(vals) < 2 {
+		return math.NaN()
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range vals {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	if max == min {
+		return 0
+	}
+	return (max - min) / math.Max(math.Abs(max), math.Abs(min))
+}
+
+// maxValue returns the largest of vals.
+func maxValue(vals map[string]float64) float64 {
+	max := math.Inf(-1)
+	for _, v := range vals {
+		max = math.Max(max, v)
+	}
+	return max
+}
+
+// filter returns the records from recs with the supplied geography and metrics
+// that are on or after start.
+func filter(recs []obs.Record, geo string, metrics []obs.Metric, start time.Time) []obs.Record {
+	var out []obs.Record
+	for _, r := range recs {
+		if r.Geo != geo || r.Date.Before(start) {
+			continue
+		}
+		for _, m := range metrics {
+			if r.Metric == m {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// parseWeekday parses a weekday name like "sat" or "Saturday".
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", s)
+}
+
+// formatValue formats v for output, using an empty string for NaN.
+func formatValue(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeComparisonCSV writes comps to w as CSV:
+//
+//  Date,Period,Metric,bioportal,cdc,tracking,Divergence,Flagged
+//  2020-09-19,weekly,deaths,,52,49,0.0577,false
+//
+// Each source's column is empty if it didn't report a value.
+func writeComparisonCSV(w io.Writer, comps []comparison, sources []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append(append([]string{"Date", "Period", "Metric"}, sources...), "Divergence", "Flagged"))
+	for _, c := range comps {
+		row := []string{c.Date.Format("2006-01-02"), c.Period.String(), string(c.Metric)}
+		for _, src := range sources {
+			if v, ok := c.Values[src]; ok {
+				row = append(row, formatValue(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		div := ""
+		if !math.IsNaN(c.div) {
+			div = strconv.FormatFloat(c.div, 'f', 4, 64)
+		}
+		row = append(row, div, strconv.FormatBool(c.flagged))
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeDivergences writes a table to w listing the flagged comparisons from comps.
+func writeDivergences(w io.Writer, comps []comparison, sources []string) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Date\tPeriod\tMetric\t")
+	for _, src := range sources {
+		fmt.Fprintf(tw, "%s\t", src)
+	}
+	fmt.Fprintln(tw, "Divergence\t")
+	for _, c := range comps {
+		if !c.flagged {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t", c.Date.Format("2006-01-02"), c.Period, c.Metric)
+		for _, src := range sources {
+			if v, ok := c.Values[src]; ok {
+				fmt.Fprintf(tw, "%s\t", formatValue(v))
+			} else {
+				fmt.Fprintf(tw, "-\t")
+			}
+		}
+		fmt.Fprintf(tw, "%0.0f%%\t\n", 100*c.div)
+	}
+	return tw.Flush()
+}
+
+// plotSources returns the sources from sources with values for m in comps.
+func plotSources(comps []comparison, m obs.Metric, sources []string) []string {
+	seen := make(map[string]struct{})
+	for _, c := range comps {
+		if c.Metric == m {
+			for src := range c.Values {
+				seen[src] = struct{}{}
+			}
+		}
+	}
+	var srcs []string
+	for _, src := range sources {
+		if _, ok := seen[src]; ok {
+			srcs = append(srcs, src)
+		}
+	}
+	return srcs
+}
+
+// writePlotData writes gnuplot data for plotting m's values from comps.
+// Each of sources' values are written to a separate block, followed by a block
+// containing the largest value from each flagged comparison.
+func writePlotData(w io.Writer, comps []comparison, m obs.Metric, sources []string) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	for _, src := range sources {
+		printf("Date\t%s\n", src)
+		for _, c := range comps {
+			if v, ok := c.Values[src]; ok && c.Metric == m {
+				printf("%s\t%s\n", c.Date.Format("2006-01-02"), formatValue(v))
+			}
+		}
+		printf("\n\n")
+	}
+	printf("Date\tFlagged\n")
+	var first string // first date with m's values
+	var nflagged int
+	for _, c := range comps {
+		if c.Metric != m {
+			continue
+		}
+		if first == "" {
+			first = c.Date.Format("2006-01-02")
+		}
+		if c.flagged {
+			printf("%s\t%s\n", c.Date.Format("2006-01-02"), formatValue(maxValue(c.Values)))
+			nflagged++
+		}
+	}
+	if nflagged == 0 {
+		printf("%s\tNaN\n", first) // avoid an empty block
+	}
+	return err
+}
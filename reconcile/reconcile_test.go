@@ -0,0 +1,117 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/derat/covid/obs"
+	"github.com/google/go-cmp/cmp"
+)
+
+// day returns midnight UTC on the supplied day in September 2020.
+func day(d int) time.Time { return time.Date(2020, 9, d, 0, 0, 0, 0, time.UTC) }
+
+// rec returns a record with the supplied values. Days are in September 2020.
+func rec(d int, p obs.Period, geo string, m obs.Metric, v float64, src string, snap int) obs.Record {
+	return obs.Record{Date: day(d), Period: p, Geo: geo, Metric: m, Value: v, Source: src, Snapshot: day(snap)}
+}
+
+func TestDivergence(t *testing.T) {
+	for _, tc := range []struct {
+		vals map[string]float64
+		want float64
+	}{
+		{map[string]float64{"a": 100, "b": 80, "c": 90}, 0.2},
+		{map[string]float64{"a": 0, "b": 0}, 0},
+		{map[string]float64{"a": 0, "b": 5}, 1},
+		{map[string]float64{"a": 5}, math.NaN()},
+	} {
+		if got := divergence(tc.vals); !cmp.Equal(got, tc.want, cmp.Comparer(func(a, b float64) bool {
+			return (math.IsNaN(a) && math.IsNaN(b)) || math.Abs(a-b) < 1e-9
+		})) {
+			t.Errorf("divergence(%v) = %v; want %v", tc.vals, got, tc.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	recs := []obs.Record{
+		rec(19, obs.Weekly, "PR", obs.Deaths, 52, obs.CDC, 25),
+		rec(19, obs.Weekly, "PR", obs.Deaths, 30, obs.Tracking, 25),   // flagged
+		rec(19, obs.Weekly, "PR", obs.Tests, 5, obs.Bioportal, 25),    // too small
+		rec(19, obs.Weekly, "PR", obs.Tests, 2, obs.Tracking, 25),     // too small
+		rec(26, obs.Weekly, "PR", obs.Deaths, 50, obs.CDC, 27),        // one source
+		rec(26, obs.Weekly, "PR", obs.Tests, 1000, obs.Bioportal, 27), // close enough
+		rec(26, obs.Weekly, "PR", obs.Tests, 900, obs.Tracking, 27),
+	}
+	rows, sources := obs.Join(recs)
+	comps := compare(rows, 0.25, 10)
+	var flagged []string
+	for _, c := range comps {
+		if c.flagged {
+			flagged = append(flagged, c.Date.Format("2006-01-02")+" "+string(c.Metric))
+		}
+	}
+	if diff := cmp.Diff([]string{"2020-09-19 deaths"}, flagged); diff != "" {
+		t.Error("Bad flagged comparisons:\n" + diff)
+	}
+
+	var b bytes.Buffer
+	if err := writeComparisonCSV(&b, comps, sources); err != nil {
+		t.Fatal("writeComparisonCSV failed: ", err)
+	}
+	const want = "Date,Period,Metric,bioportal,cdc,tracking,Divergence,Flagged\n" +
+		"2020-09-19,weekly,deaths,,52,30,0.4231,true\n" +
+		"2020-09-19,weekly,tests,5,,2,0.6000,false\n" +
+		"2020-09-26,weekly,deaths,,50,,,false\n" +
+		"2020-09-26,weekly,tests,1000,,900,0.1000,false\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Error("writeComparisonCSV wrote bad data:\n" + diff)
+	}
+
+	if diff := cmp.Diff([]string{obs.CDC, obs.Tracking}, plotSources(comps, obs.Deaths, sources)); diff != "" {
+		t.Error("plotSources returned bad sources:\n" + diff)
+	}
+	b.Reset()
+	if err := writePlotData(&b, comps, obs.Deaths, []string{obs.CDC, obs.Tracking}); err != nil {
+		t.Fatal("writePlotData failed: ", err)
+	}
+	const wantData = "Date\tcdc\n2020-09-19\t52\n2020-09-26\t50\n\n\n" +
+		"Date\ttracking\n2020-09-19\t30\n\n\n" +
+		"Date\tFlagged\n2020-09-19\t52\n"
+	if diff := cmp.Diff(wantData, b.String()); diff != "" {
+		t.Error("writePlotData wrote bad data:\n" + diff)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	recs := []obs.Record{
+		rec(1, obs.Daily, "PR", obs.Tests, 1, obs.Tracking, 2),
+		rec(2, obs.Daily, "PR", obs.Tests, 2, obs.Tracking, 2),
+		rec(2, obs.Daily, "NY", obs.Tests, 3, obs.Tracking, 2),
+		rec(2, obs.Daily, "PR", obs.ICU, 4, obs.Tracking, 2),
+		rec(2, obs.Daily, "PR", obs.Deaths, 5, obs.Tracking, 2),
+	}
+	got := filter(recs, "PR", []obs.Metric{obs.Tests, obs.Deaths}, day(2))
+	if diff := cmp.Diff([]obs.Record{recs[1], recs[4]}, got); diff != "" {
+		t.Error("filter returned bad records:\n" + diff)
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	for s, want := range map[string]time.Weekday{"sat": time.Saturday, "Sunday": time.Sunday, "WED": time.Wednesday} {
+		if got, err := parseWeekday(s); err != nil || got != want {
+			t.Errorf("parseWeekday(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "s", "funday"} {
+		if _, err := parseWeekday(s); err == nil {
+			t.Errorf("parseWeekday(%q) unexpectedly succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+const sourcesTmpl = `
+set title '{{.Vars.Title}}'
+
+{{.SetTerm}}
+{{.SetOutput}}
+
+set timefmt '%Y-%m-%d'
+set xdata time
+set format x '%m/%d'
+set xlabel '{{.Vars.XLabel}}'
+set ylabel '{{.Vars.YLabel}}'
+set yrange [0:*]
+set grid front xtics ytics
+set key top left
+set bmargin 5
+{{.FooterLabel}}
+{{.ThemeCmds}}
+
+plot \
+{{- range $i, $src := .Vars.Sources}}
+  {{$.Data}} index {{$i}} using 1:2 with {{$.Vars.Style}} lw 2 title '{{$src}}', \
+{{- end}}
+  {{.Data}} index {{len .Vars.Sources}} using 1:2 with points pt 6 ps 2 lc rgb '#c62828' title '{{.Vars.FlagTitle}}'
+`
@@ -0,0 +1,261 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/input"
+)
+
+// Layout used for the "date" column, e.g. "20200704".
+const dateLayout = "20060102"
+
+// Layouts used for the "lastUpdateEt" (e.g. "9/20/2020 00:00") and
+// "dateModified" (e.g. "2020-09-20T04:00:00Z") columns.
+const (
+	lastUpdateLayout   = "1/2/2006 15:04"
+	dateModifiedLayout = time.RFC3339
+)
+
+// field identifies a numeric column in daily.csv.
+type field int
+
+const (
+	positive field = iota
+	negative
+	totalTestResults
+	hospitalizedCurrently
+	inIcuCurrently
+	onVentilatorCurrently
+	death
+	positiveIncrease
+	negativeIncrease
+	totalTestResultsIncrease
+	deathIncrease
+	hospitalizedIncrease
+	numFields
+)
+
+// fieldNames contains daily.csv column names, indexed by field.
+var fieldNames = [...]string{
+	positive:                 "positive",
+	negative:                 "negative",
+	totalTestResults:         "totalTestResults",
+	hospitalizedCurrently:    "hospitalizedCurrently",
+	inIcuCurrently:           "inIcuCurrently",
+	onVentilatorCurrently:    "onVentilatorCurrently",
+	death:                    "death",
+	positiveIncrease:         "positiveIncrease",
+	negativeIncrease:         "negativeIncrease",
+	totalTestResultsIncrease: "totalTestResultsIncrease",
+	deathIncrease:            "deathIncrease",
+	hospitalizedIncrease:     "hospitalizedIncrease",
+}
+
+func (f field) String() string { return fieldNames[f] }
+
+// record contains a single state's data for a single day.
+type record struct {
+	date    time.Time
+	state   string    // two-letter abbreviation, e.g. "CA"
+	grade   string    // "dataQualityGrade" value, e.g. "A+"; empty if unknown
+	updated time.Time // time at which the state last updated the record; zero if unknown
+	vals    [numFields]int
+	has     [numFields]bool // false if the corresponding value was empty or missing
+}
+
+// get returns r's value for f. false is returned if the value wasn't reported.
+func (r *record) get(f field) (int, bool) {
+	return r.vals[f], r.has[f]
+}
+
+// dataset holds records parsed from the COVID Tracking Project's daily.csv file:
+//
+//  date,state,positive,probableCases,negative,pending,totalTestResultsSource,...
+//  20200920,AK,7039,,409544,,totalTestsViral,416583,46,,,,6,...
+type dataset struct {
+	states []string             // sorted two-letter abbreviations
+	dates  []time.Time          // sorted dates with at least one record
+	recs   map[string][]*record // keyed by state and sorted by ascending date
+}
+
+// readDailyFile reads a dataset from the CSV file at p.
+func readDailyFile(p string) (*dataset, error) {
+	f, err := input.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readDaily(f)
+}
+
+// readDaily reads a dataset from a daily.csv file.
+// Fields missing from the file are treated as unreported.
+func readDaily(r io.Reader) (*dataset, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading header: %v", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[strings.TrimSpace(strings.TrimLeft(h, "\ufeff"))] = i
+	}
+	dateCol, ok := cols["date"]
+	if !ok {
+		return nil, fmt.Errorf(`missing column "date"`)
+	}
+	stateCol, ok := cols["state"]
+	if !ok {
+		return nil, fmt.Errorf(`missing column "state"`)
+	}
+
+	ds := &dataset{recs: make(map[string][]*record)}
+	seenDates := make(map[time.Time]struct{})
+	for line := 2; ; line++ {
+		vals, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(vals) <= dateCol || len(vals) <= stateCol {
+			continue
+		}
+
+		rec := &record{state: strings.TrimSpace(vals[stateCol])}
+		if rec.date, err = time.Parse(dateLayout, strings.TrimSpace(vals[dateCol])); err != nil {
+			return nil, fmt.Errorf("line %d: bad date %q", line, vals[dateCol])
+		}
+		if col, ok := cols["dataQualityGrade"]; ok && col < len(vals) {
+			rec.grade = strings.TrimSpace(vals[col])
+		}
+		for _, u := range []struct{ col, layout string }{
+			{"lastUpdateEt", lastUpdateLayout},
+			{"dateModified", dateModifiedLayout},
+		} {
+			if col, ok := cols[u.col]; ok && col < len(vals) && rec.updated.IsZero() {
+				// These values are sometimes missing or malformed, so ignore errors.
+				rec.updated, _ = time.Parse(u.layout, strings.TrimSpace(vals[col]))
+			}
+		}
+		for f := field(0); f < numFields; f++ {
+			col, ok := cols[f.String()]
+			if !ok || col >= len(vals) {
+				continue
+			}
+			s := strings.TrimSpace(vals[col])
+			if s == "" {
+				continue
+			}
+			if rec.vals[f], err = strconv.Atoi(s); err != nil {
+				// Some values are occasionally written as floats, e.g. "123.0".
+				fv, ferr := strconv.ParseFloat(s, 64)
+				if ferr != nil {
+					return nil, fmt.Errorf("line %d: bad %v %q", line, f, s)
+				}
+				rec.vals[f] = int(fv)
+			}
+			rec.has[f] = true
+		}
+
+		ds.recs[rec.state] = append(ds.recs[rec.state], rec)
+		seenDates[rec.date] = struct{}{}
+	}
+
+	for st, recs := range ds.recs {
+		sort.Slice(recs, func(i, j int) bool { return recs[i].date.Before(recs[j].date) })
+		for i := 1; i < len(recs); i++ {
+			if recs[i].date.Equal(recs[i-1].date) {
+				return nil, fmt.Errorf("multiple rows for %v on %v", st, recs[i].date.Format("2006-01-02"))
+			}
+		}
+		ds.states = append(ds.states, st)
+	}
+	sort.Strings(ds.states)
+	for d := range seenDates {
+		ds.dates = append(ds.dates, d)
+	}
+	sort.Slice(ds.dates, func(i, j int) bool { return ds.dates[i].Before(ds.dates[j]) })
+	return ds, nil
+}
+
+// find returns the record for state on date, or nil if there isn't one.
+func (ds *dataset) find(state string, date time.Time) *record {
+	recs := ds.recs[state]
+	i := sort.Search(len(recs), func(i int) bool { return !recs[i].date.Before(date) })
+	if i < len(recs) && recs[i].date.Equal(date) {
+		return recs[i]
+	}
+	return nil
+}
+
+// lastDate returns the latest date in ds, or the zero time if ds is empty.
+func (ds *dataset) lastDate() time.Time {
+	if len(ds.dates) == 0 {
+		return time.Time{}
+	}
+	return ds.dates[len(ds.dates)-1]
+}
+
+// weekEnds returns the last days of the supplied number of consecutive weeks,
+// in ascending order and ending with last.
+func weekEnds(last time.Time, weeks int) []time.Time {
+	ends := make([]time.Time, weeks)
+	for i := range ends {
+		ends[i] = last.AddDate(0, 0, -7*(weeks-1-i))
+	}
+	return ends
+}
+
+// weeklyPositivity returns each state's positivity rate over the 7 days ending at end.
+// Only days on which the state reported positive tests and at least minTests new tests
+// are included, and days on which all new tests were positive (likely indicating that
+// the state only reported positive results) are skipped. States without any
+// qualifying days are omitted.
+func (ds *dataset) weeklyPositivity(end time.Time, minTests int) map[string]float64 {
+	start := end.AddDate(0, 0, -7)
+	rates := make(map[string]float64)
+	for _, st := range ds.states {
+		var pos, tot int
+		for _, rec := range ds.recs[st] {
+			if !rec.date.After(start) || rec.date.After(end) {
+				continue
+			}
+			p, pok := rec.get(positiveIncrease)
+			t, tok := rec.get(totalTestResultsIncrease)
+			if pok && tok && p > 0 && t >= minTests && p != t {
+				pos += p
+				tot += t
+			}
+		}
+		if tot > 0 {
+			rates[st] = float64(pos) / float64(tot)
+		}
+	}
+	return rates
+}
+
+// values returns each state's value for f on date. States that
+// didn't report a value are omitted.
+func (ds *dataset) values(f field, date time.Time) map[string]int {
+	vals := make(map[string]int)
+	for _, st := range ds.states {
+		if rec := ds.find(st, date); rec != nil {
+			if v, ok := rec.get(f); ok {
+				vals[st] = v
+			}
+		}
+	}
+	return vals
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Input data used by tests.
+const testDaily = "date,state,positive,negative,hospitalizedCurrently,positiveIncrease,totalTestResultsIncrease\n" +
+	"20200703,CA,1000,9000,50,100,2000\n" +
+	"20200703,AK,10,90,,1,1\n" +
+	"20200702,CA,900,7200,45,80,1000\n" +
+	"20200701,CA,820,6300,40,20,500\n" +
+	"20200625,CA,800,5000,35.0,100,1000\n"
+
+// day returns midnight UTC on the supplied day in July 2020.
+func day(d int) time.Time { return time.Date(2020, 7, d, 0, 0, 0, 0, time.UTC) }
+
+func TestReadDaily(t *testing.T) {
+	ds, err := readDaily(strings.NewReader(testDaily))
+	if err != nil {
+		t.Fatal("readDaily failed: ", err)
+	}
+	if diff := cmp.Diff([]string{"AK", "CA"}, ds.states); diff != "" {
+		t.Error("Bad states:\n" + diff)
+	}
+	if diff := cmp.Diff([]time.Time{day(-5), day(1), day(2), day(3)}, ds.dates); diff != "" {
+		t.Error("Bad dates:\n" + diff)
+	}
+
+	rec := ds.find("CA", day(2))
+	if rec == nil {
+		t.Fatal("No record for CA on 20200702")
+	}
+	for f, want := range map[field]int{positive: 900, negative: 7200, hospitalizedCurrently: 45} {
+		if v, ok := rec.get(f); !ok || v != want {
+			t.Errorf("CA 20200702 %v is %v (%v); want %v", f, v, ok, want)
+		}
+	}
+	if v, ok := rec.get(death); ok {
+		t.Errorf("CA 20200702 unexpectedly has %v %v", death, v)
+	}
+	if ds.find("AK", day(2)) != nil {
+		t.Error("Unexpectedly found record for AK on 20200702")
+	}
+
+	if diff := cmp.Diff(map[string]int{"CA": 50}, ds.values(hospitalizedCurrently, day(3))); diff != "" {
+		t.Error("Bad hospitalizations:\n" + diff)
+	}
+	if diff := cmp.Diff(map[string]int{"CA": 35}, ds.values(hospitalizedCurrently, day(-5))); diff != "" {
+		t.Error("Bad hospitalizations for float value:\n" + diff)
+	}
+
+	// AK's only day is skipped since all tests were positive, and CA's
+	// 20200701 day is skipped due to having too few tests.
+	if diff := cmp.Diff(map[string]float64{"CA": 180.0 / 3000}, ds.weeklyPositivity(day(3), 1000)); diff != "" {
+		t.Error("Bad weekly positivity:\n" + diff)
+	}
+
+	if _, err := readDaily(strings.NewReader(testDaily + "20200703,CA,1,2,3,4,5\n")); err == nil {
+		t.Error("readDaily unexpectedly accepted duplicate row")
+	}
+}
+
+func TestWeekEnds(t *testing.T) {
+	got := weekEnds(time.Date(2020, 7, 3, 0, 0, 0, 0, time.UTC), 3)
+	want := []time.Time{
+		time.Date(2020, 6, 19, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 6, 26, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 7, 3, 0, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("Bad week ends:\n" + diff)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateValue holds a single state's value.
+type stateValue struct {
+	state string
+	val   float64
+}
+
+// boxStats summarizes a distribution of per-state values for a boxplot.
+type boxStats struct {
+	n          int          // number of values
+	q1, median float64      // first quartile and median
+	q3         float64      // third quartile
+	lo, hi     float64      // lowest and highest non-outlier values (i.e. whisker ends)
+	outliers   []stateValue // values outside of the fences, sorted by descending value
+}
+
+// computeBox computes boxplot stats for vals. Values more than iqrMult times the
+// interquartile range below the first quartile or above the third quartile are outliers.
+// All fields are NaN if vals is empty.
+func computeBox(vals map[string]float64, iqrMult float64) boxStats {
+	svs := make([]stateValue, 0, len(vals))
+	for st, v := range vals {
+		svs = append(svs, stateValue{st, v})
+	}
+	sort.Slice(svs, func(i, j int) bool {
+		if svs[i].val != svs[j].val {
+			return svs[i].val < svs[j].val
+		}
+		return svs[i].state < svs[j].state
+	})
+
+	nan := math.NaN()
+	bs := boxStats{n: len(svs), q1: nan, median: nan, q3: nan, lo: nan, hi: nan}
+	if len(svs) == 0 {
+		return bs
+	}
+	bs.q1, bs.median, bs.q3 = quantile(svs, 0.25), quantile(svs, 0.5), quantile(svs, 0.75)
+	iqr := bs.q3 - bs.q1
+	lf, hf := bs.q1-iqrMult*iqr, bs.q3+iqrMult*iqr
+	for _, sv := range svs {
+		if sv.val < lf || sv.val > hf {
+			bs.outliers = append(bs.outliers, sv)
+			continue
+		}
+		if math.IsNaN(bs.lo) {
+			bs.lo = sv.val
+		}
+		bs.hi = sv.val
+	}
+	sort.SliceStable(bs.outliers, func(i, j int) bool { return bs.outliers[i].val > bs.outliers[j].val })
+	return bs
+}
+
+// quantile returns the q-th quantile (e.g. 0.5 for the median) of sorted,
+// linearly interpolating between the closest values.
+func quantile(sorted []stateValue, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1].val
+	}
+	f := pos - float64(i)
+	return sorted[i].val + f*(sorted[i+1].val-sorted[i].val)
+}
+
+// weekDist holds per-state values and boxplot stats for a week.
+type weekDist struct {
+	end  time.Time          // last day of week
+	vals map[string]float64 // per-state values
+	box  boxStats
+}
+
+// computeDists calls f for each of ends and returns the resulting distributions.
+func computeDists(ends []time.Time, iqrMult float64, f func(end time.Time) map[string]float64) []weekDist {
+	dists := make([]weekDist, len(ends))
+	for i, end := range ends {
+		vals := f(end)
+		dists[i] = weekDist{end, vals, computeBox(vals, iqrMult)}
+	}
+	return dists
+}
+
+// writeDistData writes gnuplot data for plotting dists. The first block contains each week's
+// boxplot stats, and the second block contains outliers along with their states.
+func writeDistData(w io.Writer, dists []weekDist) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	printf("X\tLo\tQ1\tMedian\tQ3\tHi\n")
+	for i, d := range dists {
+		b := d.box
+		printf("%d\t%0.4f\t%0.4f\t%0.4f\t%0.4f\t%0.4f\n", i, b.lo, b.q1, b.median, b.q3, b.hi)
+	}
+	printf("\n\nX\tValue\tState\n")
+	var nout int
+	for i, d := range dists {
+		for _, o := range d.box.outliers {
+			printf("%d\t%0.4f\t%s\n", i, o.val, o.state)
+			nout++
+		}
+	}
+	if nout == 0 {
+		printf("0\tNaN\t-\n") // avoid an empty block
+	}
+	return err
+}
+
+// writeDistCSV writes dists to w as CSV:
+//
+//  Week Ending,States,Q1,Median,Q3,Lower Whisker,Upper Whisker,Outliers,AK,AL,...
+//  2020-09-20,50,0.0312,0.0455,...,TX:0.2103 SD:0.1904,0.0101,0.0853,...
+//
+// Outliers are listed as space-separated "state:value" pairs, followed by each state's value
+// (or an empty string if the state had no value).
+func writeDistCSV(w io.Writer, dists []weekDist, states []string) error {
+	f := func(v float64) string {
+		if math.IsNaN(v) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"Week Ending", "States", "Q1", "Median", "Q3",
+		"Lower Whisker", "Upper Whisker", "Outliers"}, states...))
+	for _, d := range dists {
+		b := d.box
+		outs := make([]string, len(b.outliers))
+		for i, o := range b.outliers {
+			outs[i] = o.state + ":" + f(o.val)
+		}
+		row := []string{d.end.Format("2006-01-02"), strconv.Itoa(b.n), f(b.q1), f(b.median), f(b.q3),
+			f(b.lo), f(b.hi), strings.Join(outs, " ")}
+		for _, st := range states {
+			if v, ok := d.vals[st]; ok {
+				row = append(row, f(v))
+			} else {
+				row = append(row, "")
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
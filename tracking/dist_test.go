@@ -0,0 +1,59 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestComputeBox(t *testing.T) {
+	vals := map[string]float64{
+		"AK": 1, "AL": 2, "AZ": 3, "CA": 4, "CO": 5, "CT": 6, "DE": 7, "FL": 8, "GA": 30, "HI": -20,
+	}
+	got := computeBox(vals, 1.5)
+	want := boxStats{
+		n: 10, q1: 2.25, median: 4.5, q3: 6.75, lo: 1, hi: 8,
+		outliers: []stateValue{{"GA", 30}, {"HI", -20}},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(boxStats{}, stateValue{})); diff != "" {
+		t.Error("computeBox returned bad stats:\n" + diff)
+	}
+
+	// A larger multiplier should include all of the values.
+	if got := computeBox(vals, 10); len(got.outliers) != 0 || got.lo != -20 || got.hi != 30 {
+		t.Errorf("computeBox with large multiplier returned %+v", got)
+	}
+
+	got = computeBox(nil, 1.5)
+	nan := math.NaN()
+	want = boxStats{q1: nan, median: nan, q3: nan, lo: nan, hi: nan}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(boxStats{}), cmpopts.EquateNaNs()); diff != "" {
+		t.Error("computeBox returned bad stats for empty input:\n" + diff)
+	}
+}
+
+func TestWriteDistCSV(t *testing.T) {
+	dists := []weekDist{
+		{end: day(3), vals: map[string]float64{"CA": 0.1, "NY": 0.2}},
+		{end: day(10), vals: map[string]float64{"CA": 0.15}},
+	}
+	for i := range dists {
+		dists[i].box = computeBox(dists[i].vals, 1.5)
+	}
+	var b bytes.Buffer
+	if err := writeDistCSV(&b, dists, []string{"AK", "CA", "NY"}); err != nil {
+		t.Fatal("writeDistCSV failed: ", err)
+	}
+	want := "Week Ending,States,Q1,Median,Q3,Lower Whisker,Upper Whisker,Outliers,AK,CA,NY\n" +
+		"2020-07-03,2,0.1250,0.1500,0.1750,0.1000,0.2000,,,0.1000,0.2000\n" +
+		"2020-07-10,1,0.1500,0.1500,0.1500,0.1500,0.1500,,,0.1500,\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Error("writeDistCSV wrote bad data:\n" + diff)
+	}
+}
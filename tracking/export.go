@@ -0,0 +1,53 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"github.com/derat/covid/obs"
+)
+
+// exportFields maps fields to the metrics used when exporting them.
+var exportFields = map[field]obs.Metric{
+	totalTestResultsIncrease: obs.Tests,
+	positiveIncrease:         obs.Positives,
+	deathIncrease:            obs.Deaths,
+	hospitalizedCurrently:    obs.Hospitalized,
+	inIcuCurrently:           obs.ICU,
+}
+
+// records returns daily records for each state's values in ds. Positivity is included
+// for days with at least minTests new tests. The dataset's last date is used as the snapshot.
+func (ds *dataset) records(minTests int) []obs.Record {
+	var recs []obs.Record
+	snap := obs.Day(ds.lastDate())
+	for _, st := range ds.states {
+		for _, rec := range ds.recs[st] {
+			add := func(m obs.Metric, v float64) {
+				recs = append(recs, obs.Record{
+					Date:     obs.Day(rec.date),
+					Period:   obs.Daily,
+					Geo:      st,
+					Metric:   m,
+					Value:    v,
+					Source:   obs.Tracking,
+					Snapshot: snap,
+				})
+			}
+			for f := field(0); f < numFields; f++ {
+				if m, ok := exportFields[f]; ok {
+					if v, ok := rec.get(f); ok {
+						add(m, float64(v))
+					}
+				}
+			}
+			tests, tok := rec.get(totalTestResultsIncrease)
+			pos, pok := rec.get(positiveIncrease)
+			if tok && pok && tests > 0 && tests >= minTests {
+				add(obs.Positivity, float64(pos)/float64(tests))
+			}
+		}
+	}
+	obs.Sort(recs)
+	return recs
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/derat/covid/obs"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecords(t *testing.T) {
+	ds, err := readDaily(strings.NewReader(
+		"date,state,hospitalizedCurrently,positiveIncrease,totalTestResultsIncrease\n" +
+			"20200703,PR,50,100,2000\n" +
+			"20200702,PR,,80,500\n"))
+	if err != nil {
+		t.Fatal("readDaily failed: ", err)
+	}
+	rec := func(d int, m obs.Metric, v float64) obs.Record {
+		return obs.Record{Date: day(d), Period: obs.Daily, Geo: "PR", Metric: m,
+			Value: v, Source: obs.Tracking, Snapshot: day(3)}
+	}
+	want := []obs.Record{
+		rec(2, obs.Positives, 80),
+		rec(2, obs.Tests, 500),
+		rec(3, obs.Hospitalized, 50),
+		rec(3, obs.Positives, 100),
+		rec(3, obs.Positivity, 0.05),
+		rec(3, obs.Tests, 2000),
+	}
+	if diff := cmp.Diff(want, ds.records(1000)); diff != "" {
+		t.Error("Bad records:\n" + diff)
+	}
+}
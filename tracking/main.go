@@ -0,0 +1,245 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/derat/covid/filewriter"
+	"github.com/derat/covid/gnuplot"
+	"github.com/derat/covid/obs"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] <out-dir>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	dailyPath := flag.String("daily", "daily.csv", "COVID Tracking Project states daily CSV file")
+	statesStr := flag.String("states", "AZ CA FL GA NV TX", "Space- or comma-separated states for time plots")
+	weeks := flag.Int("weeks", 8, "Number of weeks in distribution plots and quality summary")
+	minTests := flag.Int("min-tests", 1000, "Minimum new tests for a day to be included in positivity distributions")
+	iqrMult := flag.Float64("iqr", 1.5, "Multiple of interquartile range beyond which distribution values are outliers")
+	staleDays := flag.Int("stale-days", 3, "Consecutive identical values after which values are stale (0 to disable)")
+	themeName := flag.String("theme", gnuplot.DefaultTheme,
+		fmt.Sprintf("Plot theme (%s)", strings.Join(gnuplot.ThemeNames(), ", ")))
+	keepScripts := flag.Bool("keep-scripts", false, "Keep gnuplot scripts next to plots for debugging")
+	exportPath := flag.String("export", "", "File to which daily per-state records will be written as CSV (see obs package)")
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	outDir := flag.Arg(0)
+
+	if *weeks <= 0 {
+		log.Fatalf("Bad -weeks %d", *weeks)
+	}
+	theme, err := gnuplot.LookupTheme(*themeName)
+	if err != nil {
+		log.Fatal("Bad -theme: ", err)
+	}
+
+	ds, err := readDailyFile(*dailyPath)
+	if err != nil {
+		log.Fatalf("Failed reading %v: %v", *dailyPath, err)
+	}
+	if len(ds.dates) == 0 {
+		log.Fatalf("No data in %v", *dailyPath)
+	}
+
+	states := strings.FieldsFunc(strings.ToUpper(*statesStr), func(r rune) bool { return r == ' ' || r == ',' })
+	for _, st := range states {
+		if _, ok := ds.recs[st]; !ok {
+			log.Fatalf("No data for state %q", st)
+		}
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatal("Failed creating output dir: ", err)
+	}
+
+	if *exportPath != "" {
+		fw := filewriter.New(*exportPath)
+		werr := obs.WriteCSV(fw, ds.records(*minTests))
+		if err := fw.Close(); err != nil {
+			log.Fatalf("Failed writing %v: %v", *exportPath, err)
+		} else if werr != nil {
+			log.Fatalf("Failed writing %v: %v", *exportPath, werr)
+		}
+	}
+
+	ends := weekEnds(ds.lastDate(), *weeks)
+	start := ends[0].AddDate(0, 0, -6)
+	allEnds := weekEnds(ds.lastDate(), int(ds.lastDate().Sub(ds.dates[0]).Hours()/24/7)+1)
+	for _, out := range []struct {
+		fn    string                  // output file, e.g. "quality.csv"
+		write func(w io.Writer) error // writes data
+	}{
+		{"quality.csv", func(w io.Writer) error { return writeQualityCSV(w, ds, allEnds, *staleDays) }},
+		{"quality.txt", func(w io.Writer) error {
+			return writeQualitySummary(w, ds, start, ends[len(ends)-1], *staleDays)
+		}},
+	} {
+		fw := filewriter.New(filepath.Join(outDir, out.fn))
+		werr := out.write(fw)
+		if err := fw.Close(); err != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, err)
+		} else if werr != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, werr)
+		}
+	}
+
+	// Returns a plot function that writes a data block with f's values for each state.
+	makeTimeFunc := func(f field) func(w io.Writer) {
+		return func(w io.Writer) {
+			for i, st := range states {
+				if i > 0 {
+					fmt.Fprintf(w, "\n\n")
+				}
+				fmt.Fprintf(w, "Date\t%s\n", f)
+				for _, rec := range ds.recs[st] {
+					if v, ok := rec.get(f); ok {
+						fmt.Fprintf(w, "%s\t%d\n", rec.date.Format("2006-01-02"), v)
+					}
+				}
+			}
+		}
+	}
+
+	// Returns template variables for a time plot of f. Days on which states' values
+	// were missing, stale, or backfilled are hatched.
+	timeVars := func(f field, title, ylabel string) map[string]interface{} {
+		var hatches []hatch
+		for i, st := range states {
+			for _, g := range ds.gaps(st, f, *staleDays) {
+				hatches = append(hatches, newHatch(g, i+1))
+			}
+		}
+		return map[string]interface{}{
+			"Title":     title,
+			"YLabel":    ylabel,
+			"States":    states,
+			"StateList": strings.Join(states, ", "),
+			"Hatches":   hatches,
+
+			"MissingPattern":    missingPattern,
+			"StalePattern":      stalePattern,
+			"BackfilledPattern": backfilledPattern,
+		}
+	}
+
+	posDists := computeDists(ends, *iqrMult, func(end time.Time) map[string]float64 {
+		return ds.weeklyPositivity(end, *minTests)
+	})
+	hospDists := computeDists(ends, *iqrMult, func(end time.Time) map[string]float64 {
+		vals := make(map[string]float64)
+		for st, v := range ds.values(hospitalizedCurrently, end) {
+			vals[st] = float64(v)
+		}
+		return vals
+	})
+	for _, out := range []struct {
+		fn    string     // output file, e.g. "pos_rate_dist.csv"
+		dists []weekDist // distributions to write
+	}{
+		{"pos_rate_dist.csv", posDists},
+		{"hosp_dist.csv", hospDists},
+	} {
+		fw := filewriter.New(filepath.Join(outDir, out.fn))
+		werr := writeDistCSV(fw, out.dists, ds.states)
+		if err := fw.Close(); err != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, err)
+		} else if werr != nil {
+			log.Fatalf("Failed writing %v: %v", out.fn, werr)
+		}
+	}
+
+	// Returns a plot function that writes dists' boxplot data.
+	makeDistFunc := func(dists []weekDist) func(w io.Writer) {
+		return func(w io.Writer) { writeDistData(w, dists) }
+	}
+
+	// Returns x-axis labels for distribution plots, including the number of values per week.
+	distLabels := func(dists []weekDist) []string {
+		labels := make([]string, len(dists))
+		for i, d := range dists {
+			labels[i] = fmt.Sprintf("%s\\n{/*0.6 n=%d}", d.end.Format("01/02"), d.box.n)
+		}
+		return labels
+	}
+
+	now := time.Now()
+
+	for _, plot := range []struct {
+		out  string                 // output file, e.g. "my-plot.png"
+		tmpl string                 // gnuplot template data
+		data func(w io.Writer)      // writes gnuplot data to w
+		vars map[string]interface{} // extra variables to pass to template
+	}{
+		{
+			out:  "hosp_time.png",
+			tmpl: timeTmpl,
+			data: makeTimeFunc(hospitalizedCurrently),
+			vars: timeVars(hospitalizedCurrently, "COVID-19 hospitalizations", "Current COVID-19 hospitalizations"),
+		},
+		{
+			out:  "icu_time.png",
+			tmpl: timeTmpl,
+			data: makeTimeFunc(inIcuCurrently),
+			vars: timeVars(inIcuCurrently, "COVID-19 ICU usage", "Current COVID-19 ICU usage"),
+		},
+		{
+			out:  "deaths_time.png",
+			tmpl: timeTmpl,
+			data: makeTimeFunc(death),
+			vars: timeVars(death, "cumulative COVID-19 deaths", "Cumulative COVID-19 deaths"),
+		},
+		{
+			out:  "pos_rate_dist.png",
+			tmpl: distTmpl,
+			data: makeDistFunc(posDists),
+			vars: map[string]interface{}{
+				"Title": "per-state weekly COVID-19 test positivity rates\\n" +
+					fmt.Sprintf("{/*0.8 Only includes days where state reported at least %d new tests}", *minTests),
+				"XLabel": "Week ending",
+				"YLabel": "Positivity rate",
+				"Labels": distLabels(posDists),
+			},
+		},
+		{
+			out:  "hosp_dist.png",
+			tmpl: distTmpl,
+			data: makeDistFunc(hospDists),
+			vars: map[string]interface{}{
+				"Title":  "per-state COVID-19 hospitalizations",
+				"XLabel": "Date",
+				"YLabel": "Current COVID-19 hospitalizations",
+				"Labels": distLabels(hospDists),
+			},
+		},
+	} {
+		var b bytes.Buffer
+		plot.data(&b)
+		ip := filepath.Join(outDir, plot.out)
+		td, err := gnuplot.NewTemplateData(ip, theme, now, plot.vars)
+		if err != nil {
+			log.Fatalf("Failed plotting %v: %v", plot.out, err)
+		}
+		opts := gnuplot.KeepOptions(ip, *keepScripts)
+		opts.Data = b.Bytes()
+		if err := gnuplot.ExecTemplateOptions(plot.tmpl, td, opts); err != nil {
+			log.Fatalf("Failed plotting %v: %v", plot.out, err)
+		}
+	}
+}
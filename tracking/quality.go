@@ -0,0 +1,246 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Records updated more than this long after the end of their dates are considered to have
+// been backfilled, e.g. because a state revised its earlier numbers.
+const backfillDelay = 48 * time.Hour
+
+// qualityFields lists the fields examined by quality reports.
+var qualityFields = []field{
+	hospitalizedCurrently, inIcuCurrently, death, positiveIncrease, totalTestResultsIncrease,
+}
+
+// dayStatus describes the state of a field's value on a given day.
+type dayStatus int
+
+const (
+	statusOK         dayStatus = iota
+	statusMissing              // no value was reported
+	statusStale                // the value was unchanged from earlier days
+	statusBackfilled           // the value was reported well after the day (see backfillDelay)
+)
+
+func (s dayStatus) String() string {
+	switch s {
+	case statusOK:
+		return "ok"
+	case statusMissing:
+		return "missing"
+	case statusStale:
+		return "stale"
+	case statusBackfilled:
+		return "backfilled"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
+// fieldStatus returns the status of state's values for f for each day from the first day on
+// which f was reported through the last date in ds. Days are considered stale if they're part
+// of a run of at least minStale consecutive days with the same value (the first day of the run
+// is not stale). Other days with values are considered backfilled if their records were.
+// Nil is returned if state never reported f.
+func (ds *dataset) fieldStatus(state string, f field, minStale int) (dates []time.Time, status []dayStatus) {
+	var vals []int
+	var backfilled []bool
+	for _, rec := range ds.recs[state] {
+		v, ok := rec.get(f)
+		if len(dates) == 0 {
+			if !ok {
+				continue // not reported yet
+			}
+		} else {
+			// Fill in days without records.
+			for d := dates[len(dates)-1].AddDate(0, 0, 1); d.Before(rec.date); d = d.AddDate(0, 0, 1) {
+				dates = append(dates, d)
+				status = append(status, statusMissing)
+				vals = append(vals, 0)
+				backfilled = append(backfilled, false)
+			}
+		}
+		dates = append(dates, rec.date)
+		vals = append(vals, v)
+		backfilled = append(backfilled, rec.backfilled())
+		if ok {
+			status = append(status, statusOK)
+		} else {
+			status = append(status, statusMissing)
+		}
+	}
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	for d := dates[len(dates)-1].AddDate(0, 0, 1); !d.After(ds.lastDate()); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+		status = append(status, statusMissing)
+		vals = append(vals, 0)
+	}
+
+	// Find runs of repeated values.
+	if minStale > 1 {
+		for start := 0; start < len(vals); {
+			end := start + 1
+			for end < len(vals) && status[end] == statusOK && vals[end] == vals[start] {
+				end++
+			}
+			if status[start] == statusOK && end-start >= minStale {
+				for i := start + 1; i < end; i++ {
+					status[i] = statusStale
+				}
+			}
+			start = end
+		}
+	}
+	for i, bf := range backfilled {
+		if bf && status[i] == statusOK {
+			status[i] = statusBackfilled
+		}
+	}
+	return dates, status
+}
+
+// backfilled returns true if r was updated well after its date.
+func (r *record) backfilled() bool {
+	return !r.updated.IsZero() && r.updated.Sub(r.date.AddDate(0, 0, 1)) > backfillDelay
+}
+
+// gap describes a range of consecutive days with the same status.
+type gap struct {
+	start, end time.Time // inclusive
+	status     dayStatus // statusMissing, statusStale, or statusBackfilled
+}
+
+// gaps returns ranges of days on which state's values for f were missing, stale, or backfilled.
+// See fieldStatus.
+func (ds *dataset) gaps(state string, f field, minStale int) []gap {
+	dates, status := ds.fieldStatus(state, f, minStale)
+	var gaps []gap
+	for i, st := range status {
+		if st == statusOK {
+			continue
+		}
+		if n := len(gaps); n > 0 && gaps[n-1].status == st && gaps[n-1].end.Equal(dates[i].AddDate(0, 0, -1)) {
+			gaps[n-1].end = dates[i]
+		} else {
+			gaps = append(gaps, gap{dates[i], dates[i], st})
+		}
+	}
+	return gaps
+}
+
+// qualityStats summarizes the quality of a field's values over a range of days.
+type qualityStats struct {
+	days    int // days in range since the field was first reported
+	missing int // days with missing values
+	stale   int // days with stale values
+}
+
+// complete returns the fraction of days with fresh values, or -1 if there are no days.
+func (qs qualityStats) complete() float64 {
+	if qs.days == 0 {
+		return -1
+	}
+	return float64(qs.days-qs.missing-qs.stale) / float64(qs.days)
+}
+
+// fieldQuality returns stats for state's values for f from start to end, inclusive.
+func (ds *dataset) fieldQuality(state string, f field, start, end time.Time, minStale int) qualityStats {
+	var qs qualityStats
+	dates, status := ds.fieldStatus(state, f, minStale)
+	for i, d := range dates {
+		if d.Before(start) || d.After(end) {
+			continue
+		}
+		qs.days++
+		switch status[i] {
+		case statusMissing:
+			qs.missing++
+		case statusStale:
+			qs.stale++
+		}
+	}
+	return qs
+}
+
+// recordQuality returns the number of state's records from start to end (inclusive), the
+// number of them that were backfilled, and the last data quality grade in the range.
+func (ds *dataset) recordQuality(state string, start, end time.Time) (recs, backfilled int, grade string) {
+	for _, rec := range ds.recs[state] {
+		if rec.date.Before(start) || rec.date.After(end) {
+			continue
+		}
+		recs++
+		if rec.backfilled() {
+			backfilled++
+		}
+		if rec.grade != "" {
+			grade = rec.grade
+		}
+	}
+	return recs, backfilled, grade
+}
+
+// writeQualityCSV writes weekly per-state data quality information to w:
+//
+//  State,Week Ending,Grade,Records,Backfilled,hospitalizedCurrently Missing,hospitalizedCurrently Stale,...
+//  AK,2020-09-13,A,7,0,0,2,...
+//
+// ends contains the last day of each week.
+func writeQualityCSV(w io.Writer, ds *dataset, ends []time.Time, minStale int) error {
+	cw := csv.NewWriter(w)
+	header := []string{"State", "Week Ending", "Grade", "Records", "Backfilled"}
+	for _, f := range qualityFields {
+		header = append(header, f.String()+" Missing", f.String()+" Stale")
+	}
+	cw.Write(header)
+	for _, st := range ds.states {
+		for _, end := range ends {
+			start := end.AddDate(0, 0, -6)
+			recs, backfilled, grade := ds.recordQuality(st, start, end)
+			row := []string{st, end.Format("2006-01-02"), grade, strconv.Itoa(recs), strconv.Itoa(backfilled)}
+			for _, f := range qualityFields {
+				qs := ds.fieldQuality(st, f, start, end, minStale)
+				row = append(row, strconv.Itoa(qs.missing), strconv.Itoa(qs.stale))
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeQualitySummary writes a table to w summarizing each state's data quality from
+// start to end (inclusive). Each field's column contains the percentage of days with fresh
+// values since the state first reported the field.
+func writeQualitySummary(w io.Writer, ds *dataset, start, end time.Time, minStale int) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "State\tGrade\tRecords\tBackfilled\t")
+	for _, f := range qualityFields {
+		fmt.Fprintf(tw, "%s\t", f)
+	}
+	fmt.Fprintln(tw)
+	for _, st := range ds.states {
+		recs, backfilled, grade := ds.recordQuality(st, start, end)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t", st, grade, recs, backfilled)
+		for _, f := range qualityFields {
+			if c := ds.fieldQuality(st, f, start, end, minStale).complete(); c < 0 {
+				fmt.Fprintf(tw, "-\t")
+			} else {
+				fmt.Fprintf(tw, "%0.0f%%\t", 100*c)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
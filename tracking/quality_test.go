@@ -0,0 +1,96 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Input data used by quality tests. CA doesn't report hospitalizations until 20200702,
+// omits them on 20200704, and has no record for 20200706. Its value of 60 is repeated for
+// 20200707-20200709, and its 20200703 record was updated several days later.
+const testQuality = "date,state,dataQualityGrade,lastUpdateEt,hospitalizedCurrently\n" +
+	"20200701,CA,B,7/1/2020 23:00,\n" +
+	"20200702,CA,B,7/2/2020 23:00,40\n" +
+	"20200703,CA,B,7/8/2020 12:00,45\n" +
+	"20200704,CA,B,7/4/2020 23:00,\n" +
+	"20200705,CA,A,7/5/2020 23:00,50\n" +
+	"20200707,CA,A,7/7/2020 23:00,60\n" +
+	"20200708,CA,A,7/8/2020 23:00,60\n" +
+	"20200709,CA,A,,60\n" +
+	"20200710,AK,C,7/10/2020 23:00,5\n"
+
+func TestDataset_FieldStatus(t *testing.T) {
+	ds, err := readDaily(strings.NewReader(testQuality))
+	if err != nil {
+		t.Fatal("readDaily failed: ", err)
+	}
+
+	dates, status := ds.fieldStatus("CA", hospitalizedCurrently, 3)
+	wantDates := []time.Time{day(2), day(3), day(4), day(5), day(6), day(7), day(8), day(9), day(10)}
+	if diff := cmp.Diff(wantDates, dates); diff != "" {
+		t.Error("Bad dates:\n" + diff)
+	}
+	wantStatus := []dayStatus{statusOK, statusBackfilled, statusMissing, statusOK, statusMissing,
+		statusOK, statusStale, statusStale, statusMissing}
+	if diff := cmp.Diff(wantStatus, status); diff != "" {
+		t.Error("Bad status:\n" + diff)
+	}
+
+	// Runs shorter than the stale threshold shouldn't be reported.
+	if _, status := ds.fieldStatus("CA", hospitalizedCurrently, 4); status[6] != statusOK {
+		t.Errorf("Got status %v for 20200708 with 4-day threshold; want %v", status[6], statusOK)
+	}
+	if dates, _ := ds.fieldStatus("CA", death, 3); dates != nil {
+		t.Errorf("Got dates %v for unreported field", dates)
+	}
+
+	want := []gap{
+		{day(3), day(3), statusBackfilled},
+		{day(4), day(4), statusMissing},
+		{day(6), day(6), statusMissing},
+		{day(8), day(9), statusStale},
+		{day(10), day(10), statusMissing},
+	}
+	if diff := cmp.Diff(want, ds.gaps("CA", hospitalizedCurrently, 3), cmp.AllowUnexported(gap{})); diff != "" {
+		t.Error("Bad gaps:\n" + diff)
+	}
+
+	qs := ds.fieldQuality("CA", hospitalizedCurrently, day(1), day(7), 3)
+	if want := (qualityStats{days: 6, missing: 2}); qs != want {
+		t.Errorf("fieldQuality returned %+v; want %+v", qs, want)
+	}
+	if recs, backfilled, grade := ds.recordQuality("CA", day(1), day(7)); recs != 6 || backfilled != 1 || grade != "A" {
+		t.Errorf("recordQuality returned %v, %v, %q; want 6, 1, \"A\"", recs, backfilled, grade)
+	}
+}
+
+func TestWriteQualityCSV(t *testing.T) {
+	ds, err := readDaily(strings.NewReader(testQuality))
+	if err != nil {
+		t.Fatal("readDaily failed: ", err)
+	}
+	var b bytes.Buffer
+	if err := writeQualityCSV(&b, ds, []time.Time{day(3), day(10)}, 3); err != nil {
+		t.Fatal("writeQualityCSV failed: ", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	want := []string{
+		"AK,2020-07-03,,0,0,0,0,0,0,0,0,0,0,0,0",
+		"AK,2020-07-10,C,1,0,0,0,0,0,0,0,0,0,0,0",
+		"CA,2020-07-03,B,3,1,0,0,0,0,0,0,0,0,0,0",
+		"CA,2020-07-10,A,5,0,3,2,0,0,0,0,0,0,0,0",
+	}
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "State,Week Ending,Grade,Records,Backfilled,") {
+		t.Fatalf("writeQualityCSV wrote unexpected output:\n%s", b.String())
+	}
+	if diff := cmp.Diff(want, lines[1:]); diff != "" {
+		t.Error("writeQualityCSV wrote bad rows:\n" + diff)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Daniel Erat <dan@erat.org>.
+// All rights reserved.
+
+package main
+
+import "time"
+
+// hatch describes a hatched region drawn behind a time plot.
+type hatch struct {
+	Start, End int64 // seconds since the Unix epoch
+	Color      int   // gnuplot line type
+	Pattern    int   // gnuplot fill pattern
+}
+
+// Fill patterns used for hatching missing, stale, and backfilled days.
+const (
+	missingPattern    = 4
+	stalePattern      = 5
+	backfilledPattern = 6
+)
+
+// newHatch returns a hatch covering the days in g.
+func newHatch(g gap, color int) hatch {
+	h := hatch{
+		Start:   g.start.Add(-12 * time.Hour).Unix(),
+		End:     g.end.Add(12 * time.Hour).Unix(),
+		Color:   color,
+		Pattern: missingPattern,
+	}
+	switch g.status {
+	case statusStale:
+		h.Pattern = stalePattern
+	case statusBackfilled:
+		h.Pattern = backfilledPattern
+	}
+	return h
+}
+
+const (
+	timeTmpl = `
+set title 'COVID Tracking Project {{.Vars.Title}} in {{.Vars.StateList}}'
+
+{{.SetTerm}}
+{{.SetOutput}}
+
+set timefmt '%Y-%m-%d'
+set xdata time
+set format x '%m/%d'
+set xlabel 'Date'
+set ylabel '{{.Vars.YLabel}}'
+set yrange [0:*]
+set grid front xtics ytics
+set key top left
+set bmargin 5
+{{.FooterLabel}}
+{{.ThemeCmds}}
+
+# Hatch days with missing, stale, or backfilled values.
+{{range .Vars.Hatches -}}
+set object rect from {{.Start}}, graph 0 to {{.End}}, graph 1 behind noborder fc lt {{.Color}} fs transparent pattern {{.Pattern}}
+{{end -}}
+
+plot \
+{{- range $i, $st := .Vars.States}}
+  {{$.Data}} index {{$i}} using 1:2 with lines lw 2 title '{{$st}}', \
+{{- end}}
+{{- if .Vars.Hatches}}
+  NaN with filledcurves above fs transparent pattern {{.Vars.MissingPattern}} lc rgb '#555555' title 'Missing', \
+  NaN with filledcurves above fs transparent pattern {{.Vars.StalePattern}} lc rgb '#555555' title 'Stale', \
+  NaN with filledcurves above fs transparent pattern {{.Vars.BackfilledPattern}} lc rgb '#555555' title 'Backfilled', \
+{{- end}}
+  NaN notitle
+`
+
+	distTmpl = `
+set title "COVID Tracking Project {{.Vars.Title}}"
+
+{{.SetTerm}}
+{{.SetOutput}}
+
+set style fill solid 0.5 border -1
+set boxwidth 0.4
+set pointsize 0.5
+
+set key off
+set border 2
+set ytics nomirror
+set grid ytics
+set xlabel '{{.Vars.XLabel}}'
+set ylabel '{{.Vars.YLabel}}'
+set yrange [0:*]
+set bmargin 5
+{{.FooterLabel}}
+{{.ThemeCmds}}
+
+# https://stackoverflow.com/a/37453347
+set xtics () scale 0
+set xrange [-0.5:{{len .Vars.Labels}}-0.5]
+{{range $i, $l := .Vars.Labels -}}
+set xtics add ("{{$l}}" {{$i}})
+{{end}}
+# Boxes and whiskers are computed ahead of time, with outliers in a separate block.
+plot {{.Data}} index 0 using 1:3:2:6:5 with candlesticks whiskerbars lc rgb '#3f51b5' notitle, \
+  {{.Data}} index 0 using 1:4:4:4:4 with candlesticks lc black lw 2 notitle, \
+  {{.Data}} index 1 using 1:2 with points pt 7 lc rgb '#c62828' notitle, \
+  {{.Data}} index 1 using 1:2:3 with labels left offset 0.8,0 font ',12' notitle
+`
+)